@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+)
+
+// Entry is a change of a short code made by a caller
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Actor is a subject of a caller who made a change
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	ShortCode string `json:"shortCode"`
+	Tenant    string `json:"tenant,omitempty"`
+	Domain    string `json:"domain,omitempty"`
+	// Expiry is a new expiry of a change of an expiry, nil for never
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+// Recorder records audit entries
+type Recorder interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+// logRecorder writes each entry as a line of JSON
+type logRecorder struct {
+	logger *log.Logger
+}
+
+// NewLogRecorder returns a recorder writing each entry as a line of JSON to `w`
+func NewLogRecorder(w io.Writer) Recorder {
+	return &logRecorder{logger: log.New(w, "", 0)}
+}
+
+// Record writes an entry, the standard logger is safe for concurrent use so lines are never interleaved
+func (r *logRecorder) Record(ctx context.Context, entry Entry) error {
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	r.logger.Println(string(jsonBytes))
+	return nil
+}
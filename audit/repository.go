@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"url-shortener/repository"
+)
+
+// key of a sorted set of audit entries, members are `{time}:{entry}` with a time in Unix nanoseconds
+// padded to 19 digits and an entry in JSON, so that entries are sorted by their time
+const entriesKey = "audit"
+
+// timeWidth is the number of digits of a time of a member, the maximum int64 has 19 digits
+const timeWidth = 19
+
+// repositoryRecorder saves entries in a repository, so they're kept as long as short codes are
+type repositoryRecorder struct {
+	repository repository.Repository
+}
+
+// NewRepositoryRecorder returns a recorder saving entries in a sorted set of a repository
+func NewRepositoryRecorder(repo repository.Repository) Recorder {
+	return &repositoryRecorder{repository: repo}
+}
+
+// Record saves an entry
+func (r *repositoryRecorder) Record(ctx context.Context, entry Entry) error {
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	member := fmt.Sprintf("%0*d:%s", timeWidth, entry.Time.UnixNano(), jsonBytes)
+	if err = r.repository.ZAdd(ctx, entriesKey, member); err != nil {
+		return fmt.Errorf("failed to save audit entry: %v", err)
+	}
+	return nil
+}
+
+// List returns at most `limit` latest entries saved by a repository recorder, the latest one first
+func List(ctx context.Context, repo repository.Repository, limit int) ([]Entry, error) {
+	members, err := repo.ZRangeByLex(ctx, entriesKey, "", false, true, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit entries: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(members))
+	for _, member := range members {
+		i := strings.IndexByte(member, ':')
+		if i < 0 {
+			continue
+		}
+		var entry Entry
+		if err = json.Unmarshal([]byte(member[i+1:]), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
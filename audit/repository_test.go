@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+	"url-shortener/repository"
+
+	"gotest.tools/assert"
+)
+
+func TestRepositoryRecorder(t *testing.T) {
+	repo := repository.NewMemory()
+	recorder := NewRepositoryRecorder(repo)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	for i, code := range []string{"b", "a", "c"} {
+		entry := Entry{Time: now.Add(time.Duration(i) * time.Second), Actor: "admin", Action: "delete", ShortCode: code}
+		if err := recorder.Record(ctx, entry); err != nil {
+			t.Fatalf("failed to record, err: %v", err)
+		}
+	}
+
+	// the latest entries are listed first
+	entries, err := List(ctx, repo, 2)
+	if err != nil {
+		t.Fatalf("failed to list, err: %v", err)
+	}
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "c", entries[0].ShortCode)
+	assert.Equal(t, "a", entries[1].ShortCode)
+	assert.Assert(t, entries[0].Time.Equal(now.Add(2*time.Second)))
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"url-shortener/customError"
+	"url-shortener/repository"
+)
+
+// APIKeyHeader is a header of requests carrying an API key
+const APIKeyHeader = "X-API-Key"
+
+// key for saving an API key, it has a pattern `apikey:{id}`
+const apiKeyPattern = "apikey:%s"
+
+// key of a hash indexing all API key ids to their names, it is used for listing
+const apiKeyIndexKey = "apikeys"
+
+// APIKey is a saved API key, only a hash of its secret is saved
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role,omitempty"`
+	Tenant    string     `json:"tenant,omitempty"`
+	Hash      []byte     `json:"hash"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// KeyStore is an interface for managing API keys, it authenticates requests by them
+type KeyStore interface {
+	Authenticator
+	// Create saves a new API key of a tenant and returns it with its secret key, which is never returned again
+	Create(ctx context.Context, name string, role Role, tenantID string) (*APIKey, string, error)
+	Get(ctx context.Context, id string) (*APIKey, error)
+	List(ctx context.Context) ([]*APIKey, error)
+	Revoke(ctx context.Context, id string) error
+	// Rotate replaces a secret key of an API key, the old one stops working immediately
+	Rotate(ctx context.Context, id string) (*APIKey, string, error)
+}
+
+// keyStore is an API keys management saving them in a repository
+type keyStore struct {
+	repository repository.Repository
+}
+
+// NewKeyStore is a constructor of KeyStore
+func NewKeyStore(repo repository.Repository) KeyStore {
+	return &keyStore{repository: repo}
+}
+
+// Create saves a new API key of a tenant and returns it with its secret key
+func (s *keyStore) Create(ctx context.Context, name string, role Role, tenantID string) (*APIKey, string, error) {
+	id, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return nil, "", customError.Internal(customError.CodeInternal, "failed to generate api key", err)
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", customError.Internal(customError.CodeInternal, "failed to generate api key", err)
+	}
+
+	key := &APIKey{
+		ID:        id,
+		Name:      name,
+		Role:      role,
+		Tenant:    tenantID,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now(),
+	}
+	set, err := s.repository.SetNX(ctx, fmt.Sprintf(apiKeyPattern, id), key, nil)
+	if err != nil {
+		return nil, "", customError.Unavailable("failed to set api key", err)
+	}
+	if !set {
+		return nil, "", customError.Internal(customError.CodeInternal, "api key id collides", nil)
+	}
+
+	err = s.repository.HSet(ctx, apiKeyIndexKey, id, name)
+	if err != nil {
+		return nil, "", customError.Unavailable("failed to index api key", err)
+	}
+
+	return key, formatKey(id, secret), nil
+}
+
+// List returns all API keys including revoked ones ordered by their creation
+func (s *keyStore) List(ctx context.Context) ([]*APIKey, error) {
+	index, err := s.repository.HGetAll(ctx, apiKeyIndexKey)
+	if err != nil {
+		return nil, customError.Unavailable("failed to get api keys", err)
+	}
+	if len(index) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]interface{}, 0, len(index))
+	for id := range index {
+		keys = append(keys, fmt.Sprintf(apiKeyPattern, id))
+	}
+	apiKeys := make([]*APIKey, len(keys))
+	err = s.repository.MGet(ctx, keys, &apiKeys)
+	if err != nil {
+		return nil, customError.Unavailable("failed to get api keys", err)
+	}
+
+	var list []*APIKey
+	for _, key := range apiKeys {
+		if key != nil {
+			list = append(list, key)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	return list, nil
+}
+
+// Revoke disables an API key, it is kept for auditing
+func (s *keyStore) Revoke(ctx context.Context, id string) error {
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	return s.update(ctx, key)
+}
+
+// Rotate replaces a secret key of an API key and returns a new secret key
+func (s *keyStore) Rotate(ctx context.Context, id string) (*APIKey, string, error) {
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.RevokedAt != nil {
+		return nil, "", customError.Gone(customError.CodeAPIKeyRevoked, "this api key is revoked")
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", customError.Internal(customError.CodeInternal, "failed to generate api key", err)
+	}
+	now := time.Now()
+	key.Hash = hashSecret(secret)
+	key.RotatedAt = &now
+	if err = s.update(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, formatKey(id, secret), nil
+}
+
+// Authenticate returns a caller of an API key in the API key header
+func (s *keyStore) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get(APIKeyHeader)
+	if header == "" {
+		return nil, ErrNoCredentials
+	}
+	id, secret, ok := parseKey(header)
+	if !ok {
+		return nil, errInvalidKey()
+	}
+
+	var key APIKey
+	err := s.repository.Get(r.Context(), fmt.Sprintf(apiKeyPattern, id), &key)
+	if err == repository.ErrNotFound {
+		return nil, errInvalidKey()
+	}
+	if err != nil {
+		return nil, customError.Unavailable("failed to get api key", err)
+	}
+
+	if subtle.ConstantTimeCompare(hashSecret(secret), key.Hash) != 1 || key.RevokedAt != nil {
+		return nil, errInvalidKey()
+	}
+
+	return &Principal{
+		Subject: "apikey:" + key.ID,
+		Name:    key.Name,
+		Roles:   []string{string(key.EffectiveRole())},
+		Tenant:  key.Tenant,
+	}, nil
+}
+
+// EffectiveRole returns a role of an API key, keys created before roles were introduced are admins
+func (k *APIKey) EffectiveRole() Role {
+	if k.Role == "" {
+		return RoleAdmin
+	}
+	return k.Role
+}
+
+// Get returns an API key of `id`
+func (s *keyStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	err := s.repository.Get(ctx, fmt.Sprintf(apiKeyPattern, id), &key)
+	if err == repository.ErrNotFound {
+		return nil, customError.NotFound(customError.CodeAPIKeyNotFound, "this api key is not found")
+	}
+	if err != nil {
+		return nil, customError.Unavailable("failed to get api key", err)
+	}
+	return &key, nil
+}
+
+// update saves a changed API key
+func (s *keyStore) update(ctx context.Context, key *APIKey) error {
+	updated, err := s.repository.Update(ctx, fmt.Sprintf(apiKeyPattern, key.ID), key)
+	if err != nil {
+		return customError.Unavailable("failed to update api key", err)
+	}
+	if !updated {
+		return customError.NotFound(customError.CodeAPIKeyNotFound, "this api key is not found")
+	}
+	return nil
+}
+
+// formatKey returns an API key sent by clients, it has a pattern `{id}.{secret}`
+func formatKey(id string, secret string) string {
+	return id + "." + secret
+}
+
+// parseKey returns an id and a secret of an API key sent by clients
+func parseKey(key string) (string, string, bool) {
+	i := strings.IndexByte(key, '.')
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+// randomString returns `n` random bytes encoded by `encode`
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
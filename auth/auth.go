@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"url-shortener/customError"
+)
+
+// ErrNoCredentials is returned by an Authenticator when a request has no credentials it handles,
+// so that the next Authenticator can be tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is an authenticated caller of APIs
+type Principal struct {
+	// Subject identifies a caller, e.g. `apikey:{id}`
+	Subject string `json:"subject"`
+	// Name is a human-readable name of a caller
+	Name string `json:"name"`
+	// Roles are roles granted to a caller by an identity provider
+	Roles []string `json:"roles,omitempty"`
+	// Tenant is an id of a tenant of a caller, it is empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Authenticator is an interface for verifying credentials of requests
+type Authenticator interface {
+	// Authenticate returns a caller of a request.
+	// It returns ErrNoCredentials if a request has no credentials it handles.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// chain tries authenticators in order until one of them handles credentials of a request
+type chain []Authenticator
+
+// Chain combines authenticators, a request is authenticated by the first one handling its credentials
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
+
+// Authenticate returns a caller of a request from the first authenticator handling its credentials
+func (c chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// staticKey accepts a single API key from configuration, it is used to create the first API keys
+type staticKey struct {
+	hash []byte
+}
+
+// NewStaticKey initiates an authenticator accepting only `key` in the API key header
+func NewStaticKey(key string) Authenticator {
+	return &staticKey{hash: hashSecret(key)}
+}
+
+// Authenticate returns a bootstrap caller if a request has the static key
+func (k *staticKey) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	if subtle.ConstantTimeCompare(hashSecret(key), k.hash) != 1 {
+		return nil, ErrNoCredentials
+	}
+	return &Principal{Subject: "bootstrap", Name: "bootstrap", Roles: []string{string(RoleSuperAdmin)}}, nil
+}
+
+// hashSecret returns a SHA-256 hash of a secret.
+// Secrets are long random strings, so a slow password hash isn't needed.
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// errInvalidKey returns an error of an API key which doesn't exist, is revoked or doesn't match
+func errInvalidKey() error {
+	return customError.Unauthorized("invalid api key")
+}
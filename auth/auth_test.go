@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"url-shortener/customError"
+	"url-shortener/repository"
+
+	"gotest.tools/assert"
+)
+
+func newRequest(key string) *http.Request {
+	r, _ := http.NewRequest("GET", "/admin/urls", nil)
+	if key != "" {
+		r.Header.Set(APIKeyHeader, key)
+	}
+	return r
+}
+
+func assertUnauthorized(t *testing.T, err error) {
+	t.Helper()
+	cerr, ok := err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.KindUnauthorized, cerr.Kind)
+}
+
+func TestKeyStore(t *testing.T) {
+	keys := NewKeyStore(repository.NewMemory())
+	ctx := context.Background()
+
+	key, secret, err := keys.Create(ctx, "deploy bot", RoleEditor, "marketing")
+	if err != nil {
+		t.Fatalf("failed to create key, err: %v", err)
+	}
+
+	principal, err := keys.Authenticate(newRequest(secret))
+	if err != nil {
+		t.Fatalf("failed to authenticate, err: %v", err)
+	}
+	assert.DeepEqual(t, &Principal{Subject: "apikey:" + key.ID, Name: "deploy bot", Roles: []string{"editor"}, Tenant: "marketing"}, principal)
+
+	// a wrong secret of an existing id
+	_, err = keys.Authenticate(newRequest(key.ID + ".wrong"))
+	assertUnauthorized(t, err)
+	_, err = keys.Authenticate(newRequest("malformed"))
+	assertUnauthorized(t, err)
+	_, err = keys.Authenticate(newRequest(""))
+	assert.Equal(t, ErrNoCredentials, err)
+
+	// the old secret stops working after rotation
+	_, rotated, err := keys.Rotate(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("failed to rotate key, err: %v", err)
+	}
+	_, err = keys.Authenticate(newRequest(secret))
+	assertUnauthorized(t, err)
+	if _, err = keys.Authenticate(newRequest(rotated)); err != nil {
+		t.Fatalf("failed to authenticate, err: %v", err)
+	}
+
+	// a revoked key is kept but can't be used
+	if err = keys.Revoke(ctx, key.ID); err != nil {
+		t.Fatalf("failed to revoke key, err: %v", err)
+	}
+	_, err = keys.Authenticate(newRequest(rotated))
+	assertUnauthorized(t, err)
+
+	_, _, err = keys.Rotate(ctx, key.ID)
+	cerr, ok := err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.CodeAPIKeyRevoked, cerr.Code)
+
+	list, err := keys.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list keys, err: %v", err)
+	}
+	assert.Equal(t, 1, len(list))
+	assert.Assert(t, list[0].RevokedAt != nil)
+
+	err = keys.Revoke(ctx, "missing")
+	cerr, ok = err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.CodeAPIKeyNotFound, cerr.Code)
+}
+
+func TestChain(t *testing.T) {
+	keys := NewKeyStore(repository.NewMemory())
+	authenticator := Chain(NewStaticKey("bootstrap-key"), keys)
+
+	principal, err := authenticator.Authenticate(newRequest("bootstrap-key"))
+	if err != nil {
+		t.Fatalf("failed to authenticate, err: %v", err)
+	}
+	assert.Equal(t, "bootstrap", principal.Subject)
+
+	// a key not matching the static key is checked by the key store
+	_, secret, _ := keys.Create(context.Background(), "ops", RoleAdmin, "")
+	principal, err = authenticator.Authenticate(newRequest(secret))
+	if err != nil {
+		t.Fatalf("failed to authenticate, err: %v", err)
+	}
+	assert.Equal(t, "ops", principal.Name)
+
+	_, err = authenticator.Authenticate(newRequest("other-key"))
+	assertUnauthorized(t, err)
+
+	_, err = authenticator.Authenticate(newRequest(""))
+	assert.Equal(t, ErrNoCredentials, err)
+}
+
+func TestRole(t *testing.T) {
+	assert.Assert(t, RoleAdmin.Includes(RoleViewer))
+	assert.Assert(t, RoleEditor.Includes(RoleEditor))
+	assert.Assert(t, !RoleEditor.Includes(RoleAdmin))
+	assert.Assert(t, !Role("owner").Includes(RoleViewer))
+
+	principal := &Principal{Roles: []string{"everyone", "editor"}}
+	assert.Assert(t, principal.HasRole(RoleViewer))
+	assert.Assert(t, principal.HasRole(RoleEditor))
+	assert.Assert(t, !principal.HasRole(RoleAdmin))
+	assert.Assert(t, !(&Principal{}).HasRole(RoleViewer))
+
+	role, err := ParseRole("admin")
+	assert.NilError(t, err)
+	assert.Equal(t, RoleAdmin, role)
+	_, err = ParseRole("root")
+	assert.ErrorContains(t, err, "unknown role")
+
+	// keys created before roles were introduced keep admin permissions
+	assert.Equal(t, RoleAdmin, (&APIKey{}).EffectiveRole())
+}
@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"url-shortener/customError"
+	"url-shortener/tenant"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// defaultRolesClaim is a claim of roles if JWTConfig.RolesClaim is empty
+const defaultRolesClaim = "roles"
+
+// defaultTenantClaim is a claim of a tenant if JWTConfig.TenantClaim is empty
+const defaultTenantClaim = "tenant"
+
+// asymmetric signing methods accepted in tokens, shared secrets and `none` are never accepted
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// JWTConfig is a configuration of JWT bearer token authentication
+type JWTConfig struct {
+	// JWKSFile is a path of a JSON Web Key Set of public keys identified by `kid`
+	JWKSFile string
+	// PublicKeyFiles are paths of PEM encoded public keys, they are tried in order for tokens without `kid`
+	PublicKeyFiles []string
+	// Issuer and Audience are checked against `iss` and `aud` claims if not empty
+	Issuer   string
+	Audience string
+	// RolesClaim is a claim of roles, a nested claim is separated by dots like `realm_access.roles`.
+	// A claim may be an array of strings or a string separated by spaces like `scope`.
+	RolesClaim string
+	// RoleMapping maps roles in tokens to roles of this service case-insensitively, roles not mapped are dropped.
+	// Roles in tokens are used as they are if it is empty.
+	RoleMapping map[string]string
+	// TenantClaim is a claim of a tenant id, a nested claim is separated by dots.
+	// A caller belongs to the default tenant if a token has no tenant.
+	TenantClaim string
+}
+
+// jwtAuthenticator verifies JWT bearer tokens signed by configured public keys
+type jwtAuthenticator struct {
+	config JWTConfig
+	// keys are public keys identified by `kid`
+	keys map[string]crypto.PublicKey
+	// staticKeys are public keys without `kid`
+	staticKeys []crypto.PublicKey
+	parser     *jwt.Parser
+}
+
+// NewJWT initiates an authenticator of `Authorization: Bearer` tokens.
+// Public keys are loaded from files once, they are not refreshed.
+func NewJWT(config JWTConfig) (Authenticator, error) {
+	a := &jwtAuthenticator{
+		config: config,
+		keys:   make(map[string]crypto.PublicKey),
+		parser: &jwt.Parser{ValidMethods: jwtMethods},
+	}
+	if a.config.RolesClaim == "" {
+		a.config.RolesClaim = defaultRolesClaim
+	}
+	if a.config.TenantClaim == "" {
+		a.config.TenantClaim = defaultTenantClaim
+	}
+	// config keys are lowercased by viper, so roles are matched case-insensitively
+	a.config.RoleMapping = make(map[string]string, len(config.RoleMapping))
+	for from, to := range config.RoleMapping {
+		a.config.RoleMapping[strings.ToLower(from)] = to
+	}
+
+	if config.JWKSFile != "" {
+		data, err := ioutil.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwks, err: %v", err)
+		}
+		a.keys, err = parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse jwks, err: %v", err)
+		}
+	}
+
+	for _, path := range config.PublicKeyFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key, err: %v", err)
+		}
+		key, err := parsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %s, err: %v", path, err)
+		}
+		a.staticKeys = append(a.staticKeys, key)
+	}
+
+	if len(a.keys) == 0 && len(a.staticKeys) == 0 {
+		return nil, fmt.Errorf("no public key is configured")
+	}
+
+	return a, nil
+}
+
+// Authenticate returns a caller of a bearer token in the Authorization header
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	tokenString := strings.TrimSpace(header[7:])
+
+	claims, err := a.verify(tokenString)
+	if err != nil {
+		return nil, customError.Unauthorized(fmt.Sprintf("invalid bearer token, err: %v", err))
+	}
+
+	// an expiry is required so that a leaked token doesn't work forever
+	if _, ok := claims["exp"]; !ok {
+		return nil, customError.Unauthorized("invalid bearer token, err: exp is required")
+	}
+	if a.config.Issuer != "" && !claims.VerifyIssuer(a.config.Issuer, true) {
+		return nil, customError.Unauthorized("invalid bearer token, err: unexpected issuer")
+	}
+	if a.config.Audience != "" && !claims.VerifyAudience(a.config.Audience, true) {
+		return nil, customError.Unauthorized("invalid bearer token, err: unexpected audience")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, customError.Unauthorized("invalid bearer token, err: sub is required")
+	}
+	name := subject
+	for _, claim := range []string{"preferred_username", "name", "email"} {
+		if value, ok := claims[claim].(string); ok && value != "" {
+			name = value
+			break
+		}
+	}
+
+	tenantID, _ := claimValue(claims, a.config.TenantClaim).(string)
+	if tenantID != tenant.Default {
+		if err = tenant.CheckID(tenantID); err != nil {
+			return nil, customError.Unauthorized(fmt.Sprintf("invalid bearer token, err: %v", err))
+		}
+	}
+
+	return &Principal{
+		Subject: "jwt:" + subject,
+		Name:    name,
+		Roles:   a.roles(claims),
+		Tenant:  tenantID,
+	}, nil
+}
+
+// verify parses a token and verifies its signature and time claims
+func (a *jwtAuthenticator) verify(tokenString string) (jwt.MapClaims, error) {
+	var candidates []crypto.PublicKey
+	unverified, _, err := a.parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	if kid, ok := unverified.Header["kid"].(string); ok && kid != "" {
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid: %s", kid)
+		}
+		candidates = []crypto.PublicKey{key}
+	} else {
+		candidates = a.staticKeys
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("kid is required")
+	}
+
+	for _, key := range candidates {
+		claims := jwt.MapClaims{}
+		_, err = a.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		if err == nil {
+			return claims, nil
+		}
+	}
+	return nil, err
+}
+
+// claimValue returns a value of a claim, a nested claim is separated by dots
+func claimValue(claims jwt.MapClaims, path string) interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// roles returns roles of this service in claims
+func (a *jwtAuthenticator) roles(claims jwt.MapClaims) []string {
+	var roles []string
+	switch v := claimValue(claims, a.config.RolesClaim).(type) {
+	case string:
+		roles = strings.Fields(v)
+	case []interface{}:
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+
+	if len(a.config.RoleMapping) == 0 {
+		return roles
+	}
+	var mapped []string
+	for _, role := range roles {
+		if m, ok := a.config.RoleMapping[strings.ToLower(role)]; ok {
+			mapped = append(mapped, m)
+		}
+	}
+	return mapped
+}
+
+// jwk is a JSON Web Key of a public key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns public keys of a JSON Web Key Set by their `kid`, keys not for signatures are skipped
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kid == "" {
+			return nil, fmt.Errorf("kid is required")
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %s, err: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey returns a public key of a JSON Web Key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// parsePublicKeyPEM returns an RSA, ECDSA or Ed25519 public key in a PEM block
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported pem block: %s", block.Type)
+	}
+	return cert.PublicKey, nil
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gotest.tools/assert"
+)
+
+// jwtKeys are locally generated signing keys standing for an identity provider
+type jwtKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	// pem is a private key whose public key is configured as a PEM file
+	pem *rsa.PrivateKey
+	dir string
+}
+
+func newJWTKeys(t *testing.T) *jwtKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key, err: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key, err: %v", err)
+	}
+	pemKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key, err: %v", err)
+	}
+	keys := &jwtKeys{rsa: rsaKey, ec: ecKey, pem: pemKey, dir: t.TempDir()}
+
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa", "use": "sig",
+				"n": encode(rsaKey.N.Bytes()),
+				"e": encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": encode(ecKey.X.Bytes()),
+				"y": encode(ecKey.Y.Bytes()),
+			},
+			// keys for encryption are skipped
+			{"kty": "oct", "kid": "enc", "use": "enc", "k": "c2VjcmV0"},
+		},
+	})
+	if err = ioutil.WriteFile(keys.jwksFile(), jwks, 0600); err != nil {
+		t.Fatalf("failed to write jwks, err: %v", err)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&pemKey.PublicKey)
+	block := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err = ioutil.WriteFile(keys.pemFile(), block, 0600); err != nil {
+		t.Fatalf("failed to write public key, err: %v", err)
+	}
+
+	return keys
+}
+
+func (k *jwtKeys) jwksFile() string {
+	return filepath.Join(k.dir, "jwks.json")
+}
+
+func (k *jwtKeys) pemFile() string {
+	return filepath.Join(k.dir, "public.pem")
+}
+
+// validClaims returns claims accepted by an authenticator of jwtTestConfig
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "user-1",
+		"preferred_username": "alice",
+		"iss":                "https://idp.example.com",
+		"aud":                "shortener",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"roles":              []string{"shortener-admins", "everyone"},
+	}
+}
+
+func jwtTestConfig(keys *jwtKeys) JWTConfig {
+	return JWTConfig{
+		JWKSFile:       keys.jwksFile(),
+		PublicKeyFiles: []string{keys.pemFile()},
+		Issuer:         "https://idp.example.com",
+		Audience:       "shortener",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token, err: %v", err)
+	}
+	return signed
+}
+
+func newBearerRequest(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/admin/urls", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestJWT(t *testing.T) {
+	keys := newJWTKeys(t)
+	authenticator, err := NewJWT(jwtTestConfig(keys))
+	if err != nil {
+		t.Fatalf("failed to initiate jwt authenticator, err: %v", err)
+	}
+
+	expected := &Principal{
+		Subject: "jwt:user-1",
+		Name:    "alice",
+		Roles:   []string{"shortener-admins", "everyone"},
+	}
+	tokens := map[string]string{
+		"jwks rsa": sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, validClaims()),
+		"jwks ec":  sign(t, jwt.SigningMethodES256, "ec", keys.ec, validClaims()),
+		"pem":      sign(t, jwt.SigningMethodPS256, "", keys.pem, validClaims()),
+	}
+	for name, token := range tokens {
+		principal, err := authenticator.Authenticate(newBearerRequest(token))
+		if err != nil {
+			t.Fatalf("failed to authenticate by %s, err: %v", name, err)
+		}
+		assert.DeepEqual(t, expected, principal)
+	}
+
+	// requests without a bearer token are left to other authenticators
+	_, err = authenticator.Authenticate(newBearerRequest(""))
+	assert.Equal(t, ErrNoCredentials, err)
+	r := newBearerRequest("")
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, err = authenticator.Authenticate(r)
+	assert.Equal(t, ErrNoCredentials, err)
+}
+
+func TestJWT_Invalid(t *testing.T) {
+	keys := newJWTKeys(t)
+	authenticator, err := NewJWT(jwtTestConfig(keys))
+	if err != nil {
+		t.Fatalf("failed to initiate jwt authenticator, err: %v", err)
+	}
+
+	claims := func(update func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		update(c)
+		return c
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tokens := map[string]string{
+		"expired": sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})),
+		"no expiry": sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			delete(c, "exp")
+		})),
+		"no subject": sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			delete(c, "sub")
+		})),
+		"wrong issuer": sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			c["iss"] = "https://evil.example.com"
+		})),
+		"wrong audience": sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			c["aud"] = []string{"other"}
+		})),
+		"wrong key":          sign(t, jwt.SigningMethodRS256, "rsa", otherKey, validClaims()),
+		"wrong key no kid":   sign(t, jwt.SigningMethodRS256, "", otherKey, validClaims()),
+		"unknown kid":        sign(t, jwt.SigningMethodRS256, "unknown", keys.rsa, validClaims()),
+		"key of another kid": sign(t, jwt.SigningMethodRS256, "ec", keys.rsa, validClaims()),
+		// a public key must never be used as an HMAC secret
+		"hmac":      sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims()),
+		"none":      unsigned,
+		"malformed": "not.a.token",
+	}
+	for name, token := range tokens {
+		_, err := authenticator.Authenticate(newBearerRequest(token))
+		assertUnauthorized(t, err)
+		assert.Assert(t, err != ErrNoCredentials, "token: %s", name)
+	}
+}
+
+func TestJWT_Roles(t *testing.T) {
+	keys := newJWTKeys(t)
+
+	cases := []struct {
+		name     string
+		claim    string
+		mapping  map[string]string
+		claims   map[string]interface{}
+		expected []string
+	}{
+		{
+			name:     "mapped",
+			mapping:  map[string]string{"Shortener-Admins": "admin"},
+			claims:   map[string]interface{}{"roles": []string{"shortener-admins", "everyone"}},
+			expected: []string{"admin"},
+		},
+		{
+			name:     "nested",
+			claim:    "realm_access.roles",
+			claims:   map[string]interface{}{"realm_access": map[string]interface{}{"roles": []string{"editor"}}},
+			expected: []string{"editor"},
+		},
+		{
+			name:     "space separated",
+			claim:    "scope",
+			mapping:  map[string]string{"urls:write": "editor", "urls:read": "viewer"},
+			claims:   map[string]interface{}{"scope": "openid urls:read urls:write"},
+			expected: []string{"viewer", "editor"},
+		},
+		{
+			name:   "missing",
+			claims: map[string]interface{}{},
+		},
+	}
+	for _, c := range cases {
+		config := jwtTestConfig(keys)
+		config.RolesClaim = c.claim
+		config.RoleMapping = c.mapping
+		authenticator, err := NewJWT(config)
+		if err != nil {
+			t.Fatalf("failed to initiate jwt authenticator, err: %v", err)
+		}
+
+		claims := validClaims()
+		delete(claims, "roles")
+		for name, value := range c.claims {
+			claims[name] = value
+		}
+		principal, err := authenticator.Authenticate(newBearerRequest(sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims)))
+		if err != nil {
+			t.Fatalf("failed to authenticate %s, err: %v", c.name, err)
+		}
+		assert.DeepEqual(t, c.expected, principal.Roles)
+	}
+}
+
+func TestNewJWT_InvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid")
+	_ = ioutil.WriteFile(invalid, []byte("invalid"), 0600)
+
+	configs := map[string]JWTConfig{
+		"no keys":      {},
+		"missing jwks": {JWKSFile: filepath.Join(dir, "missing.json")},
+		"invalid jwks": {JWKSFile: invalid},
+		"invalid pem":  {PublicKeyFiles: []string{invalid}},
+		"missing pem":  {PublicKeyFiles: []string{filepath.Join(dir, "missing.pem")}},
+	}
+	for name, config := range configs {
+		_, err := NewJWT(config)
+		assert.Assert(t, err != nil, "config: %s", name)
+	}
+}
+
+func TestJWT_Tenant(t *testing.T) {
+	keys := newJWTKeys(t)
+	config := jwtTestConfig(keys)
+	authenticator, err := NewJWT(config)
+	if err != nil {
+		t.Fatalf("failed to initiate jwt authenticator, err: %v", err)
+	}
+
+	claims := validClaims()
+	principal, err := authenticator.Authenticate(newBearerRequest(sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims)))
+	assert.NilError(t, err)
+	assert.Equal(t, "", principal.Tenant)
+
+	claims["tenant"] = "marketing"
+	principal, err = authenticator.Authenticate(newBearerRequest(sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims)))
+	assert.NilError(t, err)
+	assert.Equal(t, "marketing", principal.Tenant)
+
+	// a tenant id is a part of storage keys, so an invalid one is rejected
+	claims["tenant"] = "Marketing:*"
+	_, err = authenticator.Authenticate(newBearerRequest(sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims)))
+	assertUnauthorized(t, err)
+
+	config.TenantClaim = "org.unit"
+	authenticator, err = NewJWT(config)
+	if err != nil {
+		t.Fatalf("failed to initiate jwt authenticator, err: %v", err)
+	}
+	claims["org"] = map[string]interface{}{"unit": "sales"}
+	principal, err = authenticator.Authenticate(newBearerRequest(sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims)))
+	assert.NilError(t, err)
+	assert.Equal(t, "sales", principal.Tenant)
+}
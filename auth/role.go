@@ -0,0 +1,50 @@
+package auth
+
+import "fmt"
+
+// Role is a set of permissions of a caller, a role has all permissions of lower roles
+type Role string
+
+const (
+	// RoleViewer can read links
+	RoleViewer Role = "viewer"
+	// RoleEditor can create and update links
+	RoleEditor Role = "editor"
+	// RoleAdmin can delete links and manage API keys of its tenant
+	RoleAdmin Role = "admin"
+	// RoleSuperAdmin can manage data of all tenants
+	RoleSuperAdmin Role = "superadmin"
+)
+
+// levels of roles, a higher role includes lower ones
+var roleLevels = map[Role]int{
+	RoleViewer:     1,
+	RoleEditor:     2,
+	RoleAdmin:      3,
+	RoleSuperAdmin: 4,
+}
+
+// ParseRole returns a role of its name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("unknown role: %s", name)
+	}
+	return role, nil
+}
+
+// Includes reports whether a role has all permissions of `required`
+func (r Role) Includes(required Role) bool {
+	level, ok := roleLevels[r]
+	return ok && level >= roleLevels[required]
+}
+
+// HasRole reports whether a caller has `required` or a higher role, unknown roles are ignored
+func (p *Principal) HasRole(required Role) bool {
+	for _, name := range p.Roles {
+		if Role(name).Includes(required) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of cache counters
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+}
+
+// entry is an element stored in the list of LRU
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// LRU is a fixed-size least recently used cache whose entries also expire
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// New is a constructor of LRU. Every entry lives at most `ttl`.
+func New(capacity int, ttl time.Duration) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns a value of `key` if it is cached and not expired
+func (c *LRU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(elem)
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	atomic.AddUint64(&c.hits, 1)
+	return e.value, true
+}
+
+// Add caches `value` for `key` until `expiresAt` or the TTL of cache, whichever comes first.
+// A zero `expiresAt` means the value only expires by TTL.
+func (c *LRU) Add(key string, value interface{}, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := c.now().Add(c.ttl)
+	if !expiresAt.IsZero() && expiresAt.Before(deadline) {
+		deadline = expiresAt
+	}
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.value = value
+		e.expiresAt = deadline
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: deadline})
+
+	// evict the least recently used entries
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// Remove invalidates a cached value of `key`
+func (c *LRU) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Stats returns current counters of the cache
+func (c *LRU) Stats() Stats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Size:      size,
+		Capacity:  c.capacity,
+	}
+}
+
+// removeElement deletes an element from both list and map, the lock must be held
+func (c *LRU) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*entry).key)
+}
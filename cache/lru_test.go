@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(2, time.Minute)
+	c.Add("a", 1, time.Time{})
+	c.Add("b", 2, time.Time{})
+
+	// touch `a` so `b` becomes the least recently used
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("a should be cached")
+	}
+	c.Add("c", 3, time.Time{})
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("b should be evicted")
+	}
+	if v, ok := c.Get("c"); !ok || v.(int) != 3 {
+		t.Fatalf("c should be cached, got: %v", v)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 || stats.Size != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	now := time.Date(2021, 8, 21, 18, 0, 0, 0, time.UTC)
+	c := New(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("ttl", "x", time.Time{})
+	c.Add("expiry", "y", now.Add(10*time.Second))
+
+	now = now.Add(30 * time.Second)
+	if _, ok := c.Get("expiry"); ok {
+		t.Fatalf("entry should expire at its own expiry")
+	}
+	if _, ok := c.Get("ttl"); !ok {
+		t.Fatalf("entry should still be cached")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("ttl"); ok {
+		t.Fatalf("entry should expire after ttl")
+	}
+}
+
+func TestLRU_Remove(t *testing.T) {
+	c := New(10, time.Minute)
+	c.Add("a", 1, time.Time{})
+	c.Remove("a")
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a should be removed")
+	}
+}
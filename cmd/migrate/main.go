@@ -0,0 +1,37 @@
+// Command migrate rewrites keys of the legacy `url:{shortCode}#{fullUrl}` layout into the current layout.
+// It can run while the service is serving, run it from the directory containing config.json.
+package main
+
+import (
+	"context"
+	"log"
+	"url-shortener/repository"
+	"url-shortener/service"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	viper.SetConfigName("config")
+	viper.SetConfigType("json")
+	viper.AddConfigPath(".")
+	err := viper.ReadInConfig()
+	if err != nil {
+		log.Fatalf("Fatal error config file: %v \n", err)
+	}
+}
+
+func main() {
+	redisAddress := viper.GetString("REDIS_ADDRESS")
+
+	repo, err := repository.NewPool(redisAddress)
+	if err != nil {
+		log.Fatalf("failed to init repository, err: %v", err)
+	}
+
+	migrated, err := service.MigrateLegacyKeys(context.Background(), repo)
+	if err != nil {
+		log.Fatalf("failed to migrate keys after %d keys, err: %v", migrated, err)
+	}
+	log.Printf("migrated %d keys", migrated)
+}
@@ -0,0 +1,421 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/customError"
+	"url-shortener/model"
+	"url-shortener/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBulkRows is the maximum number of rows of bulk shortening
+const MaxBulkRows = 10000
+
+// maxBulkBodySize is the maximum size of a body of bulk shortening
+const maxBulkBodySize = 10 << 20
+
+// csvColumns are columns of a CSV of bulk shortening, only `url` is required
+var csvColumns = []string{"url", "expiry", "alias", "dedupe", "domain", "tags", "folder"}
+
+// filterParams are query params of filters of url objects, short codes changed in bulk are matched by them.
+// A domain isn't one of them since listed short codes are also found in a domain of a request.
+var filterParams = []string{
+	"shortCode", "fullUrl", "owner", "tag", "folder",
+	"minHits", "maxHits", "expiresBefore", "expiresAfter", "createdAfter", "createdBefore",
+}
+
+// bulkRow is an input of a row of bulk shortening or an error of reading it
+type bulkRow struct {
+	input model.ShortenInput
+	err   error
+}
+
+// ShortenBulk godoc
+// @summary Shorten urls in bulk
+// @description Shorten rows of a JSON array of shorten inputs or of a CSV, up to 10000 rows.
+// @description A CSV has a header of columns `url`, `expiry`, `alias`, `dedupe`, `domain`, `tags` and `folder`
+// @description and tags are separated by `;`. It is sent as a `text/csv` body or a `file` of a multipart form.
+// @description Each row is validated and shortened on its own, so a result has a short url or an error of each row.
+// @accept json
+// @accept text/csv
+// @accept mpfd
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param ShortenInputs body []model.ShortenInput true "Inputs for shortening data"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Success 200 {object} model.Response{data=model.BulkShortenOutput}
+// @Failure 400,401,403,503 {object} customError.Response
+// @Router /shorten/bulk [post]
+func (c *controller) ShortenBulk(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBulkBodySize)
+	rows, err := readBulkRows(ctx)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	if len(rows) == 0 {
+		c.respondError(ctx, customError.Validation(customError.CodeInvalidInput, "no rows to shorten"))
+		return
+	}
+	if len(rows) > MaxBulkRows {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("%d rows are more than %d rows", len(rows), MaxBulkRows),
+		))
+		return
+	}
+
+	// invalid rows fail without being shortened
+	output := &model.BulkShortenOutput{Results: make([]model.BulkShortenResult, len(rows))}
+	var requests []model.EncodeRequest
+	var indexes []int
+	for i, row := range rows {
+		output.Results[i].Row = i + 1
+		err := row.err
+		var request *model.EncodeRequest
+		if err == nil {
+			request, err = c.parseShortenInput(ctx, row.input)
+		}
+		if err != nil {
+			output.Results[i].Error = rowError(err)
+			continue
+		}
+		requests = append(requests, *request)
+		indexes = append(indexes, i)
+	}
+
+	for j, result := range c.service.EncodeBulk(ctx.Request.Context(), requests) {
+		i := indexes[j]
+		if result.Err != nil {
+			output.Results[i].Error = rowError(result.Err)
+			continue
+		}
+		output.Results[i].Data = c.output(ctx, result.Object)
+	}
+
+	output.Summary.Total = len(rows)
+	for _, result := range output.Results {
+		if result.Error != nil {
+			output.Summary.Failed++
+		} else {
+			output.Summary.Succeeded++
+		}
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    output,
+	})
+}
+
+// BulkUpdateUrls godoc
+// @summary Change short codes in bulk
+// @description Delete, expire now or set an expiry of listed short codes in a domain of a request,
+// @description or of short codes matching query params of filters like Get all url if no short codes are listed.
+// @description Up to 10000 short codes are changed at once and each change is recorded in an audit entry.
+// @description A dry run reports short codes which would be changed without changing them.
+// @description Callers other than admins can only change their own short codes and only admins can delete them.
+// @accept json
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param BulkUpdateInput body model.BulkUpdateInput true "Action, short codes and an expiry of setExpiry"
+// @Param shortCode query string false "Short Code"
+// @Param fullUrl query string false "Full URL"
+// @Param owner query string false "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins"
+// @Param tag query string false "Tag"
+// @Param folder query string false "Folder, short codes in its subfolders are also matched"
+// @Param expiresBefore query string false "Expires before a RFC3339 time"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain"
+// @Success 200 {object} model.Response{data=model.BulkUpdateOutput}
+// @Failure 400,401,403,503 {object} customError.Response
+// @router /admin/urls/bulk [post]
+func (c *controller) BulkUpdateUrls(ctx *gin.Context) {
+	var input model.BulkUpdateInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		))
+		return
+	}
+	principal := principalOf(ctx)
+	if principal == nil {
+		c.respondError(ctx, customError.Unauthorized("missing credentials"))
+		return
+	}
+
+	// short codes are either listed or matched by filters, so that all short codes aren't changed by mistake
+	filtered := false
+	for _, param := range filterParams {
+		if _, ok := ctx.GetQuery(param); ok {
+			filtered = true
+		}
+	}
+	if len(input.ShortCodes) > 0 && filtered {
+		c.respondError(ctx, customError.Validation(customError.CodeInvalidInput, "short codes can't be listed with filters"))
+		return
+	}
+	if _, ok := ctx.GetQuery("domain"); ok && len(input.ShortCodes) == 0 {
+		filtered = true
+	}
+	if len(input.ShortCodes) == 0 && !filtered {
+		c.respondError(ctx, customError.Validation(customError.CodeInvalidInput, "either short codes or filters are required"))
+		return
+	}
+	if len(input.ShortCodes) > service.MaxBulkUpdate {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("%d short codes are more than %d short codes", len(input.ShortCodes), service.MaxBulkUpdate),
+		))
+		return
+	}
+
+	request := model.BulkUpdateRequest{
+		Action:     input.Action,
+		ShortCodes: input.ShortCodes,
+		DryRun:     input.DryRun,
+		Actor:      principal.Subject,
+	}
+
+	// an expiry is only set by setExpiry and an empty expiry removes an expiry
+	if input.Expiry != "" {
+		if input.Action != model.BulkSetExpiry {
+			c.respondError(ctx, customError.Validation(
+				customError.CodeInvalidExpiry,
+				fmt.Sprintf("expiry can't be set by %s", input.Action),
+			))
+			return
+		}
+		expiry, err := time.Parse(time.RFC3339, input.Expiry)
+		if err != nil {
+			c.respondError(ctx, customError.Validation(
+				customError.CodeInvalidExpiry,
+				fmt.Sprintf("failed to parse expiry, err: %v", err),
+			))
+			return
+		}
+		if !expiry.After(time.Now()) {
+			c.respondError(ctx, customError.Validation(
+				customError.CodeInvalidExpiry,
+				"expiry must be in the future, use expire to expire short codes now",
+			))
+			return
+		}
+		request.Expiry = &expiry
+	}
+
+	// short codes are deleted only by admins like DELETE /admin/urls/{shortCode}
+	if input.Action == model.BulkDelete && !principal.HasRole(auth.RoleAdmin) {
+		c.respondError(ctx, customError.Forbidden(fmt.Sprintf(
+			"role %s is required to delete short codes, caller %s has roles: [%s]",
+			auth.RoleAdmin, principal.Subject, strings.Join(principal.Roles, ", "),
+		)))
+		return
+	}
+
+	// only admins can change short codes of other owners
+	if !principal.HasRole(auth.RoleAdmin) {
+		request.Owner = &principal.Subject
+	}
+	if filtered {
+		query, err := c.urlQuery(ctx)
+		if err != nil {
+			c.respondError(ctx, err)
+			return
+		}
+		request.Query = query
+	}
+
+	results, err := c.service.BulkUpdate(ctx.Request.Context(), request)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	output := &model.BulkUpdateOutput{DryRun: input.DryRun, Results: results}
+	if output.Results == nil {
+		output.Results = []model.BulkUpdateResult{}
+	}
+	output.Summary.Total = len(results)
+	for i := range output.Results {
+		if err := output.Results[i].Err; err != nil {
+			output.Results[i].Error = rowError(err)
+			output.Summary.Failed++
+		} else {
+			output.Summary.Succeeded++
+		}
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    output,
+	})
+}
+
+// readBulkRows reads rows of a JSON array, a CSV body or a CSV file of a multipart form
+func readBulkRows(ctx *gin.Context) ([]bulkRow, error) {
+	switch ctx.ContentType() {
+	case gin.MIMEJSON:
+		var inputs []model.ShortenInput
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&inputs); err != nil {
+			return nil, customError.Validation(
+				customError.CodeInvalidInput,
+				fmt.Sprintf("failed to handle input, err: %v", err),
+			)
+		}
+		rows := make([]bulkRow, len(inputs))
+		for i, input := range inputs {
+			rows[i].input = input
+		}
+		return rows, nil
+	case "text/csv":
+		return readCSV(ctx.Request.Body)
+	case gin.MIMEMultipartPOSTForm:
+		file, err := ctx.FormFile("file")
+		if err != nil {
+			return nil, customError.Validation(
+				customError.CodeInvalidInput,
+				fmt.Sprintf("failed to get CSV file, err: %v", err),
+			)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, customError.Validation(
+				customError.CodeInvalidInput,
+				fmt.Sprintf("failed to open CSV file, err: %v", err),
+			)
+		}
+		defer reader.Close()
+		return readCSV(reader)
+	default:
+		return nil, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("content type %s is not supported, use JSON or CSV", ctx.ContentType()),
+		)
+	}
+}
+
+// readCSV reads rows of a CSV with a header, a row with invalid cells has an error instead of failing all rows
+func readCSV(r io.Reader) ([]bulkRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, customError.Validation(customError.CodeInvalidInput, fmt.Sprintf("failed to read CSV header, err: %v", err))
+	}
+
+	// columns are found by names, a header exported by a spreadsheet may start with a byte order mark
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !contains(csvColumns, name) {
+			return nil, customError.Validation(
+				customError.CodeInvalidInput,
+				fmt.Sprintf("unknown CSV column %q, columns are: %s", name, strings.Join(csvColumns, ", ")),
+			)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, customError.Validation(customError.CodeInvalidInput, "CSV header has no url column")
+	}
+
+	var rows []bulkRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, bulkRow{err: customError.Validation(
+				customError.CodeInvalidInput,
+				fmt.Sprintf("failed to read CSV row, err: %v", err),
+			)})
+			continue
+		}
+		if err != nil {
+			return nil, customError.Validation(customError.CodeInvalidInput, fmt.Sprintf("failed to read CSV, err: %v", err))
+		}
+		if len(rows) >= MaxBulkRows {
+			// one more row is kept so that too many rows are rejected
+			return append(rows, bulkRow{}), nil
+		}
+		rows = append(rows, csvRow(record, columns, len(header)))
+	}
+}
+
+// csvRow converts cells of a CSV record to a shorten input
+func csvRow(record []string, columns map[string]int, width int) bulkRow {
+	if len(record) > width {
+		return bulkRow{err: customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("row has %d cells but the header has %d columns", len(record), width),
+		)}
+	}
+	cell := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	input := model.ShortenInput{
+		Url:    cell("url"),
+		Expiry: cell("expiry"),
+		Alias:  cell("alias"),
+		Domain: cell("domain"),
+		Folder: cell("folder"),
+	}
+	if dedupe := cell("dedupe"); dedupe != "" {
+		value, err := strconv.ParseBool(dedupe)
+		if err != nil {
+			return bulkRow{err: customError.Validation(
+				customError.CodeInvalidInput,
+				fmt.Sprintf("dedupe must be true or false, got %q", dedupe),
+			)}
+		}
+		input.Dedupe = &value
+	}
+	for _, tag := range strings.Split(cell("tags"), ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			input.Tags = append(input.Tags, tag)
+		}
+	}
+	return bulkRow{input: input}
+}
+
+// rowError converts an error of a row to a body of error responses
+func rowError(err error) *customError.Response {
+	cerr := clientError(err)
+	return &customError.Response{Code: cerr.Code, Message: cerr.Message}
+}
+
+// contains reports whether a list has a value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
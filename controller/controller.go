@@ -1,48 +1,127 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/skip2/go-qrcode"
+	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
+	"url-shortener/auth"
 	"url-shortener/customError"
+	"url-shortener/domain"
 	"url-shortener/model"
 	"url-shortener/service"
+	"url-shortener/tenant"
 	"url-shortener/validate"
 )
 
-// Set fixed admin token
-const adminToken = "@dmIn"
+// key of an authenticated auth.Principal in a gin context
+const principalKey = "principal"
+
+// size in pixels of QR code images
+const qrCodeSize = 256
+
+// routeRoles are minimum roles of routes behind Authorize by `{method} {path}`.
+// Routes which aren't listed are denied, so a new route can't be exposed by mistake.
+// Callers other than admins can only manage short codes they own, and only admins can delete or purge short codes.
+var routeRoles = map[string]auth.Role{
+	"POST /shorten/bulk":                      auth.RoleEditor,
+	"GET /admin/urls":                         auth.RoleViewer,
+	"POST /admin/urls/bulk":                   auth.RoleEditor,
+	"DELETE /admin/urls/:shortCode":           auth.RoleAdmin,
+	"PATCH /admin/urls/:shortCode":            auth.RoleEditor,
+	"GET /admin/urls/deleted":                 auth.RoleViewer,
+	"POST /admin/urls/:shortCode/restore":     auth.RoleEditor,
+	"POST /admin/urls/:shortCode/purge":       auth.RoleAdmin,
+	"POST /admin/urls/:shortCode/tags":        auth.RoleEditor,
+	"DELETE /admin/urls/:shortCode/tags/:tag": auth.RoleEditor,
+	"GET /admin/tags":                         auth.RoleViewer,
+	"DELETE /:shortCode":                      auth.RoleAdmin,
+	"POST /admin/keys":                        auth.RoleAdmin,
+	"GET /admin/keys":                         auth.RoleAdmin,
+	"DELETE /admin/keys/:id":                  auth.RoleAdmin,
+	"POST /admin/keys/:id/rotate":             auth.RoleAdmin,
+	"GET /admin/debug/vars":                   auth.RoleAdmin,
+}
 
 // Controller is an interface for APIs
 type Controller interface {
 	Shorten(ctx *gin.Context)
+	ShortenBulk(ctx *gin.Context)
 	Redirect(ctx *gin.Context)
 	GetUrls(ctx *gin.Context)
 	DeleteUrl(ctx *gin.Context)
+	UpdateUrl(ctx *gin.Context)
+	BulkUpdateUrls(ctx *gin.Context)
+	GetDeletedUrls(ctx *gin.Context)
+	RestoreUrl(ctx *gin.Context)
+	PurgeUrl(ctx *gin.Context)
+	AddTags(ctx *gin.Context)
+	RemoveTag(ctx *gin.Context)
+	GetTags(ctx *gin.Context)
+	QRCode(ctx *gin.Context)
+	Preview(ctx *gin.Context)
+	Domain(ctx *gin.Context)
+	Identify(ctx *gin.Context)
+	Authenticate(ctx *gin.Context)
+	Authorize(ctx *gin.Context)
+	CreateAPIKey(ctx *gin.Context)
+	GetAPIKeys(ctx *gin.Context)
+	RevokeAPIKey(ctx *gin.Context)
+	RotateAPIKey(ctx *gin.Context)
+}
+
+// Config is a configuration of controller
+type Config struct {
+	// PublicBaseURL is a base of short urls like `https://sho.rt`,
+	// it is built from a scheme and a host of each request if empty
+	PublicBaseURL string
+
+	// ProblemJSON responds errors in RFC 7807 problem+json format,
+	// otherwise it is only used when a request accepts `application/problem+json`
+	ProblemJSON bool
+
+	// Authenticator verifies credentials of admin APIs, every admin request is rejected if nil
+	Authenticator auth.Authenticator
+
+	// Tenants are configured tenants with their blacklists, only the default tenant exists if nil
+	Tenants tenant.Registry
+
+	// Domains are short domains other than the default one which are served by a request host
+	Domains domain.List
 }
 
 // controller is an APIs management
 type controller struct {
 	service service.Service
+	keys    auth.KeyStore
+	config  Config
 }
 
 // New is a constructor of controller
-func New(service service.Service) Controller {
+func New(service service.Service, keys auth.KeyStore, config Config) Controller {
 	return &controller{
 		service,
+		keys,
+		config,
 	}
 }
 
 // Shorten godoc
 // @Summary Shorten a specified url
-// @Description shorten a specified url
+// @Description shorten a specified url, it is owned by a caller if credentials are sent.
+// @Description A short url is in a domain of the input or a request host.
 // @Accept  json
 // @Produce  json
 // @Param ShortenInput body model.ShortenInput true "Input for shortening data"
-// @Success 200 {object} model.Response
-// @Failure 400,404 {object} customError.ValidationError
+// @Success 200 {object} model.Response{data=model.ShortenOutput}
+// @Failure 400,401,409,503 {object} customError.Response
 // @Router /shorten [post]
 func (c *controller) Shorten(ctx *gin.Context) {
 	// Receive input
@@ -50,88 +129,177 @@ func (c *controller) Shorten(ctx *gin.Context) {
 
 	// Bind response body to input
 	if err := ctx.ShouldBindJSON(&input); err != nil {
-		ctx.JSON(http.StatusOK, customError.ValidationError{
-			Code:    1,
-			Message: fmt.Sprintf("failed to handle input, err: %v", err),
-		})
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		))
 		return
 	}
 
-	// Validate url
-	uri, err := url.ParseRequestURI(input.Url)
+	request, err := c.parseShortenInput(ctx, input)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, customError.ValidationError{
-			Code:    1,
-			Message: fmt.Sprintf("failed to handle url input, err: %v", err),
-		})
+		c.respondError(ctx, err)
 		return
 	}
 
-	// Check a url whether it is in blacklist
-	err = validate.CheckBlackList(uri.String())
+	// call encode function
+	object, err := c.service.Encode(
+		domain.NewContext(ctx.Request.Context(), request.Domain),
+		request.FullURL,
+		request.Options,
+	)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, customError.ValidationError{
-			Code:    1,
-			Message: fmt.Sprintf("failed to handle url input, err: %v", err),
-		})
+		c.respondError(ctx, err)
 		return
 	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    c.output(ctx, object),
+	})
+}
+
+// parseShortenInput validates a shorten input and converts it to a request of a short code owned by a caller
+func (c *controller) parseShortenInput(ctx *gin.Context, input model.ShortenInput) (*model.EncodeRequest, error) {
+	if input.Url == "" {
+		return nil, customError.Validation(customError.CodeInvalidInput, "url is required")
+	}
+
+	// Validate url
+	fullUrl, err := c.parseUrl(ctx, input.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	// a short url is created in a domain of a request host unless a configured domain is specified
+	name := domain.FromContext(ctx.Request.Context())
+	if input.Domain != "" {
+		name = domain.Normalize(input.Domain)
+		if !c.config.Domains.Contains(name) {
+			return nil, customError.Validation(
+				customError.CodeInvalidDomain,
+				fmt.Sprintf("domain %s is not allowed", input.Domain),
+			)
+		}
+	}
+
+	// Validate alias if specified
+	var pointerToAlias *string
+	if input.Alias != "" {
+		err = validate.CheckAlias(input.Alias)
+		if err != nil {
+			return nil, customError.Validation(
+				customError.CodeInvalidAlias,
+				fmt.Sprintf("failed to handle alias input, err: %v", err),
+			)
+		}
+		alias := input.Alias
+		pointerToAlias = &alias
+	}
+
+	tags, err := parseTags(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if input.Folder != "" {
+		if err = parseFolder(input.Folder); err != nil {
+			return nil, err
+		}
+	}
 
 	// Convert expiry to time type
 	var pointerToExpiry *time.Time
 	if input.Expiry != "" {
 		expiry, err := time.Parse(time.RFC3339, input.Expiry)
 		if err != nil {
-			ctx.JSON(http.StatusOK, customError.ValidationError{
-				Code:    1,
-				Message: fmt.Sprintf("failed to parse expiry, err: %v", err),
-			})
-			return
+			return nil, customError.Validation(
+				customError.CodeInvalidExpiry,
+				fmt.Sprintf("failed to parse expiry, err: %v", err),
+			)
 		}
 		pointerToExpiry = &expiry
 	}
 
-	// call encode function
-	shortCode, err := c.service.Encode(ctx, uri.String(), pointerToExpiry)
+	// a short code is owned by an authenticated caller
+	var owner string
+	if principal := principalOf(ctx); principal != nil {
+		owner = principal.Subject
+	}
+
+	return &model.EncodeRequest{
+		FullURL: fullUrl,
+		Domain:  name,
+		Options: model.EncodeOptions{
+			Expiry: pointerToExpiry,
+			Alias:  pointerToAlias,
+			Dedupe: input.Dedupe,
+			Owner:  owner,
+			Tags:   tags,
+			Folder: input.Folder,
+		},
+	}, nil
+}
+
+// parseUrl validates a full url input and returns it if it isn't in the global blacklist
+// or a blacklist of a tenant of a caller
+func (c *controller) parseUrl(ctx *gin.Context, input string) (string, error) {
+	uri, err := url.ParseRequestURI(input)
 	if err != nil {
-		ctx.JSON(http.StatusOK, customError.InternalError{
-			Code:    2,
-			Message: err.Error(),
-		})
-		return
+		return "", customError.Validation(
+			customError.CodeInvalidUrl,
+			fmt.Sprintf("failed to handle url input, err: %v", err),
+		)
 	}
-	ctx.JSON(http.StatusOK, &model.Response{
-		Code:    0,
-		Message: "success",
-		Data:    shortCode,
-	})
+
+	tenantID, _ := tenant.FromContext(ctx.Request.Context())
+	err = validate.CheckBlackList(uri.String(), c.config.Tenants.Get(tenantID).Blacklist...)
+	if err != nil {
+		return "", customError.Validation(
+			customError.CodeBlacklistedUrl,
+			fmt.Sprintf("failed to handle url input, err: %v", err),
+		)
+	}
+	return uri.String(), nil
+}
+
+// parseTags validates and normalizes tag inputs
+func parseTags(input []string) ([]string, error) {
+	tags, err := validate.NormalizeTags(input)
+	if err != nil {
+		return nil, customError.Validation(
+			customError.CodeInvalidTag,
+			fmt.Sprintf("failed to handle tags input, err: %v", err),
+		)
+	}
+	return tags, nil
+}
+
+// parseFolder validates a folder input
+func parseFolder(input string) error {
+	if err := validate.CheckFolder(input); err != nil {
+		return customError.Validation(
+			customError.CodeInvalidFolder,
+			fmt.Sprintf("failed to handle folder input, err: %v", err),
+		)
+	}
+	return nil
 }
 
 // Redirect godoc
 // @summary Redirect to full url
-// @description Redirect to full url using short code
+// @description Redirect to full url using short code in a domain of a request host
 // @produce json
 // @Param shortCode path string true "Short Code"
 // @Success 302 {object} model.Response
-// @Failure 404 {object} customError.InternalError
+// @Failure 404,410,503 {object} customError.Response
 // @router /{shortCode} [get]
 func (c *controller) Redirect(ctx *gin.Context) {
 	// Receive input
 	shortCode := ctx.Param("shortCode")
 
-	fullUrl, err := c.service.Decode(ctx, shortCode)
+	fullUrl, err := c.service.Decode(ctx.Request.Context(), shortCode)
 	if err != nil {
-		if ierr, ok := err.(*customError.InternalError); ok {
-			ctx.JSON(ierr.HTTPStatusCode, customError.InternalError{
-				Code:    2,
-				Message: err.Error(),
-			})
-			return
-		}
-		ctx.JSON(http.StatusNotFound, customError.InternalError{
-			Code:    2,
-			Message: fmt.Sprintf("internal error, err: %v", err),
-		})
+		c.respondError(ctx, err)
 		return
 	}
 	ctx.Redirect(http.StatusFound, fullUrl)
@@ -139,33 +307,88 @@ func (c *controller) Redirect(ctx *gin.Context) {
 
 // GetUrls godoc
 // @summary Get all url for admin
-// @description Get all url saved in database and can be filtered with a short code and a full url
+// @description Get all url saved in database and can be filtered with a short code, a full url, an owner, a domain,
+// @description a range of hits and windows of expiry and creation time.
+// @description A short code and a full url contain a query by default, or match it exactly, by a prefix or by a regex.
+// @description Callers other than admins only get their own short codes.
+// @description Url objects are listed in pages, pass nextCursor of a page as a cursor to get the next page.
+// @description A page has a total of matched url objects, a filtered total is approximate if there're too many to scan.
 // @produce json
-// @Param token header string true "Admin token -> enter `@dmIn`"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param shortCode query string false "Short Code"
+// @Param shortCodeMatch query string false "Match mode of a short code" Enums(contains, exact, prefix, regex)
 // @Param fullUrl query string false "Full URL"
+// @Param fullUrlMatch query string false "Match mode of a full URL" Enums(contains, exact, prefix, regex)
+// @Param tag query string false "Tag"
+// @Param folder query string false "Folder, short codes in its subfolders are also listed"
+// @Param minHits query int false "Minimum hits"
+// @Param maxHits query int false "Maximum hits"
+// @Param expiresBefore query string false "Expires before a RFC3339 time, short codes without an expiry don't match"
+// @Param expiresAfter query string false "Expires after a RFC3339 time, short codes without an expiry match"
+// @Param createdAfter query string false "Created after a RFC3339 time"
+// @Param createdBefore query string false "Created before a RFC3339 time"
+// @Param owner query string false "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, empty for the default domain"
+// @Param cursor query string false "Next cursor of a previous page"
+// @Param limit query int false "Page size, 50 by default and at most 500"
+// @Param sort query string false "Sort field" Enums(shortCode, hits, expiry, createdAt)
+// @Param order query string false "Sort order" Enums(asc, desc)
 // @Success 200 {object} model.Response
-// @Failure 400 {object} customError.InternalError
+// @Failure 400,401,403,503 {object} customError.Response
 // @router /admin/urls [get]
 func (c *controller) GetUrls(ctx *gin.Context) {
-	// Receive input
-	h := model.Header{}
-	if err := ctx.ShouldBindHeader(&h); err != nil {
-		ctx.JSON(http.StatusForbidden, customError.InternalError{
-			Code:    2,
-			Message: fmt.Sprintf("failed to access this api"),
-		})
+	// receive query params of a page
+	var page model.PageInput
+	if err := ctx.ShouldBindQuery(&page); err != nil {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		))
+		return
+	}
+	query, err := c.urlQuery(ctx)
+	if err != nil {
+		c.respondError(ctx, err)
 		return
 	}
+	query.Sort = page.Sort
+	query.Desc = page.Order == "desc"
+	query.Cursor = page.Cursor
+	query.Limit = page.Limit
 
-	// check admin token whether it is valid
-	if h.Token != adminToken {
-		ctx.JSON(http.StatusForbidden, customError.InternalError{
-			Code:    2,
-			Message: fmt.Sprintf("failed to access this api"),
-		})
+	// call get url objects
+	urlObjects, pageInfo, err := c.service.GetUrlObjects(ctx.Request.Context(), query)
+	if err != nil {
+		c.respondError(ctx, err)
 		return
 	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    urlObjects,
+		Page:    pageInfo,
+	})
+}
+
+// urlQuery returns a query of url objects matching query params of filters without a page.
+// Callers other than admins only match their own short codes.
+func (c *controller) urlQuery(ctx *gin.Context) (model.UrlQuery, error) {
+	// receive query params of filters
+	var search model.SearchInput
+	if err := ctx.ShouldBindQuery(&search); err != nil {
+		return model.UrlQuery{}, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		)
+	}
+
+	// tags are matched in lowercase
+	if search.Tag != nil {
+		tag := strings.ToLower(*search.Tag)
+		search.Tag = &tag
+	}
 
 	// receive query params for short code and full url
 	shortCode := ctx.Query("shortCode")
@@ -181,65 +404,882 @@ func (c *controller) GetUrls(ctx *gin.Context) {
 		pointerToFullUrl = &fullUrl
 	}
 
-	// call get url objects
-	urlObjects, err := c.service.GetUrlObjects(ctx, pointerToShortCode, pointerToFullUrl)
+	// only admins can see short codes of other owners
+	var pointerToOwner *string
+	principal := principalOf(ctx)
+	if principal == nil {
+		return model.UrlQuery{}, customError.Unauthorized("missing credentials")
+	}
+	if !principal.HasRole(auth.RoleAdmin) {
+		pointerToOwner = &principal.Subject
+	} else if owner, ok := ctx.GetQuery("owner"); ok {
+		pointerToOwner = &owner
+	}
+
+	// short codes of all domains are listed unless a domain is specified
+	var pointerToDomain *string
+	if _, ok := ctx.GetQuery("domain"); ok {
+		name := domain.FromContext(ctx.Request.Context())
+		pointerToDomain = &name
+	}
+
+	return model.UrlQuery{
+		ShortCode:      pointerToShortCode,
+		ShortCodeMatch: search.ShortCodeMatch,
+		FullURL:        pointerToFullUrl,
+		FullURLMatch:   search.FullURLMatch,
+		Owner:          pointerToOwner,
+		Domain:         pointerToDomain,
+		Tag:            search.Tag,
+		Folder:         search.Folder,
+		MinHits:        search.MinHits,
+		MaxHits:        search.MaxHits,
+		ExpiresBefore:  search.ExpiresBefore,
+		ExpiresAfter:   search.ExpiresAfter,
+		CreatedAfter:   search.CreatedAfter,
+		CreatedBefore:  search.CreatedBefore,
+	}, nil
+}
+
+// DeleteUrl godoc
+// @summary Delete a short code
+// @description Delete a short code, it can be restored until it is purged and it is never reused before that.
+// @description Only admins can delete short codes.
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param shortCode path string true "Short Code"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, a domain of a request host by default"
+// @Success 200 {object} model.Response
+// @Failure 400,401,403,404,410,503 {object} customError.Response
+// @router /admin/urls/{shortCode} [delete]
+func (c *controller) DeleteUrl(ctx *gin.Context) {
+	shortCode := ctx.Param("shortCode")
+
+	if err := c.checkOwner(ctx, shortCode); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	// call delete url, a caller is kept in a deleted url object
+	_, err := c.service.DeleteUrl(ctx.Request.Context(), shortCode, principalOf(ctx).Subject)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, customError.InternalError{
-			Code:    2,
-			Message: fmt.Sprintf("internal error, err: %v", err),
-		})
+		c.respondError(ctx, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, &model.Response{
-		Code:    0,
+		Code:    model.CodeOK,
+		Message: "success",
+	})
+}
+
+// GetDeletedUrls godoc
+// @summary Get deleted urls
+// @description Get deleted short codes which can be restored with their deletion time and actor.
+// @description Callers other than admins only get their own short codes.
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param owner query string false "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, empty for the default domain"
+// @Success 200 {object} model.Response{data=[]model.UrlObject}
+// @Failure 400,401,403,503 {object} customError.Response
+// @router /admin/urls/deleted [get]
+func (c *controller) GetDeletedUrls(ctx *gin.Context) {
+	principal := principalOf(ctx)
+	if principal == nil {
+		c.respondError(ctx, customError.Unauthorized("missing credentials"))
+		return
+	}
+
+	// only admins can see short codes of other owners
+	var pointerToOwner *string
+	if !principal.HasRole(auth.RoleAdmin) {
+		pointerToOwner = &principal.Subject
+	} else if owner, ok := ctx.GetQuery("owner"); ok {
+		pointerToOwner = &owner
+	}
+
+	// short codes of all domains are listed unless a domain is specified
+	var pointerToDomain *string
+	if _, ok := ctx.GetQuery("domain"); ok {
+		name := domain.FromContext(ctx.Request.Context())
+		pointerToDomain = &name
+	}
+
+	urlObjects, err := c.service.GetDeletedUrls(ctx.Request.Context(), pointerToOwner, pointerToDomain)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
 		Message: "success",
 		Data:    urlObjects,
 	})
 }
 
-// GetUrls godoc
-// @summary Get all url for admin
-// @description Get all url saved in database and can be filtered with a short code and a full url
+// RestoreUrl godoc
+// @summary Restore a deleted short code
+// @description Restore a deleted short code with its hits within a retention period.
+// @description Callers other than admins can only restore their own short codes.
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param shortCode path string true "Short Code"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, a domain of a request host by default"
+// @Success 200 {object} model.Response{data=model.UrlObject}
+// @Failure 400,401,403,404,409,410,503 {object} customError.Response
+// @router /admin/urls/{shortCode}/restore [post]
+func (c *controller) RestoreUrl(ctx *gin.Context) {
+	shortCode := ctx.Param("shortCode")
+
+	if err := c.checkOwnerOf(ctx, shortCode, c.service.GetDeletedUrl); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	object, err := c.service.RestoreUrl(ctx.Request.Context(), shortCode)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    object,
+	})
+}
+
+// PurgeUrl godoc
+// @summary Purge a deleted short code
+// @description Permanently remove a deleted short code, it can't be restored and can be reused after that
 // @produce json
-// @Param token header string true "Admin token -> enter `@dmIn`"
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Param shortCode path string true "Short Code"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, a domain of a request host by default"
 // @Success 200 {object} model.Response
-// @Failure 403 {object} customError.InternalError
-// @Failure 404 {object} customError.InternalError
-// @router /{shortCode} [delete]
-func (c *controller) DeleteUrl(ctx *gin.Context) {
+// @Failure 400,401,403,404,503 {object} customError.Response
+// @router /admin/urls/{shortCode}/purge [post]
+func (c *controller) PurgeUrl(ctx *gin.Context) {
+	err := c.service.PurgeUrl(ctx.Request.Context(), ctx.Param("shortCode"))
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+	})
+}
+
+// UpdateUrl godoc
+// @summary Update a short code
+// @description Update a full url, an expiry and a folder of a short code, its hits are kept. Fields which aren't specified
+// @description are unchanged, an empty expiry removes an expiry and an empty folder removes a short code from its folder.
+// @description Callers other than admins can only update their own short codes.
+// @accept json
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param shortCode path string true "Short Code"
+// @Param UpdateInput body model.UpdateInput true "Input for updating a short code"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, a domain of a request host by default"
+// @Success 200 {object} model.Response{data=model.UrlObject}
+// @Failure 400,401,403,404,410,503 {object} customError.Response
+// @router /admin/urls/{shortCode} [patch]
+func (c *controller) UpdateUrl(ctx *gin.Context) {
+	shortCode := ctx.Param("shortCode")
+
+	var input model.UpdateInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		))
+		return
+	}
+	if input.Url == nil && input.Expiry == nil && input.Folder == nil {
+		c.respondError(ctx, customError.Validation(customError.CodeInvalidInput, "nothing to update"))
+		return
+	}
+
+	// a new full url is validated in the same way as Shorten
+	var options model.UpdateOptions
+	if input.Url != nil {
+		fullUrl, err := c.parseUrl(ctx, *input.Url)
+		if err != nil {
+			c.respondError(ctx, err)
+			return
+		}
+		options.FullURL = &fullUrl
+	}
+
+	// an empty expiry removes an expiry
+	if input.Expiry != nil {
+		expiry := time.Time{}
+		if *input.Expiry != "" {
+			var err error
+			expiry, err = time.Parse(time.RFC3339, *input.Expiry)
+			if err != nil {
+				c.respondError(ctx, customError.Validation(
+					customError.CodeInvalidExpiry,
+					fmt.Sprintf("failed to parse expiry, err: %v", err),
+				))
+				return
+			}
+		}
+		options.Expiry = &expiry
+	}
+
+	// an empty folder removes a short code from its folder
+	if input.Folder != nil {
+		if *input.Folder != "" {
+			if err := parseFolder(*input.Folder); err != nil {
+				c.respondError(ctx, err)
+				return
+			}
+		}
+		options.Folder = input.Folder
+	}
+
+	if err := c.checkOwner(ctx, shortCode); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	object, err := c.service.Update(ctx.Request.Context(), shortCode, options)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    object,
+	})
+}
+
+// AddTags godoc
+// @summary Add tags to a short code
+// @description Add lowercase tags to a short code, a short code has at most 20 tags.
+// @description Callers other than admins can only tag their own short codes.
+// @accept json
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param shortCode path string true "Short Code"
+// @Param TagsInput body model.TagsInput true "Tags to add"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, a domain of a request host by default"
+// @Success 200 {object} model.Response{data=model.UrlObject}
+// @Failure 400,401,403,404,410,503 {object} customError.Response
+// @router /admin/urls/{shortCode}/tags [post]
+func (c *controller) AddTags(ctx *gin.Context) {
+	shortCode := ctx.Param("shortCode")
+
+	var input model.TagsInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		))
+		return
+	}
+	tags, err := parseTags(input.Tags)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	c.updateTags(ctx, shortCode, model.UpdateOptions{AddTags: tags})
+}
+
+// RemoveTag godoc
+// @summary Remove a tag from a short code
+// @description Remove a tag from a short code, callers other than admins can only untag their own short codes.
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param shortCode path string true "Short Code"
+// @Param tag path string true "Tag"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, a domain of a request host by default"
+// @Success 200 {object} model.Response{data=model.UrlObject}
+// @Failure 400,401,403,404,410,503 {object} customError.Response
+// @router /admin/urls/{shortCode}/tags/{tag} [delete]
+func (c *controller) RemoveTag(ctx *gin.Context) {
+	shortCode := ctx.Param("shortCode")
+
+	tags, err := parseTags([]string{ctx.Param("tag")})
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	c.updateTags(ctx, shortCode, model.UpdateOptions{RemoveTags: tags})
+}
+
+// updateTags updates tags of a short code owned by a caller and responds its url object
+func (c *controller) updateTags(ctx *gin.Context, shortCode string, options model.UpdateOptions) {
+	if err := c.checkOwner(ctx, shortCode); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	object, err := c.service.Update(ctx.Request.Context(), shortCode, options)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    object,
+	})
+}
+
+// GetTags godoc
+// @summary Get tags
+// @description Get tags with the number of their short codes and the sum of their hits.
+// @description Callers other than admins only count their own short codes.
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param owner query string false "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins"
+// @Param tenant query string false "Tenant id, only for super admins"
+// @Param domain query string false "Short domain, empty for the default domain"
+// @Success 200 {object} model.Response{data=[]model.TagStats}
+// @Failure 400,401,403,503 {object} customError.Response
+// @router /admin/tags [get]
+func (c *controller) GetTags(ctx *gin.Context) {
+	principal := principalOf(ctx)
+	if principal == nil {
+		c.respondError(ctx, customError.Unauthorized("missing credentials"))
+		return
+	}
+
+	// only admins can count short codes of other owners
+	var pointerToOwner *string
+	if !principal.HasRole(auth.RoleAdmin) {
+		pointerToOwner = &principal.Subject
+	} else if owner, ok := ctx.GetQuery("owner"); ok {
+		pointerToOwner = &owner
+	}
+
+	// short codes of all domains are counted unless a domain is specified
+	var pointerToDomain *string
+	if _, ok := ctx.GetQuery("domain"); ok {
+		name := domain.FromContext(ctx.Request.Context())
+		pointerToDomain = &name
+	}
+
+	tagStats, err := c.service.GetTagStats(ctx.Request.Context(), pointerToOwner, pointerToDomain)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    tagStats,
+	})
+}
+
+// QRCode godoc
+// @summary Get a QR code of short url
+// @description Get a PNG image of a QR code encoding a short url
+// @produce png
+// @Param shortCode path string true "Short Code"
+// @Success 200 {file} binary
+// @Failure 404,410,503 {object} customError.Response
+// @router /{shortCode}/qr [get]
+func (c *controller) QRCode(ctx *gin.Context) {
 	// Receive input
-	h := model.Header{}
-	if err := ctx.ShouldBindHeader(&h); err != nil {
-		ctx.JSON(http.StatusForbidden, customError.InternalError{
-			Code:    2,
-			Message: fmt.Sprintf("failed to access this api"),
-		})
+	shortCode := ctx.Param("shortCode")
+
+	// a QR code is only served for an existing short code
+	object, err := c.service.GetUrlObject(ctx.Request.Context(), shortCode)
+	if err != nil {
+		c.respondError(ctx, err)
 		return
 	}
 
-	// check admin token whether it is valid
-	if h.Token != adminToken {
-		ctx.JSON(http.StatusForbidden, customError.InternalError{
-			Code:    2,
-			Message: fmt.Sprintf("failed to access this api"),
-		})
+	png, err := qrcode.Encode(c.output(ctx, object).ShortURL, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		c.respondError(ctx, customError.Internal(customError.CodeInternal, "failed to encode qr code", err))
 		return
 	}
+	ctx.Data(http.StatusOK, "image/png", png)
+}
 
+// Preview godoc
+// @summary Preview a short url
+// @description Get a full url of a short code without redirecting and counting a hit
+// @produce json
+// @Param shortCode path string true "Short Code"
+// @Success 200 {object} model.Response{data=model.ShortenOutput}
+// @Failure 404,410,503 {object} customError.Response
+// @router /{shortCode}/preview [get]
+func (c *controller) Preview(ctx *gin.Context) {
+	// Receive input
 	shortCode := ctx.Param("shortCode")
 
-	// call delete url
-	_, err := c.service.DeleteUrl(ctx, shortCode)
+	object, err := c.service.GetUrlObject(ctx.Request.Context(), shortCode)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    c.output(ctx, object),
+	})
+}
+
+// output builds a response of an url object with absolute links
+func (c *controller) output(ctx *gin.Context, object *model.UrlObject) *model.ShortenOutput {
+	shortUrl := fmt.Sprintf("%s/%s", c.baseURL(ctx, object.Domain), url.PathEscape(object.ShortCode))
+	return &model.ShortenOutput{
+		Version:    model.ShortenOutputVersion,
+		ShortCode:  object.ShortCode,
+		ShortURL:   shortUrl,
+		FullURL:    service.NormalizeUrl(object.FullURL),
+		Expiry:     object.Expiry,
+		CreatedAt:  object.CreatedAt,
+		QRCodeURL:  shortUrl + "/qr",
+		PreviewURL: shortUrl + "/preview",
+		Tags:       object.Tags,
+		Folder:     object.Folder,
+	}
+}
+
+// baseURL returns a public base url of short urls in a short domain without a trailing slash
+func (c *controller) baseURL(ctx *gin.Context, name string) string {
+	if c.config.PublicBaseURL != "" {
+		base := strings.TrimRight(c.config.PublicBaseURL, "/")
+		if name == domain.Default {
+			return base
+		}
+		// other domains are served in the same scheme as the public base url
+		if uri, err := url.Parse(base); err == nil && uri.Scheme != "" {
+			return fmt.Sprintf("%s://%s", uri.Scheme, name)
+		}
+	}
+
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := ctx.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	if name == domain.Default {
+		name = ctx.Request.Host
+	}
+	return fmt.Sprintf("%s://%s", scheme, name)
+}
+
+// Domain is a middleware which saves a short domain of a request in a context.
+// A domain is selected by a `domain` query or a request host, unknown hosts are in the default domain.
+func (c *controller) Domain(ctx *gin.Context) {
+	name := c.config.Domains.Match(ctx.Request.Host)
+	if query, ok := ctx.GetQuery("domain"); ok {
+		name = domain.Normalize(query)
+		if !c.config.Domains.Contains(name) {
+			c.respondError(ctx, customError.Validation(
+				customError.CodeInvalidDomain,
+				fmt.Sprintf("domain %s is not allowed", query),
+			))
+			ctx.Abort()
+			return
+		}
+	}
+
+	ctx.Request = ctx.Request.WithContext(domain.NewContext(ctx.Request.Context(), name))
+	ctx.Next()
+}
+
+// Identify is a middleware which saves a caller in a context if a request has credentials,
+// requests without credentials are anonymous but invalid credentials are rejected
+func (c *controller) Identify(ctx *gin.Context) {
+	if c.config.Authenticator == nil {
+		ctx.Next()
+		return
+	}
+
+	principal, err := c.config.Authenticator.Authenticate(ctx.Request)
+	if errors.Is(err, auth.ErrNoCredentials) {
+		ctx.Next()
+		return
+	}
+	if err == nil {
+		err = c.scope(ctx, principal)
+	}
+	if err != nil {
+		c.respondError(ctx, err)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Set(principalKey, principal)
+	ctx.Next()
+}
+
+// Authenticate is a middleware which rejects requests without valid credentials
+// and saves an authenticated caller in a context
+func (c *controller) Authenticate(ctx *gin.Context) {
+	if c.config.Authenticator == nil {
+		c.respondError(ctx, customError.Unauthorized("authentication is not configured"))
+		ctx.Abort()
+		return
+	}
+
+	principal, err := c.config.Authenticator.Authenticate(ctx.Request)
+	if errors.Is(err, auth.ErrNoCredentials) {
+		err = customError.Unauthorized("missing credentials")
+	}
+	if err == nil {
+		err = c.scope(ctx, principal)
+	}
+	if err != nil {
+		c.respondError(ctx, err)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Set(principalKey, principal)
+	ctx.Next()
+}
+
+// scope scopes a request to a tenant of a caller so that services only see data of the tenant.
+// Super admins see all tenants unless they ask for one by a `tenant` query.
+func (c *controller) scope(ctx *gin.Context, principal *auth.Principal) error {
+	id := principal.Tenant
+	if principal.HasRole(auth.RoleSuperAdmin) {
+		var ok bool
+		if id, ok = ctx.GetQuery("tenant"); !ok {
+			return nil
+		}
+	}
+	if err := c.checkTenant(id); err != nil {
+		return err
+	}
+
+	ctx.Request = ctx.Request.WithContext(tenant.NewContext(ctx.Request.Context(), id))
+	return nil
+}
+
+// checkTenant returns an error if a tenant isn't configured
+func (c *controller) checkTenant(id string) error {
+	if _, ok := c.config.Tenants[id]; !ok && id != tenant.Default {
+		return customError.NotFound(customError.CodeUnknownTenant, fmt.Sprintf("tenant %s is not configured", id))
+	}
+	return nil
+}
+
+// principalOf returns a caller saved by Identify or Authenticate, nil for anonymous requests
+func principalOf(ctx *gin.Context) *auth.Principal {
+	value, _ := ctx.Get(principalKey)
+	principal, _ := value.(*auth.Principal)
+	return principal
+}
+
+// checkOwner returns an error if a caller is neither an admin nor an owner of a short code
+func (c *controller) checkOwner(ctx *gin.Context, shortCode string) error {
+	return c.checkOwnerOf(ctx, shortCode, c.service.GetUrlObject)
+}
+
+// checkOwnerOf returns an error if a caller doesn't own a short code found by `get`
+func (c *controller) checkOwnerOf(
+	ctx *gin.Context,
+	shortCode string,
+	get func(ctx context.Context, shortCode string) (*model.UrlObject, error),
+) error {
+	principal := principalOf(ctx)
+	if principal == nil {
+		return customError.Unauthorized("missing credentials")
+	}
+	if principal.HasRole(auth.RoleAdmin) {
+		return nil
+	}
+
+	object, err := get(ctx.Request.Context(), shortCode)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, customError.InternalError{
-			Code:    2,
-			Message: err.Error(),
-		})
+		return err
+	}
+	if object.Owner != principal.Subject {
+		return customError.Forbidden(fmt.Sprintf(
+			"short code %s isn't owned by caller %s, only its owner or an admin can manage it",
+			shortCode, principal.Subject,
+		))
+	}
+	return nil
+}
+
+// Authorize is a middleware which rejects requests of callers without a role required by a route,
+// it must be used after Authenticate
+func (c *controller) Authorize(ctx *gin.Context) {
+	principal := principalOf(ctx)
+	if principal == nil {
+		c.respondError(ctx, customError.Unauthorized("missing credentials"))
+		ctx.Abort()
+		return
+	}
+
+	route := ctx.Request.Method + " " + ctx.FullPath()
+	required, ok := routeRoles[route]
+	if !ok {
+		c.respondError(ctx, customError.Forbidden(fmt.Sprintf("%s is not allowed for any role", route)))
+		ctx.Abort()
+		return
+	}
+	if !principal.HasRole(required) {
+		c.respondError(ctx, customError.Forbidden(fmt.Sprintf(
+			"role %s is required for %s, caller %s has roles: [%s]",
+			required, route, principal.Subject, strings.Join(principal.Roles, ", "),
+		)))
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
+
+// CreateAPIKey godoc
+// @summary Create an API key
+// @description Create an API key for admin APIs, its secret key is only returned once
+// @accept json
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param APIKeyInput body model.APIKeyInput true "Input for creating an API key"
+// @Success 201 {object} model.Response{data=model.APIKeyOutput}
+// @Failure 400,401,403,503 {object} customError.Response
+// @router /admin/keys [post]
+func (c *controller) CreateAPIKey(ctx *gin.Context) {
+	// Receive input
+	var input model.APIKeyInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		c.respondError(ctx, customError.Validation(
+			customError.CodeInvalidInput,
+			fmt.Sprintf("failed to handle input, err: %v", err),
+		))
+		return
+	}
+
+	// keys are given the least permissions by default
+	role := auth.RoleViewer
+	if input.Role != "" {
+		role = auth.Role(input.Role)
+	}
+
+	// a caller can't grant a role higher than its own or create keys of another tenant unless it's a super admin
+	principal := principalOf(ctx)
+	if principal == nil {
+		c.respondError(ctx, customError.Unauthorized("missing credentials"))
+		return
+	}
+	if !principal.HasRole(role) {
+		c.respondError(ctx, customError.Forbidden(fmt.Sprintf("caller %s can't grant role %s", principal.Subject, role)))
 		return
 	}
+	tenantID := principal.Tenant
+	if input.Tenant != nil && *input.Tenant != tenantID {
+		if !principal.HasRole(auth.RoleSuperAdmin) {
+			c.respondError(ctx, customError.Forbidden(fmt.Sprintf(
+				"caller %s can't create api keys of another tenant", principal.Subject,
+			)))
+			return
+		}
+		tenantID = *input.Tenant
+	}
+	if err := c.checkTenant(tenantID); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	key, secret, err := c.keys.Create(ctx, input.Name, role, tenantID)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    apiKeyOutput(key, secret),
+	})
+}
+
+// GetAPIKeys godoc
+// @summary Get all API keys
+// @description Get all API keys including revoked ones without their secret keys
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Success 200 {object} model.Response{data=[]model.APIKeyOutput}
+// @Failure 401,403,503 {object} customError.Response
+// @router /admin/keys [get]
+func (c *controller) GetAPIKeys(ctx *gin.Context) {
+	principal := principalOf(ctx)
+	if principal == nil {
+		c.respondError(ctx, customError.Unauthorized("missing credentials"))
+		return
+	}
+
+	keys, err := c.keys.List(ctx)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	// keys of other tenants are only listed for super admins
+	outputs := make([]*model.APIKeyOutput, 0, len(keys))
+	for _, key := range keys {
+		if key.Tenant == principal.Tenant || principal.HasRole(auth.RoleSuperAdmin) {
+			outputs = append(outputs, apiKeyOutput(key, ""))
+		}
+	}
 	ctx.JSON(http.StatusOK, &model.Response{
-		Code:    0,
+		Code:    model.CodeOK,
 		Message: "success",
+		Data:    outputs,
 	})
 }
+
+// RevokeAPIKey godoc
+// @summary Revoke an API key
+// @description Revoke an API key, it can't be used anymore
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path string true "API key id"
+// @Success 200 {object} model.Response
+// @Failure 401,403,404,503 {object} customError.Response
+// @router /admin/keys/{id} [delete]
+func (c *controller) RevokeAPIKey(ctx *gin.Context) {
+	if err := c.checkAPIKey(ctx, ctx.Param("id")); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	err := c.keys.Revoke(ctx, ctx.Param("id"))
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+	})
+}
+
+// RotateAPIKey godoc
+// @summary Rotate an API key
+// @description Replace a secret key of an API key, the old secret key stops working immediately
+// @produce json
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Param id path string true "API key id"
+// @Success 200 {object} model.Response{data=model.APIKeyOutput}
+// @Failure 401,403,404,410,503 {object} customError.Response
+// @router /admin/keys/{id}/rotate [post]
+func (c *controller) RotateAPIKey(ctx *gin.Context) {
+	if err := c.checkAPIKey(ctx, ctx.Param("id")); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	key, secret, err := c.keys.Rotate(ctx, ctx.Param("id"))
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.Response{
+		Code:    model.CodeOK,
+		Message: "success",
+		Data:    apiKeyOutput(key, secret),
+	})
+}
+
+// checkAPIKey returns an error if a caller can't manage an API key.
+// Keys of other tenants are hidden and keys of higher roles can't be managed.
+func (c *controller) checkAPIKey(ctx *gin.Context, id string) error {
+	principal := principalOf(ctx)
+	if principal == nil {
+		return customError.Unauthorized("missing credentials")
+	}
+	if principal.HasRole(auth.RoleSuperAdmin) {
+		return nil
+	}
+
+	key, err := c.keys.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.Tenant != principal.Tenant {
+		return customError.NotFound(customError.CodeAPIKeyNotFound, "this api key is not found")
+	}
+	if !principal.HasRole(key.EffectiveRole()) {
+		return customError.Forbidden(fmt.Sprintf("caller %s can't manage api keys of role %s", principal.Subject, key.EffectiveRole()))
+	}
+	return nil
+}
+
+// apiKeyOutput builds a response of an API key without its hash
+func apiKeyOutput(key *auth.APIKey, secret string) *model.APIKeyOutput {
+	return &model.APIKeyOutput{
+		ID:        key.ID,
+		Name:      key.Name,
+		Role:      string(key.EffectiveRole()),
+		Tenant:    key.Tenant,
+		Key:       secret,
+		CreatedAt: key.CreatedAt,
+		RotatedAt: key.RotatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+// respondError maps an error to its HTTP status code and responds it with a stable error code.
+// Errors which aren't customError.Error are unexpected and responded as internal errors.
+func (c *controller) respondError(ctx *gin.Context, err error) {
+	cerr := clientError(err)
+	status := cerr.Kind.HTTPStatusCode()
+
+	if c.config.ProblemJSON || strings.Contains(ctx.GetHeader("Accept"), "application/problem+json") {
+		// render.JSON keeps a content type which is already set
+		ctx.Header("Content-Type", "application/problem+json")
+		ctx.Render(status, render.JSON{Data: customError.Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(status),
+			Status: status,
+			Detail: cerr.Message,
+			Code:   cerr.Code,
+		}})
+		return
+	}
+
+	ctx.JSON(status, customError.Response{
+		Code:    cerr.Code,
+		Message: cerr.Message,
+	})
+}
+
+// clientError converts an error to a customError.Error whose message can be responded.
+// A cause of an error may have details of storage, so it is only logged.
+func clientError(err error) *customError.Error {
+	var cerr *customError.Error
+	if !errors.As(err, &cerr) {
+		cerr = customError.Internal(customError.CodeInternal, "internal error", err)
+	}
+	if cerr.Err != nil {
+		log.Printf("%s: %s, err: %v", cerr.Code, cerr.Message, cerr.Err)
+	}
+	return cerr
+}
@@ -2,17 +2,33 @@ package controller
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang/mock/gomock"
 	"gotest.tools/assert"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"url-shortener/auth"
+	"url-shortener/customError"
+	"url-shortener/domain"
 	"url-shortener/mock"
 	"url-shortener/model"
+	"url-shortener/repository"
+	"url-shortener/tenant"
 )
 
 func TestShortenRoute(t *testing.T) {
@@ -22,12 +38,17 @@ func TestShortenRoute(t *testing.T) {
 
 	c, router := gin.CreateTestContext(httptest.NewRecorder())
 	serv := mock.NewMockService(mockCtrl)
-	ctrl := New(serv)
+	ctrl := New(serv, nil, Config{})
 
 	output := "mockedShortCode"
+	mockedTime, _ := time.Parse(time.RFC3339, "2021-08-20T22:06:32+07:00")
 	serv.EXPECT().
-		Encode(gomock.Any(), "https://www.facebook.com", nil).
-		Return(output, nil)
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{}).
+		Return(&model.UrlObject{
+			ShortCode: output,
+			FullURL:   "https://www.facebook.com",
+			CreatedAt: &mockedTime,
+		}, nil)
 
 	router.POST("/shorten", ctrl.Shorten)
 
@@ -37,6 +58,80 @@ func TestShortenRoute(t *testing.T) {
 		"url": "https://www.facebook.com",
 	})
 	c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+	c.Request.Host = "sho.rt"
+	router.ServeHTTP(w, c.Request)
+
+	var resp model.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, model.CodeOK, resp.Code)
+	assert.DeepEqual(t, map[string]interface{}{
+		"version":    float64(model.ShortenOutputVersion),
+		"shortCode":  output,
+		"shortUrl":   "http://sho.rt/mockedShortCode",
+		"fullUrl":    "https://www.facebook.com/",
+		"createdAt":  "2021-08-20T22:06:32+07:00",
+		"qrCodeUrl":  "http://sho.rt/mockedShortCode/qr",
+		"previewUrl": "http://sho.rt/mockedShortCode/preview",
+	}, resp.Data)
+}
+func TestShortenRoute_Alias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	alias := "summer-sale"
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{Alias: &alias}).
+		Return(&model.UrlObject{ShortCode: alias, FullURL: "https://www.facebook.com"}, nil)
+
+	router.POST("/shorten", ctrl.Shorten)
+
+	w := httptest.NewRecorder()
+
+	jsonBytes, _ := json.Marshal(map[string]string{
+		"url":   "https://www.facebook.com",
+		"alias": alias,
+	})
+	c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+	router.ServeHTTP(w, c.Request)
+
+	var resp model.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, alias, resp.Data.(map[string]interface{})["shortCode"])
+}
+func TestShortenRoute_Dedupe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	dedupe := true
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{Dedupe: &dedupe}).
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://www.facebook.com"}, nil)
+
+	router.POST("/shorten", ctrl.Shorten)
+
+	w := httptest.NewRecorder()
+
+	jsonBytes, _ := json.Marshal(map[string]interface{}{
+		"url":    "https://www.facebook.com",
+		"dedupe": true,
+	})
+	c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
 	router.ServeHTTP(w, c.Request)
 
 	var resp model.Response
@@ -44,7 +139,224 @@ func TestShortenRoute(t *testing.T) {
 		t.Fatalf("failed to decode, err: %v", err)
 	}
 	assert.Equal(t, 200, w.Code)
-	assert.Equal(t, output, resp.Data)
+	assert.Equal(t, "abc", resp.Data.(map[string]interface{})["shortCode"])
+}
+
+func TestShortenRoute_Owner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), keys)})
+
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{Owner: "bootstrap"}).
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://www.facebook.com", Owner: "bootstrap"}, nil)
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{}).
+		Return(&model.UrlObject{ShortCode: "def", FullURL: "https://www.facebook.com"}, nil)
+
+	router.POST("/shorten", ctrl.Identify, ctrl.Shorten)
+
+	// an authenticated caller owns a short code, an anonymous one doesn't and wrong credentials are rejected
+	cases := map[string]int{
+		"secret": http.StatusOK,
+		"":       http.StatusOK,
+		"wrong":  http.StatusUnauthorized,
+	}
+	for key, status := range cases {
+		w := httptest.NewRecorder()
+		jsonBytes, _ := json.Marshal(map[string]interface{}{"url": "https://www.facebook.com"})
+		c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+		if key != "" {
+			c.Request.Header.Set(auth.APIKeyHeader, key)
+		}
+		router.ServeHTTP(w, c.Request)
+
+		assert.Equal(t, status, w.Code, "key: %s", key)
+	}
+}
+
+func TestShortenRoute_InvalidAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	router.POST("/shorten", ctrl.Shorten)
+
+	for _, alias := range []string{"admin", "a b", "x"} {
+		w := httptest.NewRecorder()
+
+		jsonBytes, _ := json.Marshal(map[string]string{
+			"url":   "https://www.facebook.com",
+			"alias": alias,
+		})
+		c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+		router.ServeHTTP(w, c.Request)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+func TestShortenRoute_AliasTaken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	alias := "summer-sale"
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{Alias: &alias}).
+		Return(nil, customError.Conflict(customError.CodeAliasTaken, "this alias is already taken"))
+
+	router.POST("/shorten", ctrl.Shorten)
+
+	w := httptest.NewRecorder()
+
+	jsonBytes, _ := json.Marshal(map[string]string{
+		"url":   "https://www.facebook.com",
+		"alias": alias,
+	})
+	c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+	router.ServeHTTP(w, c.Request)
+
+	var resp customError.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, customError.CodeAliasTaken, resp.Code)
+}
+func TestShortenRoute_InvalidInput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	router.POST("/shorten", ctrl.Shorten)
+
+	cases := map[string]map[string]string{
+		customError.CodeInvalidInput:   {},
+		customError.CodeInvalidUrl:     {"url": "facebook"},
+		customError.CodeBlacklistedUrl: {"url": "https://www.google.com"},
+		customError.CodeInvalidExpiry:  {"url": "https://www.facebook.com", "expiry": "tomorrow"},
+	}
+	for code, input := range cases {
+		w := httptest.NewRecorder()
+
+		jsonBytes, _ := json.Marshal(input)
+		c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+		router.ServeHTTP(w, c.Request)
+
+		var resp customError.Response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode, err: %v", err)
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, code, resp.Code)
+	}
+}
+func TestShortenRoute_PublicBaseURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{PublicBaseURL: "https://sho.rt/"})
+
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{}).
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://www.facebook.com"}, nil)
+
+	router.POST("/shorten", ctrl.Shorten)
+
+	w := httptest.NewRecorder()
+
+	jsonBytes, _ := json.Marshal(map[string]string{
+		"url": "https://www.facebook.com",
+	})
+	c.Request, _ = http.NewRequest("POST", "/shorten", bytes.NewReader(jsonBytes))
+	router.ServeHTTP(w, c.Request)
+
+	var resp model.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "https://sho.rt/abc", resp.Data.(map[string]interface{})["shortUrl"])
+}
+func TestQRCodeRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "abc").
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://www.facebook.com"}, nil)
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "missing").
+		Return(nil, customError.NotFound(customError.CodeShortCodeNotFound, "this short code is not found"))
+
+	router.GET("/:shortCode", ctrl.Redirect)
+	router.GET("/:shortCode/qr", ctrl.QRCode)
+
+	w := httptest.NewRecorder()
+	c.Request, _ = http.NewRequest("GET", "/abc/qr", nil)
+	router.ServeHTTP(w, c.Request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Assert(t, bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")))
+
+	w = httptest.NewRecorder()
+	c.Request, _ = http.NewRequest("GET", "/missing/qr", nil)
+	router.ServeHTTP(w, c.Request)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+func TestPreviewRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{PublicBaseURL: "https://sho.rt"})
+
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "abc").
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://www.facebook.com/page"}, nil)
+
+	router.GET("/:shortCode/preview", ctrl.Preview)
+
+	w := httptest.NewRecorder()
+	c.Request, _ = http.NewRequest("GET", "/abc/preview", nil)
+	router.ServeHTTP(w, c.Request)
+
+	var resp model.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://www.facebook.com/page", resp.Data.(map[string]interface{})["fullUrl"])
+	assert.Equal(t, "https://sho.rt/abc", resp.Data.(map[string]interface{})["shortUrl"])
 }
 func TestRedirectRoute(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -53,7 +365,7 @@ func TestRedirectRoute(t *testing.T) {
 
 	c, router := gin.CreateTestContext(httptest.NewRecorder())
 	serv := mock.NewMockService(mockCtrl)
-	ctrl := New(serv)
+	ctrl := New(serv, nil, Config{})
 
 	input := "mockedShortCode"
 	output := "/mockedFullCode"
@@ -72,6 +384,82 @@ func TestRedirectRoute(t *testing.T) {
 	assert.Equal(t, http.StatusFound, w.Code)
 	assert.Equal(t, output, w.HeaderMap.Get("Location"))
 }
+func TestRedirectRoute_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{customError.NotFound(customError.CodeShortCodeNotFound, "this short code is not found"), http.StatusNotFound, customError.CodeShortCodeNotFound},
+		{customError.Gone(customError.CodeShortCodeDeleted, "this short code is already deleted"), http.StatusGone, customError.CodeShortCodeDeleted},
+		{customError.Unavailable("failed to get url", fmt.Errorf("connection refused")), http.StatusServiceUnavailable, customError.CodeStorageUnavailable},
+		{fmt.Errorf("unexpected"), http.StatusInternalServerError, customError.CodeInternal},
+	}
+
+	router.GET("/:shortCode", ctrl.Redirect)
+
+	for _, tc := range cases {
+		serv.EXPECT().
+			Decode(gomock.Any(), "abc").
+			Return("", tc.err)
+
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest("GET", "/abc", nil)
+		router.ServeHTTP(w, c.Request)
+
+		var resp customError.Response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode, err: %v", err)
+		}
+		assert.Equal(t, tc.status, w.Code)
+		assert.Equal(t, tc.code, resp.Code)
+		// a cause of an error isn't exposed to clients
+		assert.Assert(t, !strings.Contains(resp.Message, "connection refused"), resp.Message)
+		assert.Assert(t, !strings.Contains(resp.Message, "unexpected"), resp.Message)
+	}
+}
+func TestRedirectRoute_ProblemJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{})
+
+	serv.EXPECT().
+		Decode(gomock.Any(), "abc").
+		Return("", customError.Gone(customError.CodeShortCodeDeleted, "this short code is already deleted"))
+
+	router.GET("/:shortCode", ctrl.Redirect)
+
+	w := httptest.NewRecorder()
+	c.Request, _ = http.NewRequest("GET", "/abc", nil)
+	c.Request.Header.Set("Accept", "application/problem+json")
+	router.ServeHTTP(w, c.Request)
+
+	var problem customError.Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.DeepEqual(t, customError.Problem{
+		Type:   "about:blank",
+		Title:  "Gone",
+		Status: http.StatusGone,
+		Detail: "this short code is already deleted",
+		Code:   customError.CodeShortCodeDeleted,
+	}, problem)
+}
 func TestGetUrlsRoute(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockCtrl := gomock.NewController(t)
@@ -79,7 +467,7 @@ func TestGetUrlsRoute(t *testing.T) {
 
 	c, router := gin.CreateTestContext(httptest.NewRecorder())
 	serv := mock.NewMockService(mockCtrl)
-	ctrl := New(serv)
+	ctrl := New(serv, nil, Config{Authenticator: auth.NewStaticKey("secret")})
 
 	mockedTime, _ := time.Parse(time.RFC3339Nano, "2021-08-20T22:06:32.6162088+07:00")
 	output := []*model.UrlObject{
@@ -109,16 +497,16 @@ func TestGetUrlsRoute(t *testing.T) {
 		},
 	}
 	serv.EXPECT().
-		GetUrlObjects(gomock.Any(), nil, nil).
-		Return(output, nil)
+		GetUrlObjects(gomock.Any(), model.UrlQuery{}).
+		Return(output, nil, nil)
 
-	router.GET("/admin/urls", ctrl.GetUrls)
+	router.GET("/admin/urls", ctrl.Authenticate, ctrl.GetUrls)
 
 	w := httptest.NewRecorder()
 
 	// completeUrl := fmt.Sprintf("/admin/urls?shortCode=%s&fullUrl=%s", shortCode, fullUrl)
 	c.Request, _ = http.NewRequest("GET", "/admin/urls", nil)
-	c.Request.Header.Set("Token", adminToken)
+	c.Request.Header.Set(auth.APIKeyHeader, "secret")
 	router.ServeHTTP(w, c.Request)
 
 	var resp model.Response
@@ -129,6 +517,60 @@ func TestGetUrlsRoute(t *testing.T) {
 	assert.Equal(t, 200, w.Code)
 	assert.DeepEqual(t, expected, resp.Data)
 }
+
+func TestGetUrlsRoute_Query(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{Authenticator: auth.NewStaticKey("secret")})
+	router.GET("/admin/urls", ctrl.Authenticate, ctrl.GetUrls)
+
+	request := func(url string) (int, model.Response) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(auth.APIKeyHeader, "secret")
+		router.ServeHTTP(w, req)
+		var resp model.Response
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	total := 25
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{Sort: model.SortHits, Desc: true, Cursor: "abc", Limit: 10}).
+		Return(nil, &model.Page{Total: &total, Limit: 10, NextCursor: "def"}, nil)
+	status, resp := request("/admin/urls?sort=hits&order=desc&cursor=abc&limit=10")
+	assert.Equal(t, http.StatusOK, status)
+	assert.DeepEqual(t, &model.Page{Total: &total, Limit: 10, NextCursor: "def"}, resp.Page)
+
+	// search params are parsed into a query
+	minHits := uint64(10)
+	createdAfter, _ := time.Parse(time.RFC3339, "2021-08-01T00:00:00Z")
+	fullUrl := `^https://`
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{
+			FullURL:      &fullUrl,
+			FullURLMatch: model.MatchRegex,
+			MinHits:      &minHits,
+			CreatedAfter: &createdAfter,
+		}).
+		Return(nil, &model.Page{Limit: 50}, nil)
+	status, _ = request("/admin/urls?fullUrl=%5Ehttps%3A%2F%2F&fullUrlMatch=regex&minHits=10&createdAfter=2021-08-01T00:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+
+	// invalid page and search params are rejected before the service is called
+	for _, query := range []string{
+		"limit=501", "limit=ten", "sort=fullUrl", "order=up",
+		"fullUrlMatch=glob", "minHits=-1", "expiresBefore=tomorrow",
+	} {
+		status, _ = request("/admin/urls?" + query)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+}
+
 func TestDeleteUrlRoute(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockCtrl := gomock.NewController(t)
@@ -136,23 +578,926 @@ func TestDeleteUrlRoute(t *testing.T) {
 
 	c, router := gin.CreateTestContext(httptest.NewRecorder())
 	serv := mock.NewMockService(mockCtrl)
-	ctrl := New(serv)
+	ctrl := New(serv, nil, Config{Authenticator: auth.NewStaticKey("secret")})
 
 	input := "mockedFullCode"
 	serv.EXPECT().
-		DeleteUrl(gomock.Any(), input).
+		DeleteUrl(gomock.Any(), input, gomock.Any()).
 		Return(true, nil)
 
 	// register route
 	router.GET("/:shortCode", ctrl.Redirect)
-	router.DELETE("/:shortCode", ctrl.DeleteUrl)
+	router.DELETE("/:shortCode", ctrl.Authenticate, ctrl.DeleteUrl)
 
 	w := httptest.NewRecorder()
 
 	c.Request, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/%s", input), nil)
-	c.Request.Header.Set("Token", adminToken)
+	c.Request.Header.Set(auth.APIKeyHeader, "secret")
 	router.ServeHTTP(w, c.Request)
 
 	// validate output
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestUpdateUrlRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), keys)})
+
+	router.PATCH("/admin/urls/:shortCode", ctrl.Authenticate, ctrl.Authorize, ctrl.UpdateUrl)
+
+	_, editorSecret, _ := keys.Create(context.Background(), "editor", auth.RoleEditor, tenant.Default)
+	request := func(key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest(http.MethodPatch, "/admin/urls/abc", strings.NewReader(body))
+		c.Request.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, c.Request)
+		return w
+	}
+
+	// a full url is changed and an empty expiry removes an expiry
+	fullUrl := "https://www.netflix.com"
+	serv.EXPECT().
+		Update(gomock.Any(), "abc", model.UpdateOptions{FullURL: &fullUrl, Expiry: &time.Time{}}).
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: fullUrl, Hits: 3}, nil)
+	w := request("secret", `{"url": "https://www.netflix.com", "expiry": ""}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp model.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, fullUrl, resp.Data.(map[string]interface{})["fullUrl"])
+	assert.Equal(t, float64(3), resp.Data.(map[string]interface{})["hits"])
+
+	// inputs are validated in the same way as Shorten
+	cases := map[string]string{
+		`{}`:                                customError.CodeInvalidInput,
+		`{"url": "facebook"}`:               customError.CodeInvalidUrl,
+		`{"url": "https://www.google.com"}`: customError.CodeBlacklistedUrl,
+		`{"expiry": "tomorrow"}`:            customError.CodeInvalidExpiry,
+	}
+	for body, code := range cases {
+		w := request("secret", body)
+		var resp customError.Response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode, err: %v", err)
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Equal(t, code, resp.Code, body)
+	}
+
+	// an editor only updates its own short codes
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "abc").
+		Return(&model.UrlObject{ShortCode: "abc", Owner: "apikey:other"}, nil)
+	assert.Equal(t, http.StatusForbidden, request(editorSecret, `{"url": "https://www.netflix.com"}`).Code)
+}
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{Authenticator: auth.NewStaticKey("secret")})
+
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{}).
+		Return(nil, nil, nil)
+
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+
+	cases := map[string]int{
+		"":       http.StatusUnauthorized,
+		"wrong":  http.StatusUnauthorized,
+		"secret": http.StatusOK,
+	}
+	for key, status := range cases {
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest("GET", "/admin/urls", nil)
+		if key != "" {
+			c.Request.Header.Set(auth.APIKeyHeader, key)
+		}
+		router.ServeHTTP(w, c.Request)
+
+		assert.Equal(t, status, w.Code, "key: %s", key)
+	}
+}
+
+func TestAuthenticate_Bearer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// an identity provider is replaced by a locally generated key
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key, err: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	publicKeyFile := filepath.Join(t.TempDir(), "public.pem")
+	_ = ioutil.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	bearer, err := auth.NewJWT(auth.JWTConfig{PublicKeyFiles: []string{publicKeyFile}, Audience: "shortener"})
+	if err != nil {
+		t.Fatalf("failed to initiate jwt authenticator, err: %v", err)
+	}
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	ctrl := New(serv, nil, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), bearer)})
+
+	// a viewer only gets its own short codes
+	owner := "jwt:user-1"
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{Owner: &owner}).
+		Return(nil, nil, nil)
+
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+
+	sign := func(audience string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub":   "user-1",
+			"aud":   audience,
+			"roles": []string{"viewer"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}).SignedString(key)
+		return token
+	}
+	cases := map[string]int{
+		"Bearer " + sign("shortener"): http.StatusOK,
+		"Bearer " + sign("other"):     http.StatusUnauthorized,
+		"Bearer invalid":              http.StatusUnauthorized,
+	}
+	for header, status := range cases {
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest("GET", "/admin/urls", nil)
+		c.Request.Header.Set("Authorization", header)
+		router.ServeHTTP(w, c.Request)
+
+		assert.Equal(t, status, w.Code, "header: %s", header)
+	}
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("bootstrap"), keys)})
+
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.POST("/keys", ctrl.CreateAPIKey)
+	admin.GET("/keys", ctrl.GetAPIKeys)
+	admin.DELETE("/keys/:id", ctrl.RevokeAPIKey)
+	admin.POST("/keys/:id/rotate", ctrl.RotateAPIKey)
+
+	request := func(method string, path string, key string, body interface{}) (int, model.Response) {
+		w := httptest.NewRecorder()
+		jsonBytes, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest(method, path, bytes.NewReader(jsonBytes))
+		c.Request.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, c.Request)
+
+		// errors are responded in customError.Response
+		var resp model.Response
+		if w.Code < http.StatusBadRequest {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode, err: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	// create a key by the bootstrap key
+	status, resp := request("POST", "/admin/keys", "bootstrap", map[string]string{"name": "ops", "role": "admin"})
+	assert.Equal(t, http.StatusCreated, status)
+	created := resp.Data.(map[string]interface{})
+	id := created["id"].(string)
+	key := created["key"].(string)
+	assert.Equal(t, "ops", created["name"])
+
+	// secret keys and hashes are never listed
+	status, resp = request("GET", "/admin/keys", key, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.DeepEqual(t, []interface{}{
+		map[string]interface{}{
+			"id":        id,
+			"name":      "ops",
+			"role":      "admin",
+			"createdAt": created["createdAt"],
+		},
+	}, resp.Data)
+
+	status, resp = request("POST", fmt.Sprintf("/admin/keys/%s/rotate", id), key, nil)
+	assert.Equal(t, http.StatusOK, status)
+	rotated := resp.Data.(map[string]interface{})["key"].(string)
+
+	status, _ = request("GET", "/admin/keys", key, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = request("DELETE", fmt.Sprintf("/admin/keys/%s", id), rotated, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = request("GET", "/admin/keys", rotated, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// an invalid role is rejected and a key is a viewer by default
+	status, _ = request("POST", "/admin/keys", "bootstrap", map[string]string{"name": "ops", "role": "root"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, resp = request("POST", "/admin/keys", "bootstrap", map[string]string{"name": "reader"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "viewer", resp.Data.(map[string]interface{})["role"])
+}
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: keys})
+
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), gomock.Any()).
+		Return(nil, nil, nil).
+		AnyTimes()
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "abc").
+		Return(&model.UrlObject{ShortCode: "abc", Owner: "apikey:other"}, nil).
+		AnyTimes()
+	serv.EXPECT().
+		DeleteUrl(gomock.Any(), "abc", gomock.Any()).
+		Return(true, nil).
+		AnyTimes()
+
+	router.DELETE("/:shortCode", ctrl.Authenticate, ctrl.Authorize, ctrl.DeleteUrl)
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+	admin.DELETE("/urls/:shortCode", ctrl.DeleteUrl)
+	admin.GET("/keys", ctrl.GetAPIKeys)
+	// a route missing in the policy is denied for everyone
+	admin.GET("/unlisted", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	secrets := make(map[auth.Role]string)
+	for _, role := range []auth.Role{auth.RoleViewer, auth.RoleEditor, auth.RoleAdmin} {
+		_, secret, err := keys.Create(context.Background(), string(role), role, tenant.Default)
+		if err != nil {
+			t.Fatalf("failed to create key, err: %v", err)
+		}
+		secrets[role] = secret
+	}
+	editors, _ := keys.List(context.Background())
+	for _, key := range editors {
+		if key.Role != auth.RoleEditor {
+			continue
+		}
+		serv.EXPECT().
+			GetUrlObject(gomock.Any(), "own").
+			Return(&model.UrlObject{ShortCode: "own", Owner: "apikey:" + key.ID}, nil).
+			AnyTimes()
+	}
+
+	cases := []struct {
+		method   string
+		path     string
+		role     auth.Role
+		expected int
+	}{
+		{"GET", "/admin/urls", auth.RoleViewer, http.StatusOK},
+		{"GET", "/admin/urls", auth.RoleEditor, http.StatusOK},
+		{"DELETE", "/admin/urls/abc", auth.RoleViewer, http.StatusForbidden},
+		{"DELETE", "/admin/urls/abc", auth.RoleEditor, http.StatusForbidden},
+		{"DELETE", "/admin/urls/abc", auth.RoleAdmin, http.StatusOK},
+		// only admins delete short codes even if they're owned by a caller
+		{"DELETE", "/admin/urls/own", auth.RoleEditor, http.StatusForbidden},
+		{"DELETE", "/own", auth.RoleEditor, http.StatusForbidden},
+		{"DELETE", "/abc", auth.RoleViewer, http.StatusForbidden},
+		{"DELETE", "/abc", auth.RoleAdmin, http.StatusOK},
+		{"GET", "/admin/keys", auth.RoleEditor, http.StatusForbidden},
+		{"GET", "/admin/keys", auth.RoleAdmin, http.StatusOK},
+		{"GET", "/admin/unlisted", auth.RoleAdmin, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest(tc.method, tc.path, nil)
+		c.Request.Header.Set(auth.APIKeyHeader, secrets[tc.role])
+		router.ServeHTTP(w, c.Request)
+
+		assert.Equal(t, tc.expected, w.Code, "%s %s by %s", tc.method, tc.path, tc.role)
+	}
+
+	// a denial reason is returned in the error envelope
+	w := httptest.NewRecorder()
+	c.Request, _ = http.NewRequest("DELETE", "/admin/urls/abc", nil)
+	c.Request.Header.Set(auth.APIKeyHeader, secrets[auth.RoleViewer])
+	router.ServeHTTP(w, c.Request)
+
+	var resp customError.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, customError.CodeForbidden, resp.Code)
+	assert.Assert(t, strings.Contains(resp.Message, "role admin is required for DELETE /admin/urls/:shortCode"), resp.Message)
+	assert.Assert(t, strings.Contains(resp.Message, "[viewer]"), resp.Message)
+}
+
+func TestOwnership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: keys})
+
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+	admin.DELETE("/urls/:shortCode", ctrl.DeleteUrl)
+
+	editor, editorSecret, _ := keys.Create(context.Background(), "editor", auth.RoleEditor, tenant.Default)
+	_, adminSecret, _ := keys.Create(context.Background(), "admin", auth.RoleAdmin, tenant.Default)
+	owner := "apikey:" + editor.ID
+	other := "apikey:other"
+
+	request := func(method string, path string, key string) int {
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest(method, path, nil)
+		c.Request.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, c.Request)
+		return w.Code
+	}
+
+	// an editor lists its own short codes even if it asks for another owner
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{Owner: &owner}).
+		Return(nil, nil, nil).
+		Times(2)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls", editorSecret))
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls?owner="+other, editorSecret))
+
+	// an admin lists all short codes or filters them by an owner
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{}).
+		Return(nil, nil, nil)
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{Owner: &other}).
+		Return(nil, nil, nil)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls", adminSecret))
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls?owner="+other, adminSecret))
+
+	// only admins delete short codes, so an editor can't delete even its own one
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/admin/urls/mine", editorSecret))
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/admin/urls/theirs", editorSecret))
+
+	// an admin deletes any short code without an ownership check
+	serv.EXPECT().
+		DeleteUrl(gomock.Any(), "theirs", gomock.Any()).
+		Return(true, nil)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/admin/urls/theirs", adminSecret))
+}
+
+func TestTenants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "marketing", Blacklist: []string{`example\.com`}}})
+	ctrl := New(serv, keys, Config{
+		Authenticator: auth.Chain(auth.NewStaticKey("bootstrap"), keys),
+		Tenants:       tenants,
+	})
+
+	router.POST("/shorten", ctrl.Identify, ctrl.Shorten)
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+	admin.POST("/keys", ctrl.CreateAPIKey)
+	admin.GET("/keys", ctrl.GetAPIKeys)
+	admin.DELETE("/keys/:id", ctrl.RevokeAPIKey)
+
+	request := func(method string, path string, key string, body interface{}) (int, model.Response) {
+		w := httptest.NewRecorder()
+		jsonBytes, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest(method, path, bytes.NewReader(jsonBytes))
+		c.Request.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, c.Request)
+
+		var resp model.Response
+		if w.Code < http.StatusBadRequest {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode, err: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	// only a super admin creates keys of other tenants and only for configured tenants
+	status, resp := request("POST", "/admin/keys", "bootstrap", map[string]string{"name": "ops", "role": "admin", "tenant": "marketing"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "marketing", resp.Data.(map[string]interface{})["tenant"])
+	marketing := resp.Data.(map[string]interface{})["key"].(string)
+
+	status, _ = request("POST", "/admin/keys", "bootstrap", map[string]string{"name": "ops", "tenant": "unknown"})
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = request("POST", "/admin/keys", marketing, map[string]string{"name": "ops", "tenant": ""})
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = request("POST", "/admin/keys", marketing, map[string]string{"name": "root", "role": "superadmin"})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, resp = request("POST", "/admin/keys", "bootstrap", map[string]string{"name": "default", "role": "admin"})
+	assert.Equal(t, http.StatusCreated, status)
+	defaultID := resp.Data.(map[string]interface{})["id"].(string)
+
+	// an admin of a tenant lists and manages keys of its tenant only
+	status, resp = request("GET", "/admin/keys", marketing, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, len(resp.Data.([]interface{})))
+	status, _ = request("DELETE", "/admin/keys/"+defaultID, marketing, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, resp = request("GET", "/admin/keys", "bootstrap", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, len(resp.Data.([]interface{})))
+
+	// requests are scoped to a tenant of a caller, a super admin sees all tenants unless it asks for one
+	scoped := func(expected string, scoped bool) func(ctx context.Context, _ model.UrlQuery) ([]*model.UrlObject, *model.Page, error) {
+		return func(ctx context.Context, _ model.UrlQuery) ([]*model.UrlObject, *model.Page, error) {
+			id, ok := tenant.FromContext(ctx)
+			assert.Equal(t, expected, id)
+			assert.Equal(t, scoped, ok)
+			return nil, nil, nil
+		}
+	}
+	serv.EXPECT().GetUrlObjects(gomock.Any(), model.UrlQuery{}).DoAndReturn(scoped("marketing", true))
+	serv.EXPECT().GetUrlObjects(gomock.Any(), model.UrlQuery{}).DoAndReturn(scoped("marketing", true))
+	serv.EXPECT().GetUrlObjects(gomock.Any(), model.UrlQuery{}).DoAndReturn(scoped("", false))
+	serv.EXPECT().GetUrlObjects(gomock.Any(), model.UrlQuery{}).DoAndReturn(scoped("marketing", true))
+
+	status, _ = request("GET", "/admin/urls", marketing, nil)
+	assert.Equal(t, http.StatusOK, status)
+	// a tenant query is ignored for callers other than super admins
+	status, _ = request("GET", "/admin/urls?tenant=", marketing, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request("GET", "/admin/urls", "bootstrap", nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request("GET", "/admin/urls?tenant=marketing", "bootstrap", nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request("GET", "/admin/urls?tenant=unknown", "bootstrap", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// a blacklist of a tenant applies to its callers only
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://example.com", gomock.Any()).
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://example.com"}, nil)
+	status, _ = request("POST", "/shorten", marketing, map[string]string{"url": "https://example.com"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = request("POST", "/shorten", "bootstrap", map[string]string{"url": "https://example.com"})
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestDomains(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	domains, _ := domain.NewList([]string{"brand.ly"})
+	ctrl := New(serv, nil, Config{
+		PublicBaseURL: "https://sho.rt",
+		Authenticator: auth.NewStaticKey("secret"),
+		Domains:       domains,
+	})
+
+	router.Use(ctrl.Domain)
+	router.POST("/shorten", ctrl.Shorten)
+	router.GET("/:shortCode", ctrl.Redirect)
+	router.GET("/admin/urls", ctrl.Authenticate, ctrl.Authorize, ctrl.GetUrls)
+
+	request := func(method string, target string, host string, body interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		jsonBytes, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest(method, target, bytes.NewReader(jsonBytes))
+		c.Request.Host = host
+		c.Request.Header.Set(auth.APIKeyHeader, "secret")
+		router.ServeHTTP(w, c.Request)
+		return w
+	}
+	inDomain := func(expected string) func(ctx context.Context, shortCode string) (string, error) {
+		return func(ctx context.Context, shortCode string) (string, error) {
+			assert.Equal(t, expected, domain.FromContext(ctx))
+			return "https://www.facebook.com", nil
+		}
+	}
+
+	// a request host selects a domain, unknown hosts are in the default domain
+	serv.EXPECT().Decode(gomock.Any(), "abc").DoAndReturn(inDomain("brand.ly"))
+	serv.EXPECT().Decode(gomock.Any(), "abc").DoAndReturn(inDomain(""))
+	assert.Equal(t, http.StatusFound, request("GET", "/abc", "Brand.ly:443", nil).Code)
+	assert.Equal(t, http.StatusFound, request("GET", "/abc", "sho.rt", nil).Code)
+
+	// a short url is built in a domain of the input
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{}).
+		DoAndReturn(func(ctx context.Context, fullUrl string, _ model.EncodeOptions) (*model.UrlObject, error) {
+			assert.Equal(t, "brand.ly", domain.FromContext(ctx))
+			return &model.UrlObject{ShortCode: "abc", FullURL: fullUrl, Domain: "brand.ly"}, nil
+		})
+	w := request("POST", "/shorten", "sho.rt", map[string]string{"url": "https://www.facebook.com", "domain": "brand.ly"})
+	var resp model.Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://brand.ly/abc", resp.Data.(map[string]interface{})["shortUrl"])
+
+	// domains which aren't allowed are rejected
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/shorten", "sho.rt", map[string]string{
+		"url": "https://www.facebook.com", "domain": "evil.com",
+	}).Code)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/admin/urls?domain=evil.com", "sho.rt", nil).Code)
+
+	// url objects are filtered by a domain only if it's specified
+	name := "brand.ly"
+	serv.EXPECT().GetUrlObjects(gomock.Any(), model.UrlQuery{Domain: &name}).Return(nil, nil, nil)
+	serv.EXPECT().GetUrlObjects(gomock.Any(), model.UrlQuery{}).Return(nil, nil, nil)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls?domain=brand.ly", "sho.rt", nil).Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls", "brand.ly", nil).Code)
+}
+
+func TestDeletedUrlRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	c, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), keys)})
+
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.DELETE("/urls/:shortCode", ctrl.DeleteUrl)
+	admin.GET("/urls/deleted", ctrl.GetDeletedUrls)
+	admin.POST("/urls/:shortCode/restore", ctrl.RestoreUrl)
+	admin.POST("/urls/:shortCode/purge", ctrl.PurgeUrl)
+
+	editor, editorSecret, _ := keys.Create(context.Background(), "editor", auth.RoleEditor, tenant.Default)
+	owner := "apikey:" + editor.ID
+	request := func(method string, path string, key string) int {
+		w := httptest.NewRecorder()
+		c.Request, _ = http.NewRequest(method, path, nil)
+		c.Request.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, c.Request)
+		return w.Code
+	}
+
+	// an editor lists and restores its own deleted short codes only
+	serv.EXPECT().
+		GetDeletedUrls(gomock.Any(), &owner, nil).
+		Return([]*model.UrlObject{{ShortCode: "mine", Owner: owner}}, nil)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls/deleted", editorSecret))
+
+	serv.EXPECT().
+		GetDeletedUrl(gomock.Any(), "mine").
+		Return(&model.UrlObject{ShortCode: "mine", Owner: owner}, nil)
+	serv.EXPECT().
+		RestoreUrl(gomock.Any(), "mine").
+		Return(&model.UrlObject{ShortCode: "mine", Owner: owner}, nil)
+	assert.Equal(t, http.StatusOK, request("POST", "/admin/urls/mine/restore", editorSecret))
+
+	serv.EXPECT().
+		GetDeletedUrl(gomock.Any(), "theirs").
+		Return(&model.UrlObject{ShortCode: "theirs", Owner: "apikey:other"}, nil)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/admin/urls/theirs/restore", editorSecret))
+
+	// a restore after a retention period is rejected
+	serv.EXPECT().
+		RestoreUrl(gomock.Any(), "old").
+		Return(nil, customError.Gone(customError.CodeRetentionExpired, "retention of this deleted short code is expired"))
+	assert.Equal(t, http.StatusGone, request("POST", "/admin/urls/old/restore", "secret"))
+
+	// a short code deleted before deleted urls were kept is a conflict, not a gone retention
+	serv.EXPECT().
+		RestoreUrl(gomock.Any(), "legacy").
+		Return(nil, customError.Conflict(customError.CodeNotRestorable, "this short code was deleted before deleted urls were kept, it can only be purged"))
+	assert.Equal(t, http.StatusConflict, request("POST", "/admin/urls/legacy/restore", "secret"))
+
+	// only admins purge deleted short codes
+	assert.Equal(t, http.StatusForbidden, request("POST", "/admin/urls/mine/purge", editorSecret))
+	serv.EXPECT().
+		PurgeUrl(gomock.Any(), "mine").
+		Return(nil)
+	assert.Equal(t, http.StatusOK, request("POST", "/admin/urls/mine/purge", "secret"))
+
+	// a caller is kept as an actor of a deletion
+	serv.EXPECT().
+		DeleteUrl(gomock.Any(), "abc", "bootstrap").
+		Return(true, nil)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/admin/urls/abc", "secret"))
+}
+
+func TestTagRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), keys)})
+
+	router.POST("/shorten", ctrl.Identify, ctrl.Shorten)
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+	admin.POST("/urls/:shortCode/tags", ctrl.AddTags)
+	admin.DELETE("/urls/:shortCode/tags/:tag", ctrl.RemoveTag)
+	admin.GET("/tags", ctrl.GetTags)
+
+	editor, editorSecret, _ := keys.Create(context.Background(), "editor", auth.RoleEditor, tenant.Default)
+	owner := "apikey:" + editor.ID
+	request := func(method string, path string, key string, body interface{}) int {
+		var reader io.Reader
+		if body != nil {
+			jsonBytes, _ := json.Marshal(body)
+			reader = bytes.NewReader(jsonBytes)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, reader)
+		if key != "" {
+			req.Header.Set(auth.APIKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// tags are normalized and a folder is validated when shortening
+	serv.EXPECT().
+		Encode(gomock.Any(), "https://www.facebook.com", model.EncodeOptions{
+			Tags:   []string{"email", "summer"},
+			Folder: "campaigns/summer",
+		}).
+		Return(&model.UrlObject{ShortCode: "abc", FullURL: "https://www.facebook.com"}, nil)
+	assert.Equal(t, http.StatusOK, request("POST", "/shorten", "", map[string]interface{}{
+		"url":    "https://www.facebook.com",
+		"tags":   []string{"Summer", "email", "summer"},
+		"folder": "campaigns/summer",
+	}))
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/shorten", "", map[string]interface{}{
+		"url":  "https://www.facebook.com",
+		"tags": []string{"summer sale"},
+	}))
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/shorten", "", map[string]interface{}{
+		"url":    "https://www.facebook.com",
+		"folder": "/campaigns",
+	}))
+
+	// an editor tags its own short codes only
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "mine").
+		Return(&model.UrlObject{ShortCode: "mine", Owner: owner}, nil).
+		Times(2)
+	serv.EXPECT().
+		Update(gomock.Any(), "mine", model.UpdateOptions{AddTags: []string{"summer"}}).
+		Return(&model.UrlObject{ShortCode: "mine", Owner: owner, Tags: []string{"summer"}}, nil)
+	assert.Equal(t, http.StatusOK, request("POST", "/admin/urls/mine/tags", editorSecret, map[string]interface{}{"tags": []string{"Summer"}}))
+	serv.EXPECT().
+		Update(gomock.Any(), "mine", model.UpdateOptions{RemoveTags: []string{"summer"}}).
+		Return(&model.UrlObject{ShortCode: "mine", Owner: owner}, nil)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/admin/urls/mine/tags/summer", editorSecret, nil))
+
+	serv.EXPECT().
+		GetUrlObject(gomock.Any(), "theirs").
+		Return(&model.UrlObject{ShortCode: "theirs", Owner: "apikey:other"}, nil)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/admin/urls/theirs/tags", editorSecret, map[string]interface{}{"tags": []string{"summer"}}))
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/urls/mine/tags", editorSecret, map[string]interface{}{"tags": []string{}}))
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/urls/mine/tags", editorSecret, map[string]interface{}{"tags": []string{"a/b"}}))
+
+	// short codes are listed by a tag in lowercase
+	tag := "summer"
+	serv.EXPECT().
+		GetUrlObjects(gomock.Any(), model.UrlQuery{Owner: &owner, Tag: &tag}).
+		Return(nil, nil, nil)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/urls?tag=Summer", editorSecret, nil))
+
+	// an editor counts its own short codes of tags, an admin counts all of them
+	serv.EXPECT().
+		GetTagStats(gomock.Any(), &owner, nil).
+		Return([]*model.TagStats{{Tag: "summer", Urls: 1, Hits: 3}}, nil)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/tags", editorSecret, nil))
+	serv.EXPECT().
+		GetTagStats(gomock.Any(), nil, nil).
+		Return(nil, nil)
+	assert.Equal(t, http.StatusOK, request("GET", "/admin/tags", "secret", nil))
+}
+
+func TestShortenBulkRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), keys)})
+	router.POST("/shorten/bulk", ctrl.Authenticate, ctrl.Authorize, ctrl.ShortenBulk)
+
+	_, viewerSecret, _ := keys.Create(context.Background(), "viewer", auth.RoleViewer, tenant.Default)
+	request := func(contentType string, body io.Reader, key string) (int, model.BulkShortenOutput) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/shorten/bulk", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, req)
+
+		var output model.BulkShortenOutput
+		resp := model.Response{Data: &output}
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, output
+	}
+	encodeBulk := func(ctx context.Context, requests []model.EncodeRequest) []model.EncodeResult {
+		results := make([]model.EncodeResult, len(requests))
+		for i, request := range requests {
+			if request.Options.Alias != nil && *request.Options.Alias == "taken" {
+				results[i].Err = customError.Conflict(customError.CodeAliasTaken, "this short code is already in use")
+				continue
+			}
+			results[i].Object = &model.UrlObject{ShortCode: fmt.Sprintf("code%d", i), FullURL: request.FullURL}
+		}
+		return results
+	}
+
+	// invalid rows fail without being shortened and other rows are shortened
+	serv.EXPECT().
+		EncodeBulk(gomock.Any(), gomock.Len(2)).
+		DoAndReturn(encodeBulk)
+	rows, _ := json.Marshal([]map[string]interface{}{
+		{"url": "https://www.facebook.com", "tags": []string{"summer"}},
+		{"url": "not a url"},
+		{"url": "https://www.netflix.com", "alias": "taken"},
+		{"url": ""},
+	})
+	status, output := request("application/json", bytes.NewReader(rows), "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, model.BulkSummary{Total: 4, Succeeded: 1, Failed: 3}, output.Summary)
+	assert.Equal(t, "code0", output.Results[0].Data.ShortCode)
+	assert.Equal(t, 2, output.Results[1].Row)
+	assert.Equal(t, customError.CodeInvalidUrl, output.Results[1].Error.Code)
+	assert.Equal(t, customError.CodeAliasTaken, output.Results[2].Error.Code)
+	assert.Equal(t, customError.CodeInvalidInput, output.Results[3].Error.Code)
+
+	// a CSV is read by its header
+	serv.EXPECT().
+		EncodeBulk(gomock.Any(), []model.EncodeRequest{
+			{FullURL: "https://www.facebook.com", Options: model.EncodeOptions{Owner: "bootstrap", Tags: []string{"email", "summer"}}},
+			{FullURL: "https://www.netflix.com", Options: model.EncodeOptions{Owner: "bootstrap", Alias: func(s string) *string { return &s }("netflix")}},
+		}).
+		DoAndReturn(encodeBulk)
+	csvBody := "\ufeffurl,alias,tags,dedupe\n" +
+		"https://www.facebook.com,,summer;email,\n" +
+		"https://www.netflix.com,netflix,,\n" +
+		"https://www.github.com,,,maybe\n"
+	status, output = request("text/csv", strings.NewReader(csvBody), "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, model.BulkSummary{Total: 3, Succeeded: 2, Failed: 1}, output.Summary)
+	assert.Equal(t, customError.CodeInvalidInput, output.Results[2].Error.Code)
+
+	// a CSV is uploaded as a file of a multipart form
+	serv.EXPECT().
+		EncodeBulk(gomock.Any(), gomock.Len(1)).
+		DoAndReturn(encodeBulk)
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	file, _ := writer.CreateFormFile("file", "links.csv")
+	_, _ = file.Write([]byte("url\nhttps://www.facebook.com\n"))
+	_ = writer.Close()
+	status, output = request(writer.FormDataContentType(), &form, "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, output.Summary.Succeeded)
+
+	// a request fails as a whole if it can't be read or a caller can't create short codes
+	status, _ = request("text/csv", strings.NewReader("url,unknown\nhttps://www.facebook.com,1\n"), "secret")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = request("application/json", strings.NewReader("[]"), "secret")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = request("text/plain", strings.NewReader("https://www.facebook.com"), "secret")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = request("application/json", bytes.NewReader(rows), viewerSecret)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestBulkUpdateRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	serv := mock.NewMockService(mockCtrl)
+	keys := auth.NewKeyStore(repository.NewMemory())
+	ctrl := New(serv, keys, Config{Authenticator: auth.Chain(auth.NewStaticKey("secret"), keys)})
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.POST("/urls/bulk", ctrl.BulkUpdateUrls)
+
+	editor, editorSecret, _ := keys.Create(context.Background(), "editor", auth.RoleEditor, tenant.Default)
+	_, viewerSecret, _ := keys.Create(context.Background(), "viewer", auth.RoleViewer, tenant.Default)
+	owner := "apikey:" + editor.ID
+	request := func(path string, key string, body interface{}) (int, model.BulkUpdateOutput) {
+		jsonBytes, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewReader(jsonBytes))
+		req.Header.Set(auth.APIKeyHeader, key)
+		router.ServeHTTP(w, req)
+
+		var output model.BulkUpdateOutput
+		resp := model.Response{Data: &output}
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, output
+	}
+
+	// listed short codes of an editor are only changed if they're owned by it
+	serv.EXPECT().
+		BulkUpdate(gomock.Any(), model.BulkUpdateRequest{
+			Action:     model.BulkExpire,
+			ShortCodes: []string{"abc", "def"},
+			Owner:      &owner,
+			DryRun:     true,
+			Actor:      owner,
+		}).
+		Return([]model.BulkUpdateResult{
+			{ShortCode: "abc", Object: &model.UrlObject{ShortCode: "abc", Owner: owner}},
+			{ShortCode: "def", Err: customError.Forbidden("short code def isn't owned by caller")},
+		}, nil)
+	status, output := request("/admin/urls/bulk", editorSecret, map[string]interface{}{
+		"action":     "expire",
+		"shortCodes": []string{"abc", "def"},
+		"dryRun":     true,
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, output.DryRun)
+	assert.Equal(t, model.BulkSummary{Total: 2, Succeeded: 1, Failed: 1}, output.Summary)
+	assert.Equal(t, customError.CodeForbidden, output.Results[1].Error.Code)
+
+	// only admins delete short codes, even their own ones or in a dry run
+	status, _ = request("/admin/urls/bulk", editorSecret, map[string]interface{}{
+		"action":     "delete",
+		"shortCodes": []string{"abc"},
+		"dryRun":     true,
+	})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// short codes are matched by filters of url objects and an expiry is parsed
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	serv.EXPECT().
+		BulkUpdate(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, request model.BulkUpdateRequest) ([]model.BulkUpdateResult, error) {
+			assert.Equal(t, model.BulkSetExpiry, request.Action)
+			assert.Equal(t, "summer", *request.Query.Tag)
+			assert.Equal(t, uint64(10), *request.Query.MinHits)
+			assert.Assert(t, request.Query.Owner == nil)
+			assert.Assert(t, request.Expiry.Equal(expiry))
+			return nil, nil
+		})
+	status, output = request("/admin/urls/bulk?tag=Summer&minHits=10", "secret", map[string]interface{}{
+		"action": "setExpiry",
+		"expiry": expiry.Format(time.RFC3339),
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 0, len(output.Results))
+
+	// short codes must be either listed or matched and an expiry is only set in the future by setExpiry
+	invalid := []struct {
+		path string
+		body map[string]interface{}
+	}{
+		{"/admin/urls/bulk", map[string]interface{}{"action": "delete"}},
+		{"/admin/urls/bulk?tag=summer", map[string]interface{}{"action": "delete", "shortCodes": []string{"abc"}}},
+		{"/admin/urls/bulk?tag=summer", map[string]interface{}{"action": "archive"}},
+		{"/admin/urls/bulk?tag=summer", map[string]interface{}{"action": "expire", "expiry": expiry.Format(time.RFC3339)}},
+		{"/admin/urls/bulk?tag=summer", map[string]interface{}{"action": "setExpiry", "expiry": "tomorrow"}},
+		{"/admin/urls/bulk?tag=summer", map[string]interface{}{"action": "setExpiry", "expiry": "2000-01-01T00:00:00Z"}},
+	}
+	for _, c := range invalid {
+		status, _ = request(c.path, "secret", c.body)
+		assert.Equal(t, http.StatusBadRequest, status, c.body)
+	}
+	status, _ = request("/admin/urls/bulk", viewerSecret, map[string]interface{}{"action": "delete", "shortCodes": []string{"abc"}})
+	assert.Equal(t, http.StatusForbidden, status)
+}
@@ -1,20 +1,150 @@
 package customError
 
-type ValidationError struct {
-	Code    uint64 `json:"code"`
-	Message string `json:"message"`
+import (
+	"fmt"
+	"net/http"
+)
+
+// Kind is a category of errors, it decides an HTTP status code of an error
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindGone
+	KindUnavailable
+)
+
+// HTTPStatusCode returns an HTTP status code of errors of a kind
+func (k Kind) HTTPStatusCode() int {
+	switch k {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindGone:
+		return http.StatusGone
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
-func (e *ValidationError) Error() string {
+// Stable machine-readable codes of errors, clients may rely on them so they must never be changed
+const (
+	CodeInvalidInput       = "invalid_input"
+	CodeInvalidUrl         = "invalid_url"
+	CodeBlacklistedUrl     = "blacklisted_url"
+	CodeInvalidAlias       = "invalid_alias"
+	CodeInvalidExpiry      = "invalid_expiry"
+	CodeInvalidDomain      = "invalid_domain"
+	CodeInvalidCursor      = "invalid_cursor"
+	CodeInvalidQuery       = "invalid_query"
+	CodeInvalidTag         = "invalid_tag"
+	CodeInvalidFolder      = "invalid_folder"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeShortCodeNotFound  = "short_code_not_found"
+	CodeShortCodeDeleted   = "short_code_deleted"
+	CodeRetentionExpired   = "retention_expired"
+	CodeNotRestorable      = "short_code_not_restorable"
+	CodeAliasTaken         = "alias_taken"
+	CodeAPIKeyNotFound     = "api_key_not_found"
+	CodeAPIKeyRevoked      = "api_key_revoked"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeUnknownTenant      = "unknown_tenant"
+	CodeGenerationFailed   = "short_code_generation_failed"
+	CodeStorageUnavailable = "storage_unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// Error is an error with a stable code which is returned by services and mapped to an API response
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Err is a cause of an error, it is not exposed to clients
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s, err: %v", e.Message, e.Err)
+	}
 	return e.Message
 }
 
-type InternalError struct {
-	Code           uint64 `json:"code"`
-	Message        string `json:"message"`
-	HTTPStatusCode int    `json:"-"`
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
-func (e *InternalError) Error() string {
-	return e.Message
+// Validation returns an error of invalid input
+func Validation(code string, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+// Unauthorized returns an error of a request without valid credentials
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+// Forbidden returns an error of a request without permission
+func Forbidden(message string) *Error {
+	return &Error{Kind: KindForbidden, Code: CodeForbidden, Message: message}
+}
+
+// QuotaExceeded returns an error of a request creating more resources than a quota
+func QuotaExceeded(message string) *Error {
+	return &Error{Kind: KindForbidden, Code: CodeQuotaExceeded, Message: message}
+}
+
+// NotFound returns an error of a missing resource
+func NotFound(code string, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+// Conflict returns an error of a resource which already exists
+func Conflict(code string, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+// Gone returns an error of a resource which was removed permanently
+func Gone(code string, message string) *Error {
+	return &Error{Kind: KindGone, Code: code, Message: message}
+}
+
+// Unavailable returns an error of an upstream service like a database which fails
+func Unavailable(message string, err error) *Error {
+	return &Error{Kind: KindUnavailable, Code: CodeStorageUnavailable, Message: message, Err: err}
+}
+
+// Internal returns an unexpected error
+func Internal(code string, message string, err error) *Error {
+	return &Error{Kind: KindInternal, Code: code, Message: message, Err: err}
+}
+
+// Response is a body of error responses
+type Response struct {
+	Code    string `json:"code" example:"short_code_not_found"`
+	Message string `json:"message" example:"this short code is not found"`
+}
+
+// Problem is a body of error responses in RFC 7807 problem+json format
+type Problem struct {
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail" example:"this short code is not found"`
+	Code   string `json:"code" example:"short_code_not_found"`
 }
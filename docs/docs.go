@@ -23,31 +23,1156 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/keys": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get all API keys including revoked ones without their secret keys",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get all API keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.APIKeyOutput"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create an API key for admin APIs, its secret key is only returned once",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create an API key",
+                "parameters": [
+                    {
+                        "description": "Input for creating an API key",
+                        "name": "APIKeyInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.APIKeyInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.APIKeyOutput"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Revoke an API key, it can't be used anymore",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Revoke an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}/rotate": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replace a secret key of an API key, the old secret key stops working immediately",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Rotate an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.APIKeyOutput"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/tags": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get tags with the number of their short codes and the sum of their hits.\nCallers other than admins only count their own short codes.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get tags",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins",
+                        "name": "owner",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, empty for the default domain",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.TagStats"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
         "/admin/urls": {
             "get": {
-                "description": "Get all url saved in database and can be filtered with a short code and a full url",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get all url saved in database and can be filtered with a short code, a full url, an owner, a domain,\na range of hits and windows of expiry and creation time.\nA short code and a full url contain a query by default, or match it exactly, by a prefix or by a regex.\nCallers other than admins only get their own short codes.\nUrl objects are listed in pages, pass nextCursor of a page as a cursor to get the next page.\nA page has a total of matched url objects, a filtered total is approximate if there're too many to scan.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get all url for admin",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "contains",
+                            "exact",
+                            "prefix",
+                            "regex"
+                        ],
+                        "type": "string",
+                        "description": "Match mode of a short code",
+                        "name": "shortCodeMatch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Full URL",
+                        "name": "fullUrl",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "contains",
+                            "exact",
+                            "prefix",
+                            "regex"
+                        ],
+                        "type": "string",
+                        "description": "Match mode of a full URL",
+                        "name": "fullUrlMatch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tag",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Folder, short codes in its subfolders are also listed",
+                        "name": "folder",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum hits",
+                        "name": "minHits",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum hits",
+                        "name": "maxHits",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expires before a RFC3339 time, short codes without an expiry don't match",
+                        "name": "expiresBefore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expires after a RFC3339 time, short codes without an expiry match",
+                        "name": "expiresAfter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created after a RFC3339 time",
+                        "name": "createdAfter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before a RFC3339 time",
+                        "name": "createdBefore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins",
+                        "name": "owner",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, empty for the default domain",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Next cursor of a previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 50 by default and at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "shortCode",
+                            "hits",
+                            "expiry",
+                            "createdAt"
+                        ],
+                        "type": "string",
+                        "description": "Sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort order",
+                        "name": "order",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/bulk": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete, expire now or set an expiry of listed short codes in a domain of a request,\nor of short codes matching query params of filters like Get all url if no short codes are listed.\nUp to 10000 short codes are changed at once and each change is recorded in an audit entry.\nA dry run reports short codes which would be changed without changing them.\nCallers other than admins can only change their own short codes and only admins can delete them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Change short codes in bulk",
+                "parameters": [
+                    {
+                        "description": "Action, short codes and an expiry of setExpiry",
+                        "name": "BulkUpdateInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.BulkUpdateInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Full URL",
+                        "name": "fullUrl",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins",
+                        "name": "owner",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tag",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Folder, short codes in its subfolders are also matched",
+                        "name": "folder",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expires before a RFC3339 time",
+                        "name": "expiresBefore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.BulkUpdateOutput"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/deleted": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get deleted short codes which can be restored with their deletion time and actor.\nCallers other than admins only get their own short codes.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get deleted urls",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Owner, e.g. apikey:3f9a1c2b7d4e, only for admins",
+                        "name": "owner",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, empty for the default domain",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.UrlObject"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/{shortCode}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete a short code, it can be restored until it is purged and it is never reused before that.\nOnly admins can delete short codes.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete a short code",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, a domain of a request host by default",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update a full url, an expiry and a folder of a short code, its hits are kept. Fields which aren't specified\nare unchanged, an empty expiry removes an expiry and an empty folder removes a short code from its folder.\nCallers other than admins can only update their own short codes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Update a short code",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Input for updating a short code",
+                        "name": "UpdateInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.UpdateInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, a domain of a request host by default",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.UrlObject"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/{shortCode}/purge": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Permanently remove a deleted short code, it can't be restored and can be reused after that",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Purge a deleted short code",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, a domain of a request host by default",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/{shortCode}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Restore a deleted short code with its hits within a retention period.\nCallers other than admins can only restore their own short codes.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get all url for admin",
+                "summary": "Restore a deleted short code",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Admin token -\u003e enter ` + "`" + `@dmIn` + "`" + `",
-                        "name": "token",
-                        "in": "header",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "path",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, a domain of a request host by default",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.UrlObject"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/{shortCode}/tags": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Add lowercase tags to a short code, a short code has at most 20 tags.\nCallers other than admins can only tag their own short codes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Add tags to a short code",
+                "parameters": [
                     {
                         "type": "string",
                         "description": "Short Code",
                         "name": "shortCode",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Tags to add",
+                        "name": "TagsInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.TagsInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Full URL",
-                        "name": "fullUrl",
+                        "description": "Short domain, a domain of a request host by default",
+                        "name": "domain",
                         "in": "query"
                     }
                 ],
@@ -55,13 +1180,156 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.UrlObject"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/urls/{shortCode}/tags/{tag}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Remove a tag from a short code, callers other than admins can only untag their own short codes.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Remove a tag from a short code",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tag",
+                        "name": "tag",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Short domain, a domain of a request host by default",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.UrlObject"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/customError.InternalError"
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
                         }
                     }
                 }
@@ -69,7 +1337,7 @@ var doc = `{
         },
         "/shorten": {
             "post": {
-                "description": "shorten a specified url",
+                "description": "shorten a specified url, it is owned by a caller if credentials are sent.\nA short url is in a domain of the input or a request host.",
                 "consumes": [
                     "application/json"
                 ],
@@ -92,19 +1360,129 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.ShortenOutput"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/shorten/bulk": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Shorten rows of a JSON array of shorten inputs or of a CSV, up to 10000 rows.\nA CSV has a header of columns ` + "`" + `url` + "`" + `, ` + "`" + `expiry` + "`" + `, ` + "`" + `alias` + "`" + `, ` + "`" + `dedupe` + "`" + `, ` + "`" + `domain` + "`" + `, ` + "`" + `tags` + "`" + ` and ` + "`" + `folder` + "`" + `\nand tags are separated by ` + "`" + `;` + "`" + `. It is sent as a ` + "`" + `text/csv` + "`" + ` body or a ` + "`" + `file` + "`" + ` of a multipart form.\nEach row is validated and shortened on its own, so a result has a short url or an error of each row.",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Shorten urls in bulk",
+                "parameters": [
+                    {
+                        "description": "Inputs for shortening data",
+                        "name": "ShortenInputs",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.ShortenInput"
+                            }
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant id, only for super admins",
+                        "name": "tenant",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.BulkShortenOutput"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/customError.ValidationError"
+                            "$ref": "#/definitions/customError.Response"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/customError.ValidationError"
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
                         }
                     }
                 }
@@ -112,7 +1490,7 @@ var doc = `{
         },
         "/{shortCode}": {
             "get": {
-                "description": "Redirect to full url using short code",
+                "description": "Redirect to full url using short code in a domain of a request host",
                 "produces": [
                     "application/json"
                 ],
@@ -136,25 +1514,88 @@ var doc = `{
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/customError.InternalError"
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Get all url saved in database and can be filtered with a short code and a full url",
+            }
+        },
+        "/{shortCode}/preview": {
+            "get": {
+                "description": "Get a full url of a short code without redirecting and counting a hit",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get all url for admin",
+                "summary": "Preview a short url",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Admin token -\u003e enter ` + "`" + `@dmIn` + "`" + `",
-                        "name": "token",
-                        "in": "header",
+                        "description": "Short Code",
+                        "name": "shortCode",
+                        "in": "path",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.ShortenOutput"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
                     },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/{shortCode}/qr": {
+            "get": {
+                "description": "Get a PNG image of a QR code encoding a short url",
+                "produces": [
+                    "image/png"
+                ],
+                "summary": "Get a QR code of short url",
+                "parameters": [
                     {
                         "type": "string",
                         "description": "Short Code",
@@ -167,19 +1608,25 @@ var doc = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "type": "file"
                         }
                     },
-                    "403": {
-                        "description": "Forbidden",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/customError.InternalError"
+                            "$ref": "#/definitions/customError.Response"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/customError.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
-                            "$ref": "#/definitions/customError.InternalError"
+                            "$ref": "#/definitions/customError.Response"
                         }
                     }
                 }
@@ -187,25 +1634,210 @@ var doc = `{
         }
     },
     "definitions": {
-        "customError.InternalError": {
+        "customError.Response": {
             "type": "object",
             "properties": {
                 "code": {
-                    "type": "integer"
+                    "type": "string",
+                    "example": "short_code_not_found"
                 },
                 "message": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "this short code is not found"
                 }
             }
         },
-        "customError.ValidationError": {
+        "model.APIKeyInput": {
             "type": "object",
+            "required": [
+                "name"
+            ],
             "properties": {
-                "code": {
-                    "type": "integer"
+                "name": {
+                    "type": "string",
+                    "example": "deploy bot"
                 },
-                "message": {
-                    "type": "string"
+                "role": {
+                    "description": "Role is one of viewer, editor, admin and superadmin, it is viewer by default",
+                    "type": "string",
+                    "example": "editor"
+                },
+                "tenant": {
+                    "description": "Tenant is an id of a tenant of a key, it is a tenant of a caller by default",
+                    "type": "string",
+                    "example": "marketing"
+                }
+            }
+        },
+        "model.APIKeyOutput": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2021-08-20T18:21:05+07:00"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "3f9a1c2b7d4e"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "3f9a1c2b7d4e.Jx3v9Qe0bq2nS1mYc8hWf7kTzL4pRa6uVd5oGi2sNtE"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "deploy bot"
+                },
+                "revokedAt": {
+                    "type": "string",
+                    "example": "2021-08-22T18:21:05+07:00"
+                },
+                "role": {
+                    "type": "string",
+                    "example": "editor"
+                },
+                "rotatedAt": {
+                    "type": "string",
+                    "example": "2021-08-21T18:21:05+07:00"
+                },
+                "tenant": {
+                    "type": "string",
+                    "example": "marketing"
+                }
+            }
+        },
+        "model.BulkShortenOutput": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.BulkShortenResult"
+                    }
+                },
+                "summary": {
+                    "$ref": "#/definitions/model.BulkSummary"
+                }
+            }
+        },
+        "model.BulkShortenResult": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/model.ShortenOutput"
+                },
+                "error": {
+                    "$ref": "#/definitions/customError.Response"
+                },
+                "row": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "model.BulkSummary": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "succeeded": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "model.BulkUpdateInput": {
+            "type": "object",
+            "required": [
+                "action"
+            ],
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "setExpiry"
+                },
+                "dryRun": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "expiry": {
+                    "description": "Expiry is a new expiry of setExpiry, empty for never",
+                    "type": "string",
+                    "example": "2021-09-01T00:00:00Z"
+                },
+                "shortCodes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "summer-sale",
+                        "4oEQByEs"
+                    ]
+                }
+            }
+        },
+        "model.BulkUpdateOutput": {
+            "type": "object",
+            "properties": {
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.BulkUpdateResult"
+                    }
+                },
+                "summary": {
+                    "$ref": "#/definitions/model.BulkSummary"
+                }
+            }
+        },
+        "model.BulkUpdateResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/customError.Response"
+                },
+                "object": {
+                    "description": "Object is an url object before it's changed",
+                    "$ref": "#/definitions/model.UrlObject"
+                },
+                "shortCode": {
+                    "type": "string",
+                    "example": "summer-sale"
+                }
+            }
+        },
+        "model.Page": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "description": "Limit is the maximum number of items in a page",
+                    "type": "integer",
+                    "example": 50
+                },
+                "nextCursor": {
+                    "description": "NextCursor is a cursor of the next page, it is empty on the last page",
+                    "type": "string",
+                    "example": "eyJzIjoiaGl0cyJ9"
+                },
+                "total": {
+                    "description": "Total is the number of all matched items",
+                    "type": "integer",
+                    "example": 1024
+                },
+                "totalApproximate": {
+                    "description": "TotalApproximate is true if a filtered listing has too many items to scan, its total then only counts\nitems matched in the scanned ones",
+                    "type": "boolean",
+                    "example": false
                 }
             }
         },
@@ -213,13 +1845,18 @@ var doc = `{
             "type": "object",
             "properties": {
                 "code": {
-                    "type": "integer"
+                    "type": "string",
+                    "example": "ok"
                 },
                 "data": {
                     "type": "object"
                 },
                 "message": {
                     "type": "string"
+                },
+                "page": {
+                    "description": "Page is only responded by listing APIs",
+                    "$ref": "#/definitions/model.Page"
                 }
             }
         },
@@ -228,16 +1865,210 @@ var doc = `{
             "required": [
                 "url"
             ],
+            "properties": {
+                "alias": {
+                    "type": "string",
+                    "example": "summer-sale"
+                },
+                "dedupe": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "domain": {
+                    "type": "string",
+                    "example": "go.example.com"
+                },
+                "expiry": {
+                    "type": "string",
+                    "example": "2021-08-21T18:21:05+07:00"
+                },
+                "folder": {
+                    "type": "string",
+                    "example": "campaigns/summer"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "summer",
+                        "email"
+                    ]
+                },
+                "url": {
+                    "type": "string",
+                    "example": "http://www.facebook.com"
+                }
+            }
+        },
+        "model.ShortenOutput": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2021-08-20T18:21:05+07:00"
+                },
+                "expiry": {
+                    "type": "string",
+                    "example": "2021-08-21T18:21:05+07:00"
+                },
+                "folder": {
+                    "type": "string",
+                    "example": "campaigns/summer"
+                },
+                "fullUrl": {
+                    "type": "string",
+                    "example": "http://www.facebook.com/"
+                },
+                "previewUrl": {
+                    "type": "string",
+                    "example": "http://localhost:8080/4oEQByEs/preview"
+                },
+                "qrCodeUrl": {
+                    "type": "string",
+                    "example": "http://localhost:8080/4oEQByEs/qr"
+                },
+                "shortCode": {
+                    "type": "string",
+                    "example": "4oEQByEs"
+                },
+                "shortUrl": {
+                    "type": "string",
+                    "example": "http://localhost:8080/4oEQByEs"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "summer",
+                        "email"
+                    ]
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "model.TagStats": {
+            "type": "object",
+            "properties": {
+                "hits": {
+                    "description": "Hits is the sum of hits of short codes with a tag",
+                    "type": "integer",
+                    "example": 340
+                },
+                "tag": {
+                    "type": "string",
+                    "example": "summer"
+                },
+                "urls": {
+                    "description": "Urls is the number of short codes with a tag",
+                    "type": "integer",
+                    "example": 12
+                }
+            }
+        },
+        "model.TagsInput": {
+            "type": "object",
+            "required": [
+                "tags"
+            ],
+            "properties": {
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "summer",
+                        "email"
+                    ]
+                }
+            }
+        },
+        "model.UpdateInput": {
+            "type": "object",
             "properties": {
                 "expiry": {
                     "type": "string",
                     "example": "2021-08-21T18:21:05+07:00"
                 },
+                "folder": {
+                    "type": "string",
+                    "example": "campaigns/summer"
+                },
                 "url": {
                     "type": "string",
                     "example": "http://www.facebook.com"
                 }
             }
+        },
+        "model.UrlObject": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "description": "DeletedAt is when a short code was deleted, it is only set in deleted url objects",
+                    "type": "string"
+                },
+                "deletedBy": {
+                    "description": "DeletedBy is a subject of a caller who deleted a short code",
+                    "type": "string"
+                },
+                "domain": {
+                    "description": "Domain is a short domain of a short code, it is empty for the default domain",
+                    "type": "string"
+                },
+                "expiry": {
+                    "type": "string"
+                },
+                "folder": {
+                    "description": "Folder is a ` + "`" + `/` + "`" + ` separated path of a folder of a short code, it is empty if a short code isn't in a folder",
+                    "type": "string"
+                },
+                "fullUrl": {
+                    "type": "string"
+                },
+                "hits": {
+                    "type": "integer"
+                },
+                "owner": {
+                    "description": "Owner is a subject of a caller who created a short code, it is empty for anonymous callers",
+                    "type": "string"
+                },
+                "shortCode": {
+                    "type": "string"
+                },
+                "tags": {
+                    "description": "Tags are lowercase labels grouping short codes, e.g. campaigns",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tenant": {
+                    "description": "Tenant is an id of a tenant of a short code, it is empty for the default tenant",
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Default is a domain of short urls built from PUBLIC_BASE_URL or a request host, its keys have no prefix
+const Default = ""
+
+// namePattern allows lowercase host names of letters, digits, `-` and `.`, a name is a part of storage keys
+var namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// List is an allow-list of short domains other than the default one
+type List []string
+
+// NewList validates and normalizes names of short domains
+func NewList(names []string) (List, error) {
+	list := make(List, 0, len(names))
+	for _, name := range names {
+		normalized := Normalize(name)
+		if !namePattern.MatchString(normalized) {
+			return nil, fmt.Errorf("invalid short domain: %s", name)
+		}
+		list = append(list, normalized)
+	}
+	return list, nil
+}
+
+// Contains reports whether a domain is allowed, the default domain is always allowed
+func (l List) Contains(name string) bool {
+	if name == Default {
+		return true
+	}
+	for _, allowed := range l {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns a domain of a request host, the default domain is returned if a host isn't in a list
+func (l List) Match(host string) string {
+	name := Normalize(host)
+	if l.Contains(name) {
+		return name
+	}
+	return Default
+}
+
+// Normalize lowercases a host and removes its port and trailing dot
+func Normalize(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// contextKey is a key of a domain in a context
+type contextKey struct{}
+
+// NewContext returns a context of requests to a short domain
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// FromContext returns a short domain of a context, it is the default domain if a context has no domain
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(contextKey{}).(string)
+	return name
+}
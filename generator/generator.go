@@ -0,0 +1,143 @@
+package generator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"url-shortener/repository"
+
+	"github.com/catinello/base62"
+)
+
+// MaxLength is the longest code whose code space fits in uint64
+const MaxLength = 10
+
+// key of a sequence counting generated codes of counterGenerator
+const sequenceKey = "sequence:shortCode"
+
+// Generator is an interface for generating new short codes.
+// A generated code may collide with an existing one, callers must claim it atomically.
+type Generator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// New initiates a generator of specified strategy, random is used by default
+func New(strategy string, repo repository.Repository, length int, salt string) (Generator, error) {
+	switch strategy {
+	case "", "random":
+		return NewRandom(length)
+	case "counter":
+		return NewCounter(repo, length, salt)
+	default:
+		return nil, fmt.Errorf("unknown code strategy: %s", strategy)
+	}
+}
+
+// randomGenerator generates fixed-length codes of random base62 characters
+type randomGenerator struct {
+	length int
+}
+
+// NewRandom initiates a generator of random codes with `length` characters
+func NewRandom(length int) (Generator, error) {
+	if length < 1 || length > MaxLength {
+		return nil, fmt.Errorf("code length must be between 1 and %d", MaxLength)
+	}
+	return &randomGenerator{length: length}, nil
+}
+
+// Generate returns a random code
+func (g *randomGenerator) Generate(ctx context.Context) (string, error) {
+	max := big.NewInt(int64(base62.Base))
+	code := make([]byte, g.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to read random, err: %v", err)
+		}
+		code[i] = base62.CharacterSet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// counterGenerator generates codes from an atomic sequence saved in a repository.
+// Each number of the sequence is mapped to a distinct fixed-length code, so codes never collide
+// with each other until the code space is exhausted.
+type counterGenerator struct {
+	repository repository.Repository
+	length     int
+	space      uint64 // number of codes with `length` characters
+	multiplier uint64 // coprime with space, 1 if codes are not obfuscated
+	offset     uint64
+}
+
+// NewCounter initiates a generator of sequential codes with `length` characters.
+// If `salt` is not empty, consecutive numbers are shuffled over the code space by the salt
+// so that consecutive codes don't look sequential.
+func NewCounter(repo repository.Repository, length int, salt string) (Generator, error) {
+	if length < 1 || length > MaxLength {
+		return nil, fmt.Errorf("code length must be between 1 and %d", MaxLength)
+	}
+
+	g := &counterGenerator{
+		repository: repo,
+		length:     length,
+		space:      1,
+		multiplier: 1,
+	}
+	for i := 0; i < length; i++ {
+		g.space *= uint64(base62.Base)
+	}
+
+	if salt != "" {
+		sum := sha256.Sum256([]byte(salt))
+		g.multiplier = binary.BigEndian.Uint64(sum[:8]) % g.space
+		g.offset = binary.BigEndian.Uint64(sum[8:16]) % g.space
+		// n*multiplier+offset is a bijection over the code space only if multiplier is coprime with it,
+		// i.e. divisible by neither 2 nor 31
+		for g.multiplier%2 == 0 || g.multiplier%31 == 0 {
+			g.multiplier = (g.multiplier + 1) % g.space
+		}
+	}
+
+	return g, nil
+}
+
+// Generate returns the code of the next number of the sequence
+func (g *counterGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.repository.Incr(ctx, sequenceKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get next sequence, err: %v", err)
+	}
+	// the sequence starts from 1
+	if uint64(n) > g.space {
+		return "", fmt.Errorf("all %d codes with %d characters are used", g.space, g.length)
+	}
+
+	return encode(g.permute(uint64(n-1)), g.length), nil
+}
+
+// permute maps `n` to (n*multiplier + offset) mod space without overflow
+func (g *counterGenerator) permute(n uint64) uint64 {
+	hi, lo := bits.Mul64(n, g.multiplier)
+	_, rem := bits.Div64(hi, lo, g.space)
+	rem, carry := bits.Add64(rem, g.offset, 0)
+	if carry != 0 || rem >= g.space {
+		rem -= g.space
+	}
+	return rem
+}
+
+// encode returns a base62 representation of `n` padded to `length` characters
+func encode(n uint64, length int) string {
+	code := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		code[i] = base62.CharacterSet[n%uint64(base62.Base)]
+		n /= uint64(base62.Base)
+	}
+	return string(code)
+}
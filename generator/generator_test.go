@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"url-shortener/repository"
+
+	"github.com/catinello/base62"
+	"gotest.tools/assert"
+)
+
+func TestRandom(t *testing.T) {
+	g, err := NewRandom(8)
+	if err != nil {
+		t.Fatalf("failed to init generator, err: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		code, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("failed to generate, err: %v", err)
+		}
+		assert.Equal(t, 8, len(code))
+		for _, c := range code {
+			assert.Assert(t, strings.ContainsRune(base62.CharacterSet, c), code)
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	for _, salt := range []string{"", "secret"} {
+		t.Run(salt, func(t *testing.T) {
+			g, err := NewCounter(repository.NewMemory(), 2, salt)
+			if err != nil {
+				t.Fatalf("failed to init generator, err: %v", err)
+			}
+			ctx := context.Background()
+
+			// every code of the code space is generated exactly once
+			seen := make(map[string]bool)
+			for i := 0; i < 62*62; i++ {
+				code, err := g.Generate(ctx)
+				if err != nil {
+					t.Fatalf("failed to generate, err: %v", err)
+				}
+				assert.Equal(t, 2, len(code))
+				assert.Assert(t, !seen[code], "duplicate code %s", code)
+				seen[code] = true
+			}
+
+			_, err = g.Generate(ctx)
+			assert.ErrorContains(t, err, "all 3844 codes")
+		})
+	}
+}
+
+func TestCounter_Obfuscated(t *testing.T) {
+	plain, _ := NewCounter(repository.NewMemory(), 8, "")
+	salted, _ := NewCounter(repository.NewMemory(), 8, "secret")
+	ctx := context.Background()
+
+	code, _ := plain.Generate(ctx)
+	assert.Equal(t, "00000000", code)
+	code, _ = plain.Generate(ctx)
+	assert.Equal(t, "00000001", code)
+
+	first, _ := salted.Generate(ctx)
+	second, _ := salted.Generate(ctx)
+	assert.Assert(t, first != "00000000")
+	assert.Assert(t, second != "00000001")
+	assert.Assert(t, first != second)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New("sequential", repository.NewMemory(), 8, "")
+	assert.ErrorContains(t, err, "unknown code strategy")
+
+	_, err = New("random", repository.NewMemory(), MaxLength+1, "")
+	assert.ErrorContains(t, err, "code length")
+}
@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+	"url-shortener/audit"
+	"url-shortener/auth"
 	"url-shortener/controller"
+	"url-shortener/domain"
+	"url-shortener/generator"
 	"url-shortener/repository"
 	"url-shortener/service"
+	"url-shortener/tenant"
 
 	"github.com/spf13/viper"
 
+	_ "github.com/lib/pq"           // postgres driver
+	_ "github.com/mattn/go-sqlite3" // sqlite driver
+
 	"github.com/swaggo/files"       // swagger embed files
 	"github.com/swaggo/gin-swagger" // gin-swagger middleware
 
@@ -19,6 +36,17 @@ import (
 // @version 1.0
 // @description Basic url shortener.
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+
+// shutdownTimeout is how long requests in flight are waited for on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func init() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("json")
@@ -30,23 +58,187 @@ func init() {
 }
 
 func main() {
-	redisAddress := viper.GetString("REDIS_ADDRESS")
-
-	repo, err := repository.NewPool(redisAddress)
+	repo, err := newRepository(viper.GetString("STORAGE"))
 	if err != nil {
 		log.Fatalf("failed to init repository, err: %v", err)
 	}
-	serv := service.New(repo)
-	ctrl := controller.New(serv)
+	defer repo.Close()
+	codeLength := viper.GetInt("CODE_LENGTH")
+	if codeLength <= 0 {
+		codeLength = 8
+	}
+	gen, err := generator.New(viper.GetString("CODE_STRATEGY"), repo, codeLength, viper.GetString("CODE_SALT"))
+	if err != nil {
+		log.Fatalf("failed to init code generator, err: %v", err)
+	}
+	var tenantConfigs []tenant.Tenant
+	if err := viper.UnmarshalKey("TENANTS", &tenantConfigs); err != nil {
+		log.Fatalf("failed to read tenants, err: %v", err)
+	}
+	tenants, err := tenant.NewRegistry(tenantConfigs)
+	if err != nil {
+		log.Fatalf("failed to init tenants, err: %v", err)
+	}
+	domains, err := domain.NewList(viper.GetStringSlice("DOMAINS"))
+	if err != nil {
+		log.Fatalf("failed to init short domains, err: %v", err)
+	}
+	// audit entries of changes in bulk are saved in the repository unless a file is configured
+	recorder := audit.NewRepositoryRecorder(repo)
+	if path := viper.GetString("AUDIT_LOG"); path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("failed to open audit log, err: %v", err)
+		}
+		defer file.Close()
+		recorder = audit.NewLogRecorder(file)
+	}
+	config := service.Config{
+		LegacyKeyFallback: viper.GetBool("LEGACY_KEY_FALLBACK"),
+		Dedupe:            viper.GetBool("DEDUPE"),
+		Generator:         gen,
+		Tenants:           tenants,
+		Domains:           domains,
+		DeletedRetention:  viper.GetDuration("DELETED_RETENTION"),
+		Audit:             recorder,
+	}
+	// serve popular short codes from memory if cache is enabled, a service is built once either way
+	var serv service.Service
+	if cacheSize := viper.GetInt("CACHE_SIZE"); cacheSize > 0 {
+		cached := service.NewCached(
+			repo,
+			config,
+			cacheSize,
+			viper.GetDuration("CACHE_TTL"),
+			viper.GetDuration("CACHE_FLUSH_INTERVAL"),
+		)
+		defer cached.Close(context.Background())
+
+		expvar.Publish("cache", expvar.Func(func() interface{} {
+			return cached.Stats()
+		}))
+		serv = cached
+	} else {
+		serv = service.New(repo, config)
+	}
+
+	// deleted short codes are purged once their retention expires even if they're never listed or used
+	if config.DeletedRetention > 0 {
+		sweeper := service.NewRetentionSweeper(serv, viper.GetDuration("RETENTION_SWEEP_INTERVAL"))
+		defer sweeper.Close()
+	}
+
+	// a bootstrap key from config is used to create the first API keys
+	keys := auth.NewKeyStore(repo)
+	authenticators := []auth.Authenticator{keys}
+	if bootstrapKey := viper.GetString("BOOTSTRAP_API_KEY"); bootstrapKey != "" {
+		authenticators = append([]auth.Authenticator{auth.NewStaticKey(bootstrapKey)}, authenticators...)
+	}
+	// bearer tokens issued by an identity provider are verified by its public keys
+	jwksFile := viper.GetString("JWT_JWKS_FILE")
+	publicKeyFiles := viper.GetStringSlice("JWT_PUBLIC_KEY_FILES")
+	if jwksFile != "" || len(publicKeyFiles) > 0 {
+		jwtAuthenticator, err := auth.NewJWT(auth.JWTConfig{
+			JWKSFile:       jwksFile,
+			PublicKeyFiles: publicKeyFiles,
+			Issuer:         viper.GetString("JWT_ISSUER"),
+			Audience:       viper.GetString("JWT_AUDIENCE"),
+			RolesClaim:     viper.GetString("JWT_ROLES_CLAIM"),
+			RoleMapping:    viper.GetStringMapString("JWT_ROLE_MAPPING"),
+			TenantClaim:    viper.GetString("JWT_TENANT_CLAIM"),
+		})
+		if err != nil {
+			log.Fatalf("failed to initiate jwt authentication, err: %v", err)
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+
+	ctrl := controller.New(serv, keys, controller.Config{
+		PublicBaseURL: viper.GetString("PUBLIC_BASE_URL"),
+		ProblemJSON:   viper.GetBool("PROBLEM_JSON"),
+		Authenticator: auth.Chain(authenticators...),
+		Tenants:       tenants,
+		Domains:       domains,
+	})
 
 	url := ginSwagger.URL("doc.json") // The url pointing to API definition
 
 	router := gin.Default()
-	router.POST("/shorten", ctrl.Shorten)
+	// a short domain is selected by a request host for every route
+	router.Use(ctrl.Domain)
+	router.POST("/shorten", ctrl.Identify, ctrl.Shorten)
+	router.POST("/shorten/bulk", ctrl.Authenticate, ctrl.Authorize, ctrl.ShortenBulk)
 	router.GET("/:shortCode", ctrl.Redirect)
-	router.GET("/admin/urls", ctrl.GetUrls)
-	router.DELETE("/:shortCode", ctrl.DeleteUrl)
+	router.GET("/:shortCode/qr", ctrl.QRCode)
+	router.GET("/:shortCode/preview", ctrl.Preview)
+	// deprecated, use DELETE /admin/urls/:shortCode
+	router.DELETE("/:shortCode", ctrl.Authenticate, ctrl.Authorize, ctrl.DeleteUrl)
+
+	admin := router.Group("/admin", ctrl.Authenticate, ctrl.Authorize)
+	admin.GET("/urls", ctrl.GetUrls)
+	admin.DELETE("/urls/:shortCode", ctrl.DeleteUrl)
+	admin.PATCH("/urls/:shortCode", ctrl.UpdateUrl)
+	admin.POST("/urls/bulk", ctrl.BulkUpdateUrls)
+	admin.GET("/urls/deleted", ctrl.GetDeletedUrls)
+	admin.POST("/urls/:shortCode/restore", ctrl.RestoreUrl)
+	admin.POST("/urls/:shortCode/purge", ctrl.PurgeUrl)
+	admin.POST("/urls/:shortCode/tags", ctrl.AddTags)
+	admin.DELETE("/urls/:shortCode/tags/:tag", ctrl.RemoveTag)
+	admin.GET("/tags", ctrl.GetTags)
+	admin.POST("/keys", ctrl.CreateAPIKey)
+	admin.GET("/keys", ctrl.GetAPIKeys)
+	admin.DELETE("/keys/:id", ctrl.RevokeAPIKey)
+	admin.POST("/keys/:id/rotate", ctrl.RotateAPIKey)
+	// expvar exposes a command line and memory stats of a process, so only admins can see it
+	admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
-	router.Run(":8080")
+
+	// pending hits of the cache are flushed and the repository is closed by deferred calls after shutdown
+	server := &http.Server{Addr: ":8080", Handler: router}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		log.Printf("shutting down on %v", sig)
+	case err := <-serveErr:
+		log.Printf("failed to serve, err: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("failed to shut down server, err: %v", err)
+	}
+}
+
+// newRepository initiates a repository of specified storage, redis is used by default
+func newRepository(storage string) (repository.Repository, error) {
+	switch storage {
+	case "", "redis":
+		return repository.NewPool(viper.GetString("REDIS_ADDRESS"))
+	case "memory":
+		return repository.NewMemory(), nil
+	case "sqlite":
+		return repository.NewSQL("sqlite3", viper.GetString("SQL_DSN"))
+	case "postgres":
+		return repository.NewSQL("postgres", viper.GetString("SQL_DSN"))
+	case "bolt":
+		dataDir := viper.GetString("DATA_DIR")
+		if err := os.MkdirAll(dataDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create data dir, err: %v", err)
+		}
+		sweepInterval := viper.GetDuration("SWEEP_INTERVAL")
+		if sweepInterval <= 0 {
+			sweepInterval = time.Minute
+		}
+		return repository.NewBolt(filepath.Join(dataDir, "shortener.db"), sweepInterval)
+	default:
+		return nil, fmt.Errorf("unknown storage: %s", storage)
+	}
 }
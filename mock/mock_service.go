@@ -36,6 +36,21 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 	return m.recorder
 }
 
+// BulkUpdate mocks base method.
+func (m *MockService) BulkUpdate(arg0 context.Context, arg1 model.BulkUpdateRequest) ([]model.BulkUpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkUpdate", arg0, arg1)
+	ret0, _ := ret[0].([]model.BulkUpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkUpdate indicates an expected call of BulkUpdate.
+func (mr *MockServiceMockRecorder) BulkUpdate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkUpdate", reflect.TypeOf((*MockService)(nil).BulkUpdate), arg0, arg1)
+}
+
 // Decode mocks base method.
 func (m *MockService) Decode(arg0 context.Context, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -52,25 +67,25 @@ func (mr *MockServiceMockRecorder) Decode(arg0, arg1 interface{}) *gomock.Call {
 }
 
 // DeleteUrl mocks base method.
-func (m *MockService) DeleteUrl(arg0 context.Context, arg1 string) (bool, error) {
+func (m *MockService) DeleteUrl(arg0 context.Context, arg1, arg2 string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUrl", arg0, arg1)
+	ret := m.ctrl.Call(m, "DeleteUrl", arg0, arg1, arg2)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DeleteUrl indicates an expected call of DeleteUrl.
-func (mr *MockServiceMockRecorder) DeleteUrl(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) DeleteUrl(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUrl", reflect.TypeOf((*MockService)(nil).DeleteUrl), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUrl", reflect.TypeOf((*MockService)(nil).DeleteUrl), arg0, arg1, arg2)
 }
 
 // Encode mocks base method.
-func (m *MockService) Encode(arg0 context.Context, arg1 string, arg2 *time.Time) (string, error) {
+func (m *MockService) Encode(arg0 context.Context, arg1 string, arg2 model.EncodeOptions) (*model.UrlObject, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Encode", arg0, arg1, arg2)
-	ret0, _ := ret[0].(string)
+	ret0, _ := ret[0].(*model.UrlObject)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -81,17 +96,166 @@ func (mr *MockServiceMockRecorder) Encode(arg0, arg1, arg2 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encode", reflect.TypeOf((*MockService)(nil).Encode), arg0, arg1, arg2)
 }
 
-// GetUrlObjects mocks base method.
-func (m *MockService) GetUrlObjects(arg0 context.Context, arg1, arg2 *string) ([]*model.UrlObject, error) {
+// EncodeBulk mocks base method.
+func (m *MockService) EncodeBulk(arg0 context.Context, arg1 []model.EncodeRequest) []model.EncodeResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EncodeBulk", arg0, arg1)
+	ret0, _ := ret[0].([]model.EncodeResult)
+	return ret0
+}
+
+// EncodeBulk indicates an expected call of EncodeBulk.
+func (mr *MockServiceMockRecorder) EncodeBulk(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EncodeBulk", reflect.TypeOf((*MockService)(nil).EncodeBulk), arg0, arg1)
+}
+
+// GetDeletedUrl mocks base method.
+func (m *MockService) GetDeletedUrl(arg0 context.Context, arg1 string) (*model.UrlObject, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedUrl", arg0, arg1)
+	ret0, _ := ret[0].(*model.UrlObject)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedUrl indicates an expected call of GetDeletedUrl.
+func (mr *MockServiceMockRecorder) GetDeletedUrl(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedUrl", reflect.TypeOf((*MockService)(nil).GetDeletedUrl), arg0, arg1)
+}
+
+// GetDeletedUrls mocks base method.
+func (m *MockService) GetDeletedUrls(arg0 context.Context, arg1, arg2 *string) ([]*model.UrlObject, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUrlObjects", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetDeletedUrls", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]*model.UrlObject)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetDeletedUrls indicates an expected call of GetDeletedUrls.
+func (mr *MockServiceMockRecorder) GetDeletedUrls(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedUrls", reflect.TypeOf((*MockService)(nil).GetDeletedUrls), arg0, arg1, arg2)
+}
+
+// GetTagStats mocks base method.
+func (m *MockService) GetTagStats(arg0 context.Context, arg1, arg2 *string) ([]*model.TagStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTagStats", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*model.TagStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTagStats indicates an expected call of GetTagStats.
+func (mr *MockServiceMockRecorder) GetTagStats(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTagStats", reflect.TypeOf((*MockService)(nil).GetTagStats), arg0, arg1, arg2)
+}
+
+// GetUrlObject mocks base method.
+func (m *MockService) GetUrlObject(arg0 context.Context, arg1 string) (*model.UrlObject, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUrlObject", arg0, arg1)
+	ret0, _ := ret[0].(*model.UrlObject)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUrlObject indicates an expected call of GetUrlObject.
+func (mr *MockServiceMockRecorder) GetUrlObject(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrlObject", reflect.TypeOf((*MockService)(nil).GetUrlObject), arg0, arg1)
+}
+
+// GetUrlObjects mocks base method.
+func (m *MockService) GetUrlObjects(arg0 context.Context, arg1 model.UrlQuery) ([]*model.UrlObject, *model.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUrlObjects", arg0, arg1)
+	ret0, _ := ret[0].([]*model.UrlObject)
+	ret1, _ := ret[1].(*model.Page)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
 // GetUrlObjects indicates an expected call of GetUrlObjects.
-func (mr *MockServiceMockRecorder) GetUrlObjects(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) GetUrlObjects(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrlObjects", reflect.TypeOf((*MockService)(nil).GetUrlObjects), arg0, arg1)
+}
+
+// PurgeExpiredUrls mocks base method.
+func (m *MockService) PurgeExpiredUrls(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeExpiredUrls", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeExpiredUrls indicates an expected call of PurgeExpiredUrls.
+func (mr *MockServiceMockRecorder) PurgeExpiredUrls(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeExpiredUrls", reflect.TypeOf((*MockService)(nil).PurgeExpiredUrls), arg0)
+}
+
+// PurgeUrl mocks base method.
+func (m *MockService) PurgeUrl(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUrl", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeUrl indicates an expected call of PurgeUrl.
+func (mr *MockServiceMockRecorder) PurgeUrl(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUrl", reflect.TypeOf((*MockService)(nil).PurgeUrl), arg0, arg1)
+}
+
+// RestoreUrl mocks base method.
+func (m *MockService) RestoreUrl(arg0 context.Context, arg1 string) (*model.UrlObject, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUrl", arg0, arg1)
+	ret0, _ := ret[0].(*model.UrlObject)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreUrl indicates an expected call of RestoreUrl.
+func (mr *MockServiceMockRecorder) RestoreUrl(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUrl", reflect.TypeOf((*MockService)(nil).RestoreUrl), arg0, arg1)
+}
+
+// Update mocks base method.
+func (m *MockService) Update(arg0 context.Context, arg1 string, arg2 model.UpdateOptions) (*model.UrlObject, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*model.UrlObject)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockServiceMockRecorder) Update(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockService)(nil).Update), arg0, arg1, arg2)
+}
+
+// UpdateExpiry mocks base method.
+func (m *MockService) UpdateExpiry(arg0 context.Context, arg1 string, arg2 *time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateExpiry", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateExpiry indicates an expected call of UpdateExpiry.
+func (mr *MockServiceMockRecorder) UpdateExpiry(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrlObjects", reflect.TypeOf((*MockService)(nil).GetUrlObjects), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateExpiry", reflect.TypeOf((*MockService)(nil).UpdateExpiry), arg0, arg1, arg2)
 }
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// APIKeyInput is a struct for creating an API key
+type APIKeyInput struct {
+	Name string `json:"name" binding:"required" example:"deploy bot"`
+	// Role is one of viewer, editor, admin and superadmin, it is viewer by default
+	Role string `json:"role" binding:"omitempty,oneof=viewer editor admin superadmin" example:"editor"`
+	// Tenant is an id of a tenant of a key, it is a tenant of a caller by default
+	Tenant *string `json:"tenant" example:"marketing"`
+}
+
+// APIKeyOutput is a struct for an API key in API responses, its secret key is only returned on creation and rotation
+type APIKeyOutput struct {
+	ID        string     `json:"id" example:"3f9a1c2b7d4e"`
+	Name      string     `json:"name" example:"deploy bot"`
+	Role      string     `json:"role" example:"editor"`
+	Tenant    string     `json:"tenant,omitempty" example:"marketing"`
+	Key       string     `json:"key,omitempty" example:"3f9a1c2b7d4e.Jx3v9Qe0bq2nS1mYc8hWf7kTzL4pRa6uVd5oGi2sNtE"`
+	CreatedAt time.Time  `json:"createdAt" example:"2021-08-20T18:21:05+07:00"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty" example:"2021-08-21T18:21:05+07:00"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" example:"2021-08-22T18:21:05+07:00"`
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"time"
+	"url-shortener/customError"
+)
+
+// EncodeRequest is a validated row of bulk shortening
+type EncodeRequest struct {
+	FullURL string
+	// Domain is a short domain of a new short code
+	Domain  string
+	Options EncodeOptions
+}
+
+// EncodeResult is a saved url object of an EncodeRequest or an error of it
+type EncodeResult struct {
+	Object *UrlObject
+	Err    error
+}
+
+// BulkShortenOutput is a result of each row of bulk shortening and their summary
+type BulkShortenOutput struct {
+	Summary BulkSummary         `json:"summary"`
+	Results []BulkShortenResult `json:"results"`
+}
+
+// BulkSummary counts rows of bulk shortening
+type BulkSummary struct {
+	Total     int `json:"total" example:"3"`
+	Succeeded int `json:"succeeded" example:"2"`
+	Failed    int `json:"failed" example:"1"`
+}
+
+// BulkShortenResult is a short url of a row or an error of it, rows are numbered from 1 without a CSV header
+type BulkShortenResult struct {
+	Row   int                   `json:"row" example:"1"`
+	Data  *ShortenOutput        `json:"data,omitempty"`
+	Error *customError.Response `json:"error,omitempty"`
+}
+
+// Bulk actions of changing short codes
+const (
+	BulkDelete    = "delete"
+	BulkExpire    = "expire"
+	BulkSetExpiry = "setExpiry"
+)
+
+// BulkUpdateInput is an input of changing listed short codes, or short codes matching query params of filters
+type BulkUpdateInput struct {
+	Action     string   `json:"action" binding:"required,oneof=delete expire setExpiry" example:"setExpiry"`
+	ShortCodes []string `json:"shortCodes" example:"summer-sale,4oEQByEs"`
+	// Expiry is a new expiry of setExpiry, empty for never
+	Expiry string `json:"expiry" example:"2021-09-01T00:00:00Z"`
+	DryRun bool   `json:"dryRun" example:"true"`
+}
+
+// BulkUpdateRequest is a validated change of short codes
+type BulkUpdateRequest struct {
+	// Action is one of BulkDelete, BulkExpire and BulkSetExpiry
+	Action string
+	// ShortCodes are changed short codes in a domain of a context, Query is used instead if it's empty
+	ShortCodes []string
+	// Query matches changed short codes, its page is ignored
+	Query UrlQuery
+	// Owner rejects listed short codes of other owners, nil for any owner
+	Owner *string
+	// Expiry is a new expiry of BulkSetExpiry, nil for never
+	Expiry *time.Time
+	// DryRun reports short codes which would be changed without changing them
+	DryRun bool
+	// Actor is a subject of a caller recorded in audit entries
+	Actor string
+}
+
+// BulkUpdateResult is a short code which is changed, or would be changed in a dry run, or an error of it
+type BulkUpdateResult struct {
+	ShortCode string `json:"shortCode" example:"summer-sale"`
+	// Object is an url object before it's changed
+	Object *UrlObject            `json:"object,omitempty"`
+	Error  *customError.Response `json:"error,omitempty"`
+	// Err is an error of a short code which is converted to Error in a response
+	Err error `json:"-"`
+}
+
+// BulkUpdateOutput is a result of each changed short code and their summary
+type BulkUpdateOutput struct {
+	DryRun  bool               `json:"dryRun"`
+	Summary BulkSummary        `json:"summary"`
+	Results []BulkUpdateResult `json:"results"`
+}
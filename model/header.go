@@ -1,6 +0,0 @@
-package model
-
-// Header is a struct for header input
-type Header struct {
-	Token string `header:"Token"`
-}
@@ -1,8 +1,26 @@
 package model
 
+// CodeOK is a code of successful responses, it has the same type as codes of error responses
+const CodeOK = "ok"
+
 // Response is a struct for common API response
 type Response struct {
-	Code    uint64      `json:"code"`
+	Code    string      `json:"code" example:"ok"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	// Page is only responded by listing APIs
+	Page *Page `json:"page,omitempty"`
+}
+
+// Page is a position of a page of listed data
+type Page struct {
+	// Total is the number of all matched items
+	Total *int `json:"total,omitempty" example:"1024"`
+	// TotalApproximate is true if a filtered listing has too many items to scan, its total then only counts
+	// items matched in the scanned ones
+	TotalApproximate bool `json:"totalApproximate,omitempty" example:"false"`
+	// Limit is the maximum number of items in a page
+	Limit int `json:"limit" example:"50"`
+	// NextCursor is a cursor of the next page, it is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty" example:"eyJzIjoiaGl0cyJ9"`
 }
@@ -1,6 +1,29 @@
 package model
 
+import "time"
+
 type ShortenInput struct {
-	Url    string `json:"url" binding:"required" example:"http://www.facebook.com"`
-	Expiry string `json:"expiry" example:"2021-08-21T18:21:05+07:00"`
+	Url    string   `json:"url" binding:"required" example:"http://www.facebook.com"`
+	Expiry string   `json:"expiry" example:"2021-08-21T18:21:05+07:00"`
+	Alias  string   `json:"alias" example:"summer-sale"`
+	Dedupe *bool    `json:"dedupe" example:"true"`
+	Domain string   `json:"domain" example:"go.example.com"`
+	Tags   []string `json:"tags" example:"summer,email"`
+	Folder string   `json:"folder" example:"campaigns/summer"`
+}
+
+// EncodeOptions is optional settings of a new short code
+type EncodeOptions struct {
+	// Expiry is when a short code expires, nil for never
+	Expiry *time.Time
+	// Alias is a custom short code, a random one is generated if nil
+	Alias *string
+	// Dedupe returns an existing short code of the same full url, the service default is used if nil
+	Dedupe *bool
+	// Owner is a subject of a caller creating a short code, empty for anonymous callers
+	Owner string
+	// Tags are validated and normalized tags of a short code
+	Tags []string
+	// Folder is a validated folder of a short code, empty for none
+	Folder string
 }
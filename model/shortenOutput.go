@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// ShortenOutputVersion is a version of ShortenOutput schema, it is increased on every breaking change
+const ShortenOutputVersion = 1
+
+// ShortenOutput is a struct for a shortened url in API responses
+type ShortenOutput struct {
+	Version    int        `json:"version" example:"1"`
+	ShortCode  string     `json:"shortCode" example:"4oEQByEs"`
+	ShortURL   string     `json:"shortUrl" example:"http://localhost:8080/4oEQByEs"`
+	FullURL    string     `json:"fullUrl" example:"http://www.facebook.com/"`
+	Expiry     *time.Time `json:"expiry,omitempty" example:"2021-08-21T18:21:05+07:00"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty" example:"2021-08-20T18:21:05+07:00"`
+	QRCodeURL  string     `json:"qrCodeUrl" example:"http://localhost:8080/4oEQByEs/qr"`
+	PreviewURL string     `json:"previewUrl" example:"http://localhost:8080/4oEQByEs/preview"`
+	Tags       []string   `json:"tags,omitempty" example:"summer,email"`
+	Folder     string     `json:"folder,omitempty" example:"campaigns/summer"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// TagStats is an aggregate of short codes with a tag
+type TagStats struct {
+	Tag string `json:"tag" example:"summer"`
+	// Urls is the number of short codes with a tag
+	Urls int `json:"urls" example:"12"`
+	// Hits is the sum of hits of short codes with a tag
+	Hits uint64 `json:"hits" example:"340"`
+}
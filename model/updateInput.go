@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// UpdateInput is an input of updating a short code, fields which aren't specified are unchanged
+type UpdateInput struct {
+	Url    *string `json:"url" example:"http://www.facebook.com"`
+	Expiry *string `json:"expiry" example:"2021-08-21T18:21:05+07:00"`
+	Folder *string `json:"folder" example:"campaigns/summer"`
+}
+
+// TagsInput is an input of adding tags to a short code
+type TagsInput struct {
+	Tags []string `json:"tags" binding:"required,min=1" example:"summer,email"`
+}
+
+// UpdateOptions is changes of an existing short code, nil fields are unchanged
+type UpdateOptions struct {
+	// FullURL is a new destination of a short code
+	FullURL *string
+	// Expiry is when a short code expires, a zero time for never
+	Expiry *time.Time
+	// Folder is a new folder of a short code, empty to remove it from its folder
+	Folder *string
+	// AddTags are normalized tags added to a short code
+	AddTags []string
+	// RemoveTags are normalized tags removed from a short code
+	RemoveTags []string
+}
@@ -7,4 +7,19 @@ type UrlObject struct {
 	FullURL   string     `json:"fullUrl"`
 	Expiry    *time.Time `json:"expiry,omitempty"`
 	Hits      uint64     `json:"hits"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	// Owner is a subject of a caller who created a short code, it is empty for anonymous callers
+	Owner string `json:"owner,omitempty"`
+	// Tenant is an id of a tenant of a short code, it is empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+	// Domain is a short domain of a short code, it is empty for the default domain
+	Domain string `json:"domain,omitempty"`
+	// Tags are lowercase labels grouping short codes, e.g. campaigns
+	Tags []string `json:"tags,omitempty"`
+	// Folder is a `/` separated path of a folder of a short code, it is empty if a short code isn't in a folder
+	Folder string `json:"folder,omitempty"`
+	// DeletedAt is when a short code was deleted, it is only set in deleted url objects
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// DeletedBy is a subject of a caller who deleted a short code
+	DeletedBy string `json:"deletedBy,omitempty"`
 }
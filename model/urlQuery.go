@@ -0,0 +1,80 @@
+package model
+
+import "time"
+
+// Match modes of short code and full url filters
+const (
+	MatchContains = "contains"
+	MatchExact    = "exact"
+	MatchPrefix   = "prefix"
+	MatchRegex    = "regex"
+)
+
+// Sort orders of listed url objects
+const (
+	SortShortCode = "shortCode"
+	SortHits      = "hits"
+	SortExpiry    = "expiry"
+	SortCreatedAt = "createdAt"
+)
+
+// UrlQuery is filters, an order and a page of listed url objects, nil filters match all url objects
+type UrlQuery struct {
+	// ShortCode matches short codes by ShortCodeMatch
+	ShortCode *string
+	// ShortCodeMatch is one of MatchContains, MatchExact, MatchPrefix and MatchRegex, MatchContains by default
+	ShortCodeMatch string
+	// FullURL matches full urls by FullURLMatch
+	FullURL *string
+	// FullURLMatch is one of MatchContains, MatchExact, MatchPrefix and MatchRegex, MatchContains by default
+	FullURLMatch string
+	// Owner matches url objects of an owner
+	Owner *string
+	// Domain matches url objects of a short domain
+	Domain *string
+	// Tag matches url objects with a tag, they're listed from an index of the tag
+	Tag *string
+	// Folder matches url objects in a folder or its subfolders
+	Folder *string
+	// MinHits and MaxHits match url objects with hits in an inclusive range
+	MinHits *uint64
+	MaxHits *uint64
+	// ExpiresBefore and ExpiresAfter match url objects expiring in a window,
+	// url objects without an expiry never expire, so they are only after any time
+	ExpiresBefore *time.Time
+	ExpiresAfter  *time.Time
+	// CreatedAfter and CreatedBefore match url objects created in a window,
+	// url objects created before a creation time was saved don't match them
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Sort is one of SortShortCode, SortHits, SortExpiry and SortCreatedAt, SortShortCode by default
+	Sort string
+	// Desc sorts url objects in descending order
+	Desc bool
+	// Cursor is NextCursor of a previous page, the first page is listed if empty
+	Cursor string
+	// Limit is the maximum number of url objects in a page, the service default is used if 0
+	Limit int
+}
+
+// PageInput is query parameters of a page of a listing API
+type PageInput struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=500" example:"50"`
+	Sort   string `form:"sort" binding:"omitempty,oneof=shortCode hits expiry createdAt" example:"hits"`
+	Order  string `form:"order" binding:"omitempty,oneof=asc desc" example:"desc"`
+}
+
+// SearchInput is query parameters of filters of url objects other than plain strings
+type SearchInput struct {
+	Tag            *string    `form:"tag" example:"summer"`
+	Folder         *string    `form:"folder" example:"campaigns"`
+	ShortCodeMatch string     `form:"shortCodeMatch" binding:"omitempty,oneof=contains exact prefix regex" example:"prefix"`
+	FullURLMatch   string     `form:"fullUrlMatch" binding:"omitempty,oneof=contains exact prefix regex" example:"regex"`
+	MinHits        *uint64    `form:"minHits" example:"10"`
+	MaxHits        *uint64    `form:"maxHits" example:"100"`
+	ExpiresBefore  *time.Time `form:"expiresBefore" example:"2021-09-01T00:00:00Z"`
+	ExpiresAfter   *time.Time `form:"expiresAfter" example:"2021-08-01T00:00:00Z"`
+	CreatedAfter   *time.Time `form:"createdAfter" example:"2021-08-01T00:00:00Z"`
+	CreatedBefore  *time.Time `form:"createdBefore" example:"2021-09-01T00:00:00Z"`
+}
@@ -0,0 +1,902 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// entriesBucket keeps string values, each value is prefixed by its expiry in milliseconds (0 for no expiry)
+	entriesBucket = []byte("entries")
+	// expiriesBucket indexes entries by expiry, a key is the expiry in milliseconds followed by an entry key
+	expiriesBucket = []byte("expiries")
+	// setsBucket keeps a nested bucket of members for each set
+	setsBucket = []byte("sets")
+	// hashesBucket keeps a nested bucket of fields for each hash
+	hashesBucket = []byte("hashes")
+	// sortedBucket keeps a nested bucket of members for each sorted set
+	sortedBucket = []byte("sorted")
+)
+
+// boltRepository is a storage management on an embedded file with the same semantics as redisRepository.
+// Expired entries are invisible immediately and removed by a background sweeper.
+type boltRepository struct {
+	db  *bolt.DB
+	now func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBolt opens or creates a database file at `path` and removes expired entries every `sweepInterval`
+func NewBolt(path string, sweepInterval time.Duration) (Repository, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database, err: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{entriesBucket, expiriesBucket, setsBucket, hashesBucket, sortedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets, err: %v", err)
+	}
+
+	r := &boltRepository{
+		db:   db,
+		now:  time.Now,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go r.runSweeper(sweepInterval)
+
+	return r, nil
+}
+
+// Set sets an object to a specified key with expiry
+func (r *boltRepository) Set(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return r.put(tx, key, jsonBytes, toMillis(expiry))
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	return true, nil
+}
+
+// SetNX sets an object to a specified key with expiry only if `key` doesn't exist.
+// It returns false if `key` already exists.
+func (r *boltRepository) SetNX(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	set := false
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		if _, _, ok := r.get(tx, key); ok {
+			return nil
+		}
+		set = true
+		return r.put(tx, key, jsonBytes, toMillis(expiry))
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	return set, nil
+}
+
+// MSetNX sets each object to its key with expiry only if the key doesn't exist, all entries are set in a transaction.
+// It returns whether each key is set in the same order.
+func (r *boltRepository) MSetNX(ctx context.Context, entries []Entry) ([]bool, error) {
+	values := make([][]byte, len(entries))
+	for i, entry := range entries {
+		jsonBytes, err := json.Marshal(entry.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal json, err: %v", err)
+		}
+		values[i] = jsonBytes
+	}
+
+	set := make([]bool, len(entries))
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		for i, entry := range entries {
+			if _, _, ok := r.get(tx, entry.Key); ok {
+				continue
+			}
+			if err := r.put(tx, entry.Key, values[i], toMillis(entry.Expiry)); err != nil {
+				return err
+			}
+			set[i] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	return set, nil
+}
+
+// Update replaces an object of existing `key` and keeps its expiry.
+// It returns false if `key` doesn't exist.
+func (r *boltRepository) Update(ctx context.Context, key string, object interface{}) (bool, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	updated := false
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		_, expiresAt, ok := r.get(tx, key)
+		if !ok {
+			return nil
+		}
+		updated = true
+		return r.put(tx, key, jsonBytes, expiresAt)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update data: %v", err)
+	}
+
+	return updated, nil
+}
+
+// ExpireAt changes an expiry of `key`, a nil or zero expiry makes `key` never expire.
+// It returns false if `key` doesn't exist.
+func (r *boltRepository) ExpireAt(ctx context.Context, key string, expiry *time.Time) (bool, error) {
+	updated := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		value, _, ok := r.get(tx, key)
+		if !ok {
+			return nil
+		}
+		updated = true
+		// a slice returned by bolt is invalid after the key is written
+		return r.put(tx, key, append([]byte(nil), value...), toMillis(expiry))
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to set expire at: %v", err)
+	}
+
+	return updated, nil
+}
+
+// Get unmarshals a stored value to value `v`.
+// It returns ErrNotFound if `key` doesn't exist.
+func (r *boltRepository) Get(ctx context.Context, key string, v interface{}) error {
+	var value []byte
+	found := false
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var stored []byte
+		stored, _, found = r.get(tx, key)
+		// a slice returned by bolt is valid only in a transaction
+		value = append([]byte(nil), stored...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get data from do: %v", err)
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	err = json.Unmarshal(value, v)
+	if err != nil {
+		return fmt.Errorf("failed to get data: %v", err)
+	}
+
+	return nil
+}
+
+// MGet unmarshals stored values to each elements of value `v`.
+// The length of value `v` must be equal to the number elements of `keys`.
+// Elements of keys which don't exist are left untouched.
+func (r *boltRepository) MGet(ctx context.Context, keys []interface{}, v interface{}) error {
+	values := make([][]byte, len(keys))
+	err := r.db.View(func(tx *bolt.Tx) error {
+		for i, key := range keys {
+			if value, _, ok := r.get(tx, fmt.Sprint(key)); ok {
+				values[i] = append([]byte(nil), value...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get data by MGET, err: %v", err)
+	}
+
+	// unmarshal to a slice of any literals
+	p := reflect.ValueOf(v)
+	s := reflect.Indirect(p)
+	for i := 0; i < s.Len(); i++ {
+		if values[i] == nil {
+			continue
+		}
+		addr := s.Index(i).Addr().Interface()
+		if err = json.Unmarshal(values[i], addr); err != nil {
+			return fmt.Errorf("failed to get data by MGET, err: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Del removes `key` and returns whether it existed
+func (r *boltRepository) Del(ctx context.Context, key string) (bool, error) {
+	deleted := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		deleted = r.exists(tx, key)
+		if err := r.delete(tx, key); err != nil {
+			return err
+		}
+		for _, name := range [][]byte{setsBucket, hashesBucket, sortedBucket} {
+			err := tx.Bucket(name).DeleteBucket([]byte(key))
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete key. err: %v", err)
+	}
+
+	return deleted, nil
+}
+
+// Exists returns whether `key` exists.
+func (r *boltRepository) Exists(ctx context.Context, key string) (bool, error) {
+	exists := false
+	err := r.db.View(func(tx *bolt.Tx) error {
+		exists = r.exists(tx, key)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check existance: %v", err)
+	}
+
+	return exists, nil
+}
+
+// Incr atomically increments the integer stored at `key` by one and returns the new value
+func (r *boltRepository) Incr(ctx context.Context, key string) (int64, error) {
+	var value int64
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var expiresAt int64
+		if current, currentExpiresAt, ok := r.get(tx, key); ok {
+			var err error
+			if value, err = strconv.ParseInt(string(current), 10, 64); err != nil {
+				return err
+			}
+			expiresAt = currentExpiresAt
+		}
+		value++
+
+		return r.put(tx, key, []byte(strconv.FormatInt(value, 10)), expiresAt)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment: %v", err)
+	}
+
+	return value, nil
+}
+
+// IncrIfExists atomically increments the integer stored at `counterKey` by `n` only if `key` exists.
+// The counter expires together with `key`. It returns the new value and whether `key` exists.
+func (r *boltRepository) IncrIfExists(ctx context.Context, key string, counterKey string, n int64) (int64, bool, error) {
+	var value int64
+	exists := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		_, expiresAt, ok := r.get(tx, key)
+		if !ok {
+			return nil
+		}
+		exists = true
+
+		if counter, _, ok := r.get(tx, counterKey); ok {
+			var err error
+			if value, err = strconv.ParseInt(string(counter), 10, 64); err != nil {
+				return err
+			}
+		}
+		value += n
+
+		return r.put(tx, counterKey, []byte(strconv.FormatInt(value, 10)), expiresAt)
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to increment counter: %v", err)
+	}
+
+	return value, exists, nil
+}
+
+// Rename renames `key` to `newKey` only if `newKey` doesn't exist. The expiry of `key` is kept.
+func (r *boltRepository) Rename(ctx context.Context, key string, newKey string) (bool, error) {
+	renamed := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		value, expiresAt, ok := r.get(tx, key)
+		if !ok {
+			return fmt.Errorf("no such key")
+		}
+		if _, _, ok = r.get(tx, newKey); ok {
+			return nil
+		}
+		renamed = true
+
+		// a slice returned by bolt is invalid after the key is deleted
+		value = append([]byte(nil), value...)
+		if err := r.delete(tx, key); err != nil {
+			return err
+		}
+		return r.put(tx, newKey, value, expiresAt)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to rename key: %v", err)
+	}
+
+	return renamed, nil
+}
+
+// SAdd adds a specified member to the set stored at key
+func (r *boltRepository) SAdd(ctx context.Context, setGroup string, member string) (bool, error) {
+	added := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(setsBucket).CreateBucketIfNotExists([]byte(setGroup))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(member)) != nil {
+			return nil
+		}
+		added = true
+		return b.Put([]byte(member), []byte{})
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add member, err: %v", err)
+	}
+	if !added {
+		return false, fmt.Errorf("failed to add member, setGroup: %s, member: %s", setGroup, member)
+	}
+
+	return true, nil
+}
+
+// SIsMember returns whether it is a member of the set stored at key.
+func (r *boltRepository) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	isMember := false
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(setsBucket).Bucket([]byte(key)); b != nil {
+			isMember = b.Get([]byte(member)) != nil
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to search members in set: %v", err)
+	}
+
+	return isMember, nil
+}
+
+// SMembers returns all members of the set stored at key
+func (r *boltRepository) SMembers(ctx context.Context, key string) ([]string, error) {
+	var members []string
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(setsBucket).Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(member, _ []byte) error {
+			members = append(members, string(member))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of set: %v", err)
+	}
+
+	return members, nil
+}
+
+// SRem removes a member from the set stored at key, it returns false if it isn't a member
+func (r *boltRepository) SRem(ctx context.Context, key string, member string) (bool, error) {
+	removed := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(setsBucket).Bucket([]byte(key))
+		if b == nil || b.Get([]byte(member)) == nil {
+			return nil
+		}
+		removed = true
+		if err := b.Delete([]byte(member)); err != nil {
+			return err
+		}
+		// an empty set doesn't exist like Redis
+		if k, _ := b.Cursor().First(); k == nil {
+			return tx.Bucket(setsBucket).DeleteBucket([]byte(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	return removed, nil
+}
+
+// SAddAll adds members to the set stored at key, a member which is already a member isn't an error unlike SAdd
+func (r *boltRepository) SAddAll(ctx context.Context, key string, members []string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(setsBucket).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if err = b.Put([]byte(member), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add members: %v", err)
+	}
+
+	return nil
+}
+
+// ZAdd adds members to the sorted set stored at key, members are sorted lexicographically like keys of a bucket
+func (r *boltRepository) ZAdd(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(sortedBucket).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if err = b.Put([]byte(member), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add member: %v", err)
+	}
+
+	return nil
+}
+
+// ZRem removes a member from the sorted set stored at key, it returns false if it isn't a member
+func (r *boltRepository) ZRem(ctx context.Context, key string, member string) (bool, error) {
+	removed := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sortedBucket).Bucket([]byte(key))
+		if b == nil || b.Get([]byte(member)) == nil {
+			return nil
+		}
+		removed = true
+		if err := b.Delete([]byte(member)); err != nil {
+			return err
+		}
+		// an empty sorted set doesn't exist like Redis
+		if k, _ := b.Cursor().First(); k == nil {
+			return tx.Bucket(sortedBucket).DeleteBucket([]byte(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	return removed, nil
+}
+
+// ZRangeByLex returns at most `limit` members of the sorted set stored at key after `start`,
+// or before `start` in reverse order if `desc`. `start` itself is returned only if `inclusive`
+// and all members are returned from the first one if `start` is empty.
+func (r *boltRepository) ZRangeByLex(ctx context.Context, key string, start string, inclusive bool, desc bool, limit int) ([]string, error) {
+	var members []string
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sortedBucket).Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+
+		var k []byte
+		switch {
+		case start == "" && desc:
+			k, _ = c.Last()
+		case start == "":
+			k, _ = c.First()
+		default:
+			// Seek moves to the first member at or after `start`
+			k, _ = c.Seek([]byte(start))
+			if desc && (k == nil || string(k) > start || !inclusive) {
+				if k == nil {
+					k, _ = c.Last()
+				} else {
+					k, _ = c.Prev()
+				}
+			}
+			if !desc && k != nil && string(k) == start && !inclusive {
+				k, _ = c.Next()
+			}
+		}
+
+		for k != nil && len(members) < limit {
+			members = append(members, string(k))
+			if desc {
+				k, _ = c.Prev()
+			} else {
+				k, _ = c.Next()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of sorted set: %v", err)
+	}
+
+	return members, nil
+}
+
+// ZCountBefore returns the number of members of the sorted set stored at key before `max`
+func (r *boltRepository) ZCountBefore(ctx context.Context, key string, max string) (int64, error) {
+	var n int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sortedBucket).Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && string(k) < max; k, _ = c.Next() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	return n, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (r *boltRepository) ZCard(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(sortedBucket).Bucket([]byte(key)); b != nil {
+			n = int64(b.Stats().KeyN)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	return n, nil
+}
+
+// HSet sets `field` of the hash stored at `key` to `value`
+func (r *boltRepository) HSet(ctx context.Context, key string, field string, value string) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(hashesBucket).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(field), []byte(value))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set field: %v", err)
+	}
+
+	return nil
+}
+
+// HMSet sets fields of the hash stored at `key` to their values at once
+func (r *boltRepository) HMSet(ctx context.Context, key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(hashesBucket).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		for field, value := range values {
+			if err = b.Put([]byte(field), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set fields: %v", err)
+	}
+
+	return nil
+}
+
+// HGet returns the value of `field` of the hash stored at `key` and whether it exists
+func (r *boltRepository) HGet(ctx context.Context, key string, field string) (string, bool, error) {
+	var value []byte
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(hashesBucket).Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		// a value is only valid during the transaction
+		if v := b.Get([]byte(field)); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get field: %v", err)
+	}
+
+	return string(value), value != nil, nil
+}
+
+// HDel removes `field` from the hash stored at `key`
+func (r *boltRepository) HDel(ctx context.Context, key string, field string) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(hashesBucket).Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		if err := b.Delete([]byte(field)); err != nil {
+			return err
+		}
+		// an empty hash doesn't exist like Redis
+		if k, _ := b.Cursor().First(); k == nil {
+			return tx.Bucket(hashesBucket).DeleteBucket([]byte(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete field: %v", err)
+	}
+
+	return nil
+}
+
+// HGetAll returns all fields and values of the hash stored at `key`
+func (r *boltRepository) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	values := make(map[string]string)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(hashesBucket).Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(field, value []byte) error {
+			values[string(field)] = string(value)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields: %v", err)
+	}
+
+	return values, nil
+}
+
+// HLen returns the number of fields in the hash stored at `key`
+func (r *boltRepository) HLen(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(hashesBucket).Bucket([]byte(key)); b != nil {
+			n = int64(b.Stats().KeyN)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count fields: %v", err)
+	}
+
+	return n, nil
+}
+
+// Keys returns all keys matching `pattern`.
+func (r *boltRepository) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	err := r.db.View(func(tx *bolt.Tx) error {
+		now := r.nowMillis()
+		err := tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			if expiresAt := decodeExpiry(v); expiresAt != 0 && expiresAt <= now {
+				return nil
+			}
+			if matchGlob(pattern, string(k)) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// nested buckets of sets, hashes and sorted sets have nil values
+		for _, name := range [][]byte{setsBucket, hashesBucket, sortedBucket} {
+			err = tx.Bucket(name).ForEach(func(k, v []byte) error {
+				if matchGlob(pattern, string(k)) {
+					keys = append(keys, string(k))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %v", err)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Scan returns all keys matching `pattern`, it is the same as Keys in bolt.
+func (r *boltRepository) Scan(ctx context.Context, pattern string) ([]string, error) {
+	return r.Keys(ctx, pattern)
+}
+
+// Close stops the sweeper and closes the database file
+func (r *boltRepository) Close() error {
+	close(r.stop)
+	<-r.done
+	return r.db.Close()
+}
+
+// runSweeper removes expired entries periodically until Close is called
+func (r *boltRepository) runSweeper(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.sweep(); err != nil {
+				log.Printf("failed to remove expired entries, err: %v", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// sweep removes all entries expired by now
+func (r *boltRepository) sweep() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		now := r.nowMillis()
+
+		var keys []string
+		c := tx.Bucket(expiriesBucket).Cursor()
+		for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k[:8])) <= now; k, _ = c.Next() {
+			keys = append(keys, string(k[8:]))
+		}
+
+		for _, key := range keys {
+			if err := r.delete(tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// get returns a value and an expiry of `key` unless it is expired
+func (r *boltRepository) get(tx *bolt.Tx, key string) ([]byte, int64, bool) {
+	stored := tx.Bucket(entriesBucket).Get([]byte(key))
+	if stored == nil {
+		return nil, 0, false
+	}
+
+	expiresAt := decodeExpiry(stored)
+	if expiresAt != 0 && expiresAt <= r.nowMillis() {
+		return nil, 0, false
+	}
+	return stored[8:], expiresAt, true
+}
+
+// put stores a value of `key` with its expiry and keeps the expiry index up to date
+func (r *boltRepository) put(tx *bolt.Tx, key string, value []byte, expiresAt int64) error {
+	if err := r.delete(tx, key); err != nil {
+		return err
+	}
+
+	stored := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(stored, uint64(expiresAt))
+	copy(stored[8:], value)
+	if err := tx.Bucket(entriesBucket).Put([]byte(key), stored); err != nil {
+		return err
+	}
+
+	if expiresAt == 0 {
+		return nil
+	}
+	return tx.Bucket(expiriesBucket).Put(expiryIndexKey(expiresAt, key), []byte{})
+}
+
+// delete removes an entry of `key` and its expiry index
+func (r *boltRepository) delete(tx *bolt.Tx, key string) error {
+	b := tx.Bucket(entriesBucket)
+	stored := b.Get([]byte(key))
+	if stored == nil {
+		return nil
+	}
+
+	if expiresAt := decodeExpiry(stored); expiresAt != 0 {
+		if err := tx.Bucket(expiriesBucket).Delete(expiryIndexKey(expiresAt, key)); err != nil {
+			return err
+		}
+	}
+	return b.Delete([]byte(key))
+}
+
+// exists returns whether `key` exists as an entry, a set, a hash or a sorted set
+func (r *boltRepository) exists(tx *bolt.Tx, key string) bool {
+	if _, _, ok := r.get(tx, key); ok {
+		return true
+	}
+	return tx.Bucket(setsBucket).Bucket([]byte(key)) != nil ||
+		tx.Bucket(hashesBucket).Bucket([]byte(key)) != nil ||
+		tx.Bucket(sortedBucket).Bucket([]byte(key)) != nil
+}
+
+// nowMillis returns current time in milliseconds
+func (r *boltRepository) nowMillis() int64 {
+	return r.now().UnixNano() / int64(time.Millisecond)
+}
+
+// toMillis converts an expiry to milliseconds, nil or zero expiry becomes 0
+func toMillis(expiry *time.Time) int64 {
+	if expiry == nil || expiry.IsZero() {
+		return 0
+	}
+	return expiry.UnixNano() / int64(time.Millisecond)
+}
+
+// decodeExpiry returns an expiry prefixed to a stored value
+func decodeExpiry(stored []byte) int64 {
+	return int64(binary.BigEndian.Uint64(stored[:8]))
+}
+
+// expiryIndexKey builds a key of the expiry index which is sorted by expiry
+func expiryIndexKey(expiresAt int64, key string) []byte {
+	indexKey := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(indexKey, uint64(expiresAt))
+	copy(indexKey[8:], key)
+	return indexKey
+}
@@ -0,0 +1,81 @@
+package repository
+
+// matchGlob reports whether `s` matches a glob-style `pattern` the same way as Redis KEYS and SCAN do.
+// `*` matches any characters, `?` matches a single character, `[...]` matches a character class
+// which may be negated by `^` and contain ranges like `a-z`, and `\` escapes the next character.
+func matchGlob(pattern string, s string) bool {
+	p := []rune(pattern)
+	r := []rune(s)
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			// collapse consecutive stars
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for i := 0; i <= len(r); i++ {
+				if matchGlob(string(p[1:]), string(r[i:])) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(r) == 0 {
+				return false
+			}
+			r = r[1:]
+		case '[':
+			if len(r) == 0 {
+				return false
+			}
+			p = p[1:]
+			negate := len(p) > 0 && p[0] == '^'
+			if negate {
+				p = p[1:]
+			}
+			matched := false
+			for len(p) > 0 && p[0] != ']' {
+				switch {
+				case p[0] == '\\' && len(p) > 1:
+					matched = matched || p[1] == r[0]
+					p = p[2:]
+				case len(p) > 2 && p[1] == '-' && p[2] != ']':
+					lo, hi := p[0], p[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (r[0] >= lo && r[0] <= hi)
+					p = p[3:]
+				default:
+					matched = matched || p[0] == r[0]
+					p = p[1:]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			r = r[1:]
+			if len(p) == 0 {
+				// an unclosed class ends the pattern
+				return len(r) == 0
+			}
+		case '\\':
+			if len(p) > 1 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if len(r) == 0 || p[0] != r[0] {
+				return false
+			}
+			r = r[1:]
+		}
+		p = p[1:]
+	}
+
+	return len(r) == 0
+}
@@ -0,0 +1,662 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepEvery is the number of writes after which all expired keys are removed
+const sweepEvery = 1000
+
+// memoryItem is a value stored in memoryRepository,
+// only one of value, set, hash and sorted is used depending on a command creating it.
+type memoryItem struct {
+	value     []byte
+	set       map[string]struct{}
+	hash      map[string]string
+	sorted    []string
+	expiresAt time.Time
+}
+
+// expired returns whether an item is expired at `now`
+func (i *memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
+
+// memoryRepository is an in-memory storage management with the same semantics as redisRepository.
+// It is used for tests and single-node deployments, data is lost on restart.
+type memoryRepository struct {
+	mu     sync.Mutex
+	items  map[string]*memoryItem
+	writes int
+	now    func() time.Time
+}
+
+// NewMemory initiates an in-memory repository
+func NewMemory() Repository {
+	return &memoryRepository{
+		items: make(map[string]*memoryItem),
+		now:   time.Now,
+	}
+}
+
+// Set sets an object to a specified key with expiry
+func (r *memoryRepository) Set(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := &memoryItem{value: jsonBytes}
+	if expiry != nil {
+		item.expiresAt = *expiry
+	}
+	r.put(key, item)
+
+	return true, nil
+}
+
+// SetNX sets an object to a specified key with expiry only if `key` doesn't exist.
+// It returns false if `key` already exists.
+func (r *memoryRepository) SetNX(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.get(key) != nil {
+		return false, nil
+	}
+
+	item := &memoryItem{value: jsonBytes}
+	if expiry != nil {
+		item.expiresAt = *expiry
+	}
+	r.put(key, item)
+
+	return true, nil
+}
+
+// MSetNX sets each object to its key with expiry only if the key doesn't exist, all entries are set at once.
+// It returns whether each key is set in the same order.
+func (r *memoryRepository) MSetNX(ctx context.Context, entries []Entry) ([]bool, error) {
+	values := make([][]byte, len(entries))
+	for i, entry := range entries {
+		jsonBytes, err := json.Marshal(entry.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal json, err: %v", err)
+		}
+		values[i] = jsonBytes
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set := make([]bool, len(entries))
+	for i, entry := range entries {
+		if r.get(entry.Key) != nil {
+			continue
+		}
+		item := &memoryItem{value: values[i]}
+		if entry.Expiry != nil {
+			item.expiresAt = *entry.Expiry
+		}
+		r.put(entry.Key, item)
+		set[i] = true
+	}
+
+	return set, nil
+}
+
+// Update replaces an object of existing `key` and keeps its expiry.
+// It returns false if `key` doesn't exist.
+func (r *memoryRepository) Update(ctx context.Context, key string, object interface{}) (bool, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return false, nil
+	}
+	r.put(key, &memoryItem{value: jsonBytes, expiresAt: item.expiresAt})
+
+	return true, nil
+}
+
+// ExpireAt changes an expiry of `key`, a nil or zero expiry makes `key` never expire.
+// It returns false if `key` doesn't exist.
+func (r *memoryRepository) ExpireAt(ctx context.Context, key string, expiry *time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return false, nil
+	}
+
+	item.expiresAt = time.Time{}
+	if expiry != nil {
+		item.expiresAt = *expiry
+	}
+	return true, nil
+}
+
+// Get unmarshals a stored value to value `v`.
+// It returns ErrNotFound if `key` doesn't exist.
+func (r *memoryRepository) Get(ctx context.Context, key string, v interface{}) error {
+	r.mu.Lock()
+	item := r.get(key)
+	r.mu.Unlock()
+
+	if item == nil {
+		return ErrNotFound
+	}
+	if item.value == nil {
+		return fmt.Errorf("failed to get data from do: wrong type")
+	}
+
+	err := json.Unmarshal(item.value, v)
+	if err != nil {
+		return fmt.Errorf("failed to get data: %v", err)
+	}
+
+	return nil
+}
+
+// MGet unmarshals stored values to each elements of value `v`.
+// The length of value `v` must be equal to the number elements of `keys`.
+// Elements of keys which don't exist are left untouched.
+func (r *memoryRepository) MGet(ctx context.Context, keys []interface{}, v interface{}) error {
+	r.mu.Lock()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if item := r.get(fmt.Sprint(key)); item != nil {
+			values[i] = item.value
+		}
+	}
+	r.mu.Unlock()
+
+	// unmarshal to a slice of any literals
+	p := reflect.ValueOf(v)
+	s := reflect.Indirect(p)
+	for i := 0; i < s.Len(); i++ {
+		if values[i] == nil {
+			continue
+		}
+		addr := s.Index(i).Addr().Interface()
+		if err := json.Unmarshal(values[i], addr); err != nil {
+			return fmt.Errorf("failed to get data by MGET, err: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Del removes `key` and returns whether it existed
+func (r *memoryRepository) Del(ctx context.Context, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.get(key) == nil {
+		return false, nil
+	}
+	delete(r.items, key)
+
+	return true, nil
+}
+
+// Exists returns whether `key` exists.
+func (r *memoryRepository) Exists(ctx context.Context, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.get(key) != nil, nil
+}
+
+// Incr atomically increments the integer stored at `key` by one and returns the new value
+func (r *memoryRepository) Incr(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var value int64
+	var expiresAt time.Time
+	if item := r.get(key); item != nil {
+		var err error
+		value, err = strconv.ParseInt(string(item.value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to increment: %v", err)
+		}
+		expiresAt = item.expiresAt
+	}
+	value++
+
+	r.put(key, &memoryItem{
+		value:     []byte(strconv.FormatInt(value, 10)),
+		expiresAt: expiresAt,
+	})
+
+	return value, nil
+}
+
+// IncrIfExists atomically increments the integer stored at `counterKey` by `n` only if `key` exists.
+// The counter expires together with `key`. It returns the new value and whether `key` exists.
+func (r *memoryRepository) IncrIfExists(ctx context.Context, key string, counterKey string, n int64) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return 0, false, nil
+	}
+
+	var value int64
+	if counter := r.get(counterKey); counter != nil {
+		var err error
+		value, err = strconv.ParseInt(string(counter.value), 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to increment counter: %v", err)
+		}
+	}
+	value += n
+
+	r.put(counterKey, &memoryItem{
+		value:     []byte(strconv.FormatInt(value, 10)),
+		expiresAt: item.expiresAt,
+	})
+
+	return value, true, nil
+}
+
+// Rename renames `key` to `newKey` only if `newKey` doesn't exist. The expiry of `key` is kept.
+func (r *memoryRepository) Rename(ctx context.Context, key string, newKey string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return false, fmt.Errorf("failed to rename key: no such key")
+	}
+	if r.get(newKey) != nil {
+		return false, nil
+	}
+
+	delete(r.items, key)
+	r.items[newKey] = item
+
+	return true, nil
+}
+
+// SAdd adds a specified member to the set stored at key
+func (r *memoryRepository) SAdd(ctx context.Context, setGroup string, member string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(setGroup)
+	if item == nil {
+		item = &memoryItem{set: make(map[string]struct{})}
+		r.put(setGroup, item)
+	}
+	if _, ok := item.set[member]; ok {
+		return false, fmt.Errorf("failed to add member, setGroup: %s, member: %s", setGroup, member)
+	}
+	item.set[member] = struct{}{}
+
+	return true, nil
+}
+
+// SIsMember returns whether it is a member of the set stored at key.
+func (r *memoryRepository) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return false, nil
+	}
+	_, ok := item.set[member]
+
+	return ok, nil
+}
+
+// SMembers returns all members of the set stored at key
+func (r *memoryRepository) SMembers(ctx context.Context, key string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return nil, nil
+	}
+	members := make([]string, 0, len(item.set))
+	for member := range item.set {
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// SRem removes a member from the set stored at key, it returns false if it isn't a member
+func (r *memoryRepository) SRem(ctx context.Context, key string, member string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return false, nil
+	}
+	if _, ok := item.set[member]; !ok {
+		return false, nil
+	}
+	delete(item.set, member)
+	if len(item.set) == 0 {
+		delete(r.items, key)
+	}
+
+	return true, nil
+}
+
+// SAddAll adds members to the set stored at key, a member which is already a member isn't an error unlike SAdd
+func (r *memoryRepository) SAddAll(ctx context.Context, key string, members []string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		item = &memoryItem{set: make(map[string]struct{})}
+		r.put(key, item)
+	}
+	for _, member := range members {
+		item.set[member] = struct{}{}
+	}
+
+	return nil
+}
+
+// ZAdd adds members to the sorted set stored at key, members are sorted lexicographically
+func (r *memoryRepository) ZAdd(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		item = &memoryItem{}
+		r.put(key, item)
+	}
+	for _, member := range members {
+		i := sort.SearchStrings(item.sorted, member)
+		if i < len(item.sorted) && item.sorted[i] == member {
+			continue
+		}
+		item.sorted = append(item.sorted, "")
+		copy(item.sorted[i+1:], item.sorted[i:])
+		item.sorted[i] = member
+	}
+
+	return nil
+}
+
+// ZRem removes a member from the sorted set stored at key, it returns false if it isn't a member
+func (r *memoryRepository) ZRem(ctx context.Context, key string, member string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return false, nil
+	}
+	i := sort.SearchStrings(item.sorted, member)
+	if i == len(item.sorted) || item.sorted[i] != member {
+		return false, nil
+	}
+	item.sorted = append(item.sorted[:i], item.sorted[i+1:]...)
+	if len(item.sorted) == 0 {
+		delete(r.items, key)
+	}
+
+	return true, nil
+}
+
+// ZRangeByLex returns at most `limit` members of the sorted set stored at key after `start`,
+// or before `start` in reverse order if `desc`. `start` itself is returned only if `inclusive`
+// and all members are returned from the first one if `start` is empty.
+func (r *memoryRepository) ZRangeByLex(ctx context.Context, key string, start string, inclusive bool, desc bool, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return nil, nil
+	}
+	sorted := item.sorted
+	var members []string
+	if !desc {
+		i := 0
+		if start != "" {
+			i = sort.Search(len(sorted), func(i int) bool {
+				return sorted[i] > start || inclusive && sorted[i] == start
+			})
+		}
+		for ; i < len(sorted) && len(members) < limit; i++ {
+			members = append(members, sorted[i])
+		}
+		return members, nil
+	}
+
+	i := len(sorted) - 1
+	if start != "" {
+		// the index of the last member before `start`
+		i = sort.Search(len(sorted), func(i int) bool {
+			return sorted[i] > start || !inclusive && sorted[i] == start
+		}) - 1
+	}
+	for ; i >= 0 && len(members) < limit; i-- {
+		members = append(members, sorted[i])
+	}
+
+	return members, nil
+}
+
+// ZCountBefore returns the number of members of the sorted set stored at key before `max`
+func (r *memoryRepository) ZCountBefore(ctx context.Context, key string, max string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	return int64(sort.SearchStrings(item.sorted, max)), nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (r *memoryRepository) ZCard(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	return int64(len(item.sorted)), nil
+}
+
+// HSet sets `field` of the hash stored at `key` to `value`
+func (r *memoryRepository) HSet(ctx context.Context, key string, field string, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		item = &memoryItem{hash: make(map[string]string)}
+		r.put(key, item)
+	}
+	item.hash[field] = value
+
+	return nil
+}
+
+// HMSet sets fields of the hash stored at `key` to their values at once
+func (r *memoryRepository) HMSet(ctx context.Context, key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		item = &memoryItem{hash: make(map[string]string)}
+		r.put(key, item)
+	}
+	for field, value := range values {
+		item.hash[field] = value
+	}
+
+	return nil
+}
+
+// HGet returns the value of `field` of the hash stored at `key` and whether it exists
+func (r *memoryRepository) HGet(ctx context.Context, key string, field string) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return "", false, nil
+	}
+	value, ok := item.hash[field]
+
+	return value, ok, nil
+}
+
+// HDel removes `field` from the hash stored at `key`
+func (r *memoryRepository) HDel(ctx context.Context, key string, field string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return nil
+	}
+	delete(item.hash, field)
+	if len(item.hash) == 0 {
+		delete(r.items, key)
+	}
+
+	return nil
+}
+
+// HGetAll returns all fields and values of the hash stored at `key`
+func (r *memoryRepository) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := make(map[string]string)
+	if item := r.get(key); item != nil {
+		for field, value := range item.hash {
+			values[field] = value
+		}
+	}
+
+	return values, nil
+}
+
+// HLen returns the number of fields in the hash stored at `key`
+func (r *memoryRepository) HLen(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.get(key)
+	if item == nil {
+		return 0, nil
+	}
+
+	return int64(len(item.hash)), nil
+}
+
+// Keys returns all keys matching `pattern`.
+func (r *memoryRepository) Keys(ctx context.Context, pattern string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var keys []string
+	for key, item := range r.items {
+		if item.expired(now) {
+			delete(r.items, key)
+			continue
+		}
+		if matchGlob(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Scan returns all keys matching `pattern`, it is the same as Keys in memory.
+func (r *memoryRepository) Scan(ctx context.Context, pattern string) ([]string, error) {
+	return r.Keys(ctx, pattern)
+}
+
+// Close does nothing, data is kept until the process exits
+func (r *memoryRepository) Close() error {
+	return nil
+}
+
+// get returns an item of `key` unless it is expired, the lock must be held
+func (r *memoryRepository) get(key string) *memoryItem {
+	item, ok := r.items[key]
+	if !ok {
+		return nil
+	}
+	if item.expired(r.now()) {
+		delete(r.items, key)
+		return nil
+	}
+	return item
+}
+
+// put stores an item of `key` and removes expired keys once in a while, the lock must be held
+func (r *memoryRepository) put(key string, item *memoryItem) {
+	r.items[key] = item
+
+	r.writes++
+	if r.writes < sweepEvery {
+		return
+	}
+	r.writes = 0
+
+	now := r.now()
+	for key, item := range r.items {
+		if item.expired(now) {
+			delete(r.items, key)
+		}
+	}
+}
@@ -3,22 +3,106 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"reflect"
 	"time"
 )
 
+// ErrNotFound is returned when a key doesn't exist
+var ErrNotFound = errors.New("key not found")
+
+// Entry is a key of a batch write with its object and expiry, a nil or zero expiry never expires
+type Entry struct {
+	Key    string
+	Object interface{}
+	Expiry *time.Time
+}
+
 // Repository is an interface for key-value database
 type Repository interface {
 	Set(ctx context.Context, key string, o interface{}, expiry *time.Time) (bool, error)
+	SetNX(ctx context.Context, key string, o interface{}, expiry *time.Time) (bool, error)
+	MSetNX(ctx context.Context, entries []Entry) ([]bool, error)
+	Update(ctx context.Context, key string, o interface{}) (bool, error)
+	ExpireAt(ctx context.Context, key string, expiry *time.Time) (bool, error)
 	Get(ctx context.Context, key string, v interface{}) error
 	MGet(ctx context.Context, keys []interface{}, v interface{}) error
 	Del(context.Context, string) (bool, error)
 	Exists(context.Context, string) (bool, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	IncrIfExists(ctx context.Context, key string, counterKey string, n int64) (int64, bool, error)
+	Rename(ctx context.Context, key string, newKey string) (bool, error)
 	SAdd(ctx context.Context, key string, member string) (bool, error)
 	SIsMember(ctx context.Context, key string, member string) (bool, error)
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SRem(ctx context.Context, key string, member string) (bool, error)
+	SAddAll(ctx context.Context, key string, members []string) error
+	ZAdd(ctx context.Context, key string, members ...string) error
+	ZRem(ctx context.Context, key string, member string) (bool, error)
+	ZRangeByLex(ctx context.Context, key string, start string, inclusive bool, desc bool, limit int) ([]string, error)
+	ZCountBefore(ctx context.Context, key string, max string) (int64, error)
+	ZCard(ctx context.Context, key string) (int64, error)
+	HSet(ctx context.Context, key string, field string, value string) error
+	HMSet(ctx context.Context, key string, values map[string]string) error
+	HGet(ctx context.Context, key string, field string) (string, bool, error)
+	HDel(ctx context.Context, key string, field string) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HLen(ctx context.Context, key string) (int64, error)
 	Keys(context.Context, string) ([]string, error)
+	Scan(context.Context, string) ([]string, error)
+	Close() error
+}
+
+// incrIfExistsScript increments a counter only if a key exists and keeps the counter expiring with the key
+var incrIfExistsScript = redis.NewScript(2, `
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+	return false
+end
+local value = redis.call("INCRBY", KEYS[2], ARGV[1])
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[2], ttl)
+end
+return value
+`)
+
+// msetnxScript sets each key only if it doesn't exist with its expiry in milliseconds from now (0 for no expiry
+// and -1 for a past expiry, a key with a past expiry isn't set since it expires right away).
+// It returns 1 for each set key and 0 for each existing one.
+var msetnxScript = redis.NewScript(-1, `
+local set = {}
+for i, key in ipairs(KEYS) do
+	local ttl = tonumber(ARGV[2 * i])
+	local ok
+	if ttl > 0 then
+		ok = redis.call("SET", key, ARGV[2 * i - 1], "PX", ttl, "NX")
+	elseif ttl == 0 then
+		ok = redis.call("SET", key, ARGV[2 * i - 1], "NX")
+	else
+		ok = redis.call("EXISTS", key) == 0
+	end
+	if ok then
+		set[i] = 1
+	else
+		set[i] = 0
+	end
+end
+return set
+`)
+
+// expiryMillis returns milliseconds until an expiry for PX of SET, 0 for a nil or zero expiry which never expires
+// and -1 for a past expiry
+func expiryMillis(expiry *time.Time) int64 {
+	if expiry == nil || expiry.IsZero() {
+		return 0
+	}
+	ms := time.Until(*expiry).Milliseconds()
+	if ms <= 0 {
+		return -1
+	}
+	return ms
 }
 
 // redisRepository is a storange management
@@ -55,25 +139,152 @@ func (r *redisRepository) Set(ctx context.Context, key string, object interface{
 		return false, fmt.Errorf("failed to marshal json, err: %v", err)
 	}
 
-	// set url object
-	_, err = conn.Do("SET", key, jsonBytes)
+	// an object and its expiry are set at once, an object with a past expiry expires right away
+	switch ms := expiryMillis(expiry); {
+	case ms > 0:
+		_, err = conn.Do("SET", key, jsonBytes, "PX", ms)
+	case ms == 0:
+		_, err = conn.Do("SET", key, jsonBytes)
+	default:
+		_, err = conn.Do("DEL", key)
+	}
 	if err != nil {
 		return false, fmt.Errorf("failed to set data: %v", err)
 	}
 
-	// set expiry only specified
-	var defaultTime time.Time
-	if expiry != nil && expiry.Unix() != defaultTime.Unix() {
-		_, err = conn.Do("EXPIREAT", key, expiry.Unix())
+	return true, nil
+}
+
+// SetNX sets an object to a specified key with expiry only if `key` doesn't exist.
+// It returns false if `key` already exists.
+func (r *redisRepository) SetNX(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	// an object and its expiry are set at once, an object with a past expiry isn't set since it expires right away
+	var reply interface{}
+	switch ms := expiryMillis(expiry); {
+	case ms > 0:
+		reply, err = conn.Do("SET", key, jsonBytes, "PX", ms, "NX")
+	case ms == 0:
+		reply, err = conn.Do("SET", key, jsonBytes, "NX")
+	default:
+		var exists bool
+		exists, err = redis.Bool(conn.Do("EXISTS", key))
+		if err == nil && !exists {
+			reply = "OK"
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	return reply != nil, nil
+}
+
+// MSetNX sets each object to its key with expiry only if the key doesn't exist, all entries are set at once.
+// It returns whether each key is set in the same order.
+func (r *redisRepository) MSetNX(ctx context.Context, entries []Entry) ([]bool, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	args := make([]interface{}, 0, 1+3*len(entries))
+	args = append(args, len(entries))
+	for _, entry := range entries {
+		args = append(args, entry.Key)
+	}
+	for _, entry := range entries {
+		jsonBytes, err := json.Marshal(entry.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal json, err: %v", err)
+		}
+		args = append(args, jsonBytes, expiryMillis(entry.Expiry))
+	}
+
+	replies, err := redis.Ints(msetnxScript.Do(conn, args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set data: %v", err)
+	}
+	set := make([]bool, len(replies))
+	for i, reply := range replies {
+		set[i] = reply == 1
+	}
+
+	return set, nil
+}
+
+// Update replaces an object of existing `key` and keeps its expiry.
+// It returns false if `key` doesn't exist.
+func (r *redisRepository) Update(ctx context.Context, key string, object interface{}) (bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+
+	// KEEPTTL keeps the expiry and XX never creates a key which was deleted
+	reply, err := conn.Do("SET", key, jsonBytes, "KEEPTTL", "XX")
+	if err != nil {
+		return false, fmt.Errorf("failed to update data: %v", err)
+	}
+
+	return reply != nil, nil
+}
+
+// ExpireAt changes an expiry of `key`, a nil or zero expiry makes `key` never expire.
+// It returns false if `key` doesn't exist.
+func (r *redisRepository) ExpireAt(ctx context.Context, key string, expiry *time.Time) (bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	if expiry == nil || expiry.IsZero() {
+		// PERSIST replies 0 for a key without expiry as well
+		exists, err := redis.Bool(conn.Do("EXISTS", key))
 		if err != nil {
-			return false, fmt.Errorf("failed to set expire at: %v", err)
+			return false, fmt.Errorf("failed to check existance: %v", err)
 		}
+		if !exists {
+			return false, nil
+		}
+		_, err = conn.Do("PERSIST", key)
+		if err != nil {
+			return false, fmt.Errorf("failed to persist key: %v", err)
+		}
+		return true, nil
 	}
 
-	return true, nil
+	updated, err := redis.Bool(conn.Do("EXPIREAT", key, expiry.Unix()))
+	if err != nil {
+		return false, fmt.Errorf("failed to set expire at: %v", err)
+	}
+
+	return updated, nil
 }
 
-// Get unmarshals a value got from Redis to value `v`
+// Get unmarshals a value got from Redis to value `v`.
+// It returns ErrNotFound if `key` doesn't exist.
 func (r *redisRepository) Get(ctx context.Context, key string, v interface{}) error {
 	conn, err := r.Pool.GetContext(ctx)
 	if err != nil {
@@ -82,6 +293,9 @@ func (r *redisRepository) Get(ctx context.Context, key string, v interface{}) er
 	defer conn.Close()
 
 	reply, err := redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return ErrNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get data from do: %v", err)
 	}
@@ -96,6 +310,7 @@ func (r *redisRepository) Get(ctx context.Context, key string, v interface{}) er
 
 // MGet unmarshals values got from Redis to each elements of value `v`.
 // The length of value `v` must be equal to the number elements of `keys`.
+// Elements of keys which don't exist are left untouched.
 func (r *redisRepository) MGet(ctx context.Context, keys []interface{}, v interface{}) error {
 	conn, err := r.Pool.GetContext(ctx)
 	if err != nil {
@@ -112,6 +327,9 @@ func (r *redisRepository) MGet(ctx context.Context, keys []interface{}, v interf
 	p := reflect.ValueOf(v)
 	s := reflect.Indirect(p)
 	for i := 0; i < s.Len(); i++ {
+		if reply[i] == nil {
+			continue
+		}
 		addr := s.Index(i).Addr().Interface()
 		if err = json.Unmarshal(reply[i], addr); err != nil {
 			return fmt.Errorf("failed to get data by MGET, err: %v", err)
@@ -121,8 +339,7 @@ func (r *redisRepository) MGet(ctx context.Context, keys []interface{}, v interf
 	return nil
 }
 
-// Del unmarshals values got from Redis to each elements of value `v`.
-// The length of value `v` must be equal to the number elements of `keys`.
+// Del removes `key` and returns whether it existed
 func (r *redisRepository) Del(ctx context.Context, key string) (bool, error) {
 	conn, err := r.Pool.GetContext(ctx)
 	if err != nil {
@@ -131,14 +348,11 @@ func (r *redisRepository) Del(ctx context.Context, key string) (bool, error) {
 	defer conn.Close()
 
 	deleteKeys, err := redis.Int(conn.Do("DEL", key))
-	if deleteKeys != 1 {
-		return false, fmt.Errorf("failed to delete key. err: key not found")
-	}
 	if err != nil {
 		return false, fmt.Errorf("failed to delete key. err: %v", err)
 	}
 
-	return true, nil
+	return deleteKeys == 1, nil
 }
 
 // Exists returns whether `key` exists.
@@ -157,6 +371,58 @@ func (r *redisRepository) Exists(ctx context.Context, key string) (bool, error)
 	return value, nil
 }
 
+// Incr atomically increments the integer stored at `key` by one and returns the new value
+func (r *redisRepository) Incr(ctx context.Context, key string) (int64, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	value, err := redis.Int64(conn.Do("INCR", key))
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment: %v", err)
+	}
+
+	return value, nil
+}
+
+// IncrIfExists atomically increments the integer stored at `counterKey` by `n` only if `key` exists.
+// The counter expires together with `key`. It returns the new value and whether `key` exists.
+func (r *redisRepository) IncrIfExists(ctx context.Context, key string, counterKey string, n int64) (int64, bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	value, err := redis.Int64(incrIfExistsScript.Do(conn, key, counterKey, n))
+	if err == redis.ErrNil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to increment counter: %v", err)
+	}
+
+	return value, true, nil
+}
+
+// Rename renames `key` to `newKey` only if `newKey` doesn't exist. The expiry of `key` is kept.
+func (r *redisRepository) Rename(ctx context.Context, key string, newKey string) (bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	renamed, err := redis.Bool(conn.Do("RENAMENX", key, newKey))
+	if err != nil {
+		return false, fmt.Errorf("failed to rename key: %v", err)
+	}
+
+	return renamed, nil
+}
+
 // SAdd adds a specified member to the set stored at key
 func (r *redisRepository) SAdd(ctx context.Context, setGroup string, member string) (bool, error) {
 	conn, err := r.Pool.GetContext(ctx)
@@ -195,6 +461,258 @@ func (r *redisRepository) SIsMember(ctx context.Context, key string, member stri
 	return true, nil
 }
 
+// SMembers returns all members of the set stored at key
+func (r *redisRepository) SMembers(ctx context.Context, key string) ([]string, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	members, err := redis.Strings(conn.Do("SMEMBERS", key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of set: %v", err)
+	}
+
+	return members, nil
+}
+
+// SRem removes a member from the set stored at key, it returns false if it isn't a member
+func (r *redisRepository) SRem(ctx context.Context, key string, member string) (bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	removed, err := redis.Int(conn.Do("SREM", key, member))
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	return removed == 1, nil
+}
+
+// SAddAll adds members to the set stored at key, a member which is already a member isn't an error unlike SAdd
+func (r *redisRepository) SAddAll(ctx context.Context, key string, members []string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("SADD", redis.Args{}.Add(key).AddFlat(members)...)
+	if err != nil {
+		return fmt.Errorf("failed to add members: %v", err)
+	}
+
+	return nil
+}
+
+// ZAdd adds members to the sorted set stored at key, all members have the same score so that they are sorted lexicographically
+func (r *redisRepository) ZAdd(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	args := redis.Args{}.Add(key)
+	for _, member := range members {
+		args = args.Add(0, member)
+	}
+	_, err = conn.Do("ZADD", args...)
+	if err != nil {
+		return fmt.Errorf("failed to add member: %v", err)
+	}
+
+	return nil
+}
+
+// ZRem removes a member from the sorted set stored at key, it returns false if it isn't a member
+func (r *redisRepository) ZRem(ctx context.Context, key string, member string) (bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	removed, err := redis.Int(conn.Do("ZREM", key, member))
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	return removed == 1, nil
+}
+
+// ZRangeByLex returns at most `limit` members of the sorted set stored at key after `start`,
+// or before `start` in reverse order if `desc`. `start` itself is returned only if `inclusive`
+// and all members are returned from the first one if `start` is empty.
+func (r *redisRepository) ZRangeByLex(ctx context.Context, key string, start string, inclusive bool, desc bool, limit int) ([]string, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	command, from, to := "ZRANGEBYLEX", "-", "+"
+	if desc {
+		command, from, to = "ZREVRANGEBYLEX", "+", "-"
+	}
+	if start != "" {
+		from = "(" + start
+		if inclusive {
+			from = "[" + start
+		}
+	}
+	members, err := redis.Strings(conn.Do(command, key, from, to, "LIMIT", 0, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of sorted set: %v", err)
+	}
+
+	return members, nil
+}
+
+// ZCountBefore returns the number of members of the sorted set stored at key before `max`
+func (r *redisRepository) ZCountBefore(ctx context.Context, key string, max string) (int64, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	n, err := redis.Int64(conn.Do("ZLEXCOUNT", key, "-", "("+max))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	return n, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (r *redisRepository) ZCard(ctx context.Context, key string) (int64, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	n, err := redis.Int64(conn.Do("ZCARD", key))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	return n, nil
+}
+
+// HSet sets `field` of the hash stored at `key` to `value`
+func (r *redisRepository) HSet(ctx context.Context, key string, field string, value string) error {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("HSET", key, field, value)
+	if err != nil {
+		return fmt.Errorf("failed to set field: %v", err)
+	}
+
+	return nil
+}
+
+// HMSet sets fields of the hash stored at `key` to their values at once
+func (r *redisRepository) HMSet(ctx context.Context, key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("HMSET", redis.Args{}.Add(key).AddFlat(values)...)
+	if err != nil {
+		return fmt.Errorf("failed to set fields: %v", err)
+	}
+
+	return nil
+}
+
+// HGet returns the value of `field` of the hash stored at `key` and whether it exists
+func (r *redisRepository) HGet(ctx context.Context, key string, field string) (string, bool, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	value, err := redis.String(conn.Do("HGET", key, field))
+	if err == redis.ErrNil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get field: %v", err)
+	}
+
+	return value, true, nil
+}
+
+// HDel removes `field` from the hash stored at `key`
+func (r *redisRepository) HDel(ctx context.Context, key string, field string) error {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("HDEL", key, field)
+	if err != nil {
+		return fmt.Errorf("failed to delete field: %v", err)
+	}
+
+	return nil
+}
+
+// HGetAll returns all fields and values of the hash stored at `key`
+func (r *redisRepository) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	values, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields: %v", err)
+	}
+
+	return values, nil
+}
+
+// HLen returns the number of fields in the hash stored at `key`
+func (r *redisRepository) HLen(ctx context.Context, key string) (int64, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	n, err := redis.Int64(conn.Do("HLEN", key))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count fields: %v", err)
+	}
+
+	return n, nil
+}
+
 // Keys returns all keys matching `pattern`.
 func (r *redisRepository) Keys(ctx context.Context, pattern string) ([]string, error) {
 	conn, err := r.Pool.GetContext(ctx)
@@ -210,3 +728,37 @@ func (r *redisRepository) Keys(ctx context.Context, pattern string) ([]string, e
 
 	return keys, nil
 }
+
+// Scan returns all keys matching `pattern` by iterating with SCAN
+// so that Redis isn't blocked like KEYS.
+func (r *redisRepository) Scan(ctx context.Context, pattern string) ([]string, error) {
+	conn, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("context expired. err: %v", err)
+	}
+	defer conn.Close()
+
+	var keys []string
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan keys: %v", err)
+		}
+
+		var page []string
+		if _, err = redis.Scan(values, &cursor, &page); err != nil {
+			return nil, fmt.Errorf("failed to scan keys: %v", err)
+		}
+		keys = append(keys, page...)
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// Close closes all connections of the pool
+func (r *redisRepository) Close() error {
+	return r.Pool.Close()
+}
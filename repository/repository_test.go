@@ -0,0 +1,662 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/model"
+
+	"github.com/alicebob/miniredis/v2"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	bolt "go.etcd.io/bbolt"
+	"gotest.tools/assert"
+)
+
+type object struct {
+	Name string `json:"name"`
+}
+
+// testRepository runs the behavioral test suite every Repository implementation must pass
+func testRepository(t *testing.T, newRepo func(t *testing.T) Repository) {
+	ctx := context.Background()
+
+	t.Run("SetGet", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Set(ctx, "a", object{Name: "a"}, nil); err != nil {
+			t.Fatalf("failed to set, err: %v", err)
+		}
+
+		var o object
+		if err := repo.Get(ctx, "a", &o); err != nil {
+			t.Fatalf("failed to get, err: %v", err)
+		}
+		assert.Equal(t, "a", o.Name)
+		assert.Equal(t, ErrNotFound, repo.Get(ctx, "missing", &o))
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		repo := newRepo(t)
+		past := time.Now().Add(-time.Minute)
+		future := time.Now().Add(time.Hour)
+		repo.Set(ctx, "past", object{}, &past)
+		repo.Set(ctx, "future", object{}, &future)
+
+		exists, _ := repo.Exists(ctx, "past")
+		assert.Assert(t, !exists)
+		exists, _ = repo.Exists(ctx, "future")
+		assert.Assert(t, exists)
+
+		// expire now
+		updated, err := repo.ExpireAt(ctx, "future", &past)
+		if err != nil {
+			t.Fatalf("failed to expire, err: %v", err)
+		}
+		assert.Assert(t, updated)
+		exists, _ = repo.Exists(ctx, "future")
+		assert.Assert(t, !exists)
+
+		updated, _ = repo.ExpireAt(ctx, "missing", nil)
+		assert.Assert(t, !updated)
+	})
+
+	t.Run("SetNX", func(t *testing.T) {
+		repo := newRepo(t)
+		set, err := repo.SetNX(ctx, "a", object{Name: "a"}, nil)
+		if err != nil {
+			t.Fatalf("failed to set, err: %v", err)
+		}
+		assert.Assert(t, set)
+		set, _ = repo.SetNX(ctx, "a", object{Name: "b"}, nil)
+		assert.Assert(t, !set)
+
+		var o object
+		repo.Get(ctx, "a", &o)
+		assert.Equal(t, "a", o.Name)
+
+		// an expired key can be set again
+		past := time.Now().Add(-time.Minute)
+		repo.Set(ctx, "b", object{Name: "b"}, &past)
+		set, _ = repo.SetNX(ctx, "b", object{Name: "c"}, nil)
+		assert.Assert(t, set)
+	})
+
+	t.Run("MSetNX", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Set(ctx, "a", object{Name: "a"}, nil)
+		past := time.Now().Add(-time.Minute)
+		repo.Set(ctx, "b", object{Name: "b"}, &past)
+
+		future := time.Now().Add(time.Hour)
+		set, err := repo.MSetNX(ctx, []Entry{
+			{Key: "a", Object: object{Name: "x"}},
+			{Key: "b", Object: object{Name: "y"}},
+			{Key: "c", Object: object{Name: "z"}, Expiry: &future},
+			{Key: "d", Object: object{Name: "d"}, Expiry: &past},
+		})
+		if err != nil {
+			t.Fatalf("failed to set, err: %v", err)
+		}
+		assert.DeepEqual(t, []bool{false, true, true, true}, set)
+
+		objects := make([]*object, 3)
+		repo.MGet(ctx, []interface{}{"a", "b", "c"}, &objects)
+		assert.Equal(t, "a", objects[0].Name)
+		assert.Equal(t, "y", objects[1].Name)
+		assert.Equal(t, "z", objects[2].Name)
+		exists, _ := repo.Exists(ctx, "d")
+		assert.Assert(t, !exists)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		updated, err := repo.Update(ctx, "a", object{Name: "a"})
+		if err != nil {
+			t.Fatalf("failed to update, err: %v", err)
+		}
+		assert.Assert(t, !updated)
+		exists, _ := repo.Exists(ctx, "a")
+		assert.Assert(t, !exists)
+
+		repo.Set(ctx, "a", object{Name: "a"}, nil)
+		updated, _ = repo.Update(ctx, "a", object{Name: "b"})
+		assert.Assert(t, updated)
+
+		var o object
+		repo.Get(ctx, "a", &o)
+		assert.Equal(t, "b", o.Name)
+	})
+
+	t.Run("MGet", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Set(ctx, "a", object{Name: "a"}, nil)
+		repo.Set(ctx, "c", object{Name: "c"}, nil)
+
+		objects := make([]*object, 3)
+		if err := repo.MGet(ctx, []interface{}{"a", "b", "c"}, &objects); err != nil {
+			t.Fatalf("failed to mget, err: %v", err)
+		}
+		assert.Equal(t, "a", objects[0].Name)
+		assert.Assert(t, objects[1] == nil)
+		assert.Equal(t, "c", objects[2].Name)
+	})
+
+	t.Run("Del", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Set(ctx, "a", object{}, nil)
+
+		deleted, err := repo.Del(ctx, "a")
+		if err != nil {
+			t.Fatalf("failed to delete, err: %v", err)
+		}
+		assert.Assert(t, deleted)
+		deleted, _ = repo.Del(ctx, "a")
+		assert.Assert(t, !deleted)
+	})
+
+	t.Run("Incr", func(t *testing.T) {
+		repo := newRepo(t)
+
+		var wg sync.WaitGroup
+		for w := 0; w < 10; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 10; i++ {
+					if _, err := repo.Incr(ctx, "sequence"); err != nil {
+						t.Errorf("failed to increment, err: %v", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, err := repo.Incr(ctx, "sequence")
+		if err != nil {
+			t.Fatalf("failed to increment, err: %v", err)
+		}
+		assert.Equal(t, int64(101), value)
+	})
+
+	t.Run("IncrIfExists", func(t *testing.T) {
+		repo := newRepo(t)
+		_, exists, err := repo.IncrIfExists(ctx, "a", "counter", 1)
+		if err != nil {
+			t.Fatalf("failed to increment, err: %v", err)
+		}
+		assert.Assert(t, !exists)
+
+		repo.Set(ctx, "a", object{}, nil)
+		repo.IncrIfExists(ctx, "a", "counter", 1)
+		value, exists, _ := repo.IncrIfExists(ctx, "a", "counter", 2)
+		assert.Assert(t, exists)
+		assert.Equal(t, int64(3), value)
+
+		counters := make([]uint64, 2)
+		repo.MGet(ctx, []interface{}{"counter", "missing"}, &counters)
+		assert.DeepEqual(t, []uint64{3, 0}, counters)
+	})
+
+	t.Run("ConcurrentIncrIfExists", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Set(ctx, "a", object{}, nil)
+
+		var wg sync.WaitGroup
+		for w := 0; w < 20; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 25; i++ {
+					if _, _, err := repo.IncrIfExists(ctx, "a", "counter", 1); err != nil {
+						t.Errorf("failed to increment, err: %v", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		value, _, _ := repo.IncrIfExists(ctx, "a", "counter", 0)
+		assert.Equal(t, int64(500), value)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.Set(ctx, "a", object{Name: "a"}, nil)
+		repo.Set(ctx, "b", object{Name: "b"}, nil)
+
+		renamed, _ := repo.Rename(ctx, "a", "b")
+		assert.Assert(t, !renamed)
+		renamed, _ = repo.Rename(ctx, "a", "c")
+		assert.Assert(t, renamed)
+
+		var o object
+		repo.Get(ctx, "c", &o)
+		assert.Equal(t, "a", o.Name)
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		repo := newRepo(t)
+		added, err := repo.SAdd(ctx, "set", "a")
+		if err != nil {
+			t.Fatalf("failed to add member, err: %v", err)
+		}
+		assert.Assert(t, added)
+
+		isMember, _ := repo.SIsMember(ctx, "set", "a")
+		assert.Assert(t, isMember)
+		isMember, _ = repo.SIsMember(ctx, "set", "b")
+		assert.Assert(t, !isMember)
+
+		repo.SAdd(ctx, "set", "b")
+		members, err := repo.SMembers(ctx, "set")
+		if err != nil {
+			t.Fatalf("failed to get members, err: %v", err)
+		}
+		sort.Strings(members)
+		assert.DeepEqual(t, []string{"a", "b"}, members)
+
+		removed, err := repo.SRem(ctx, "set", "a")
+		if err != nil {
+			t.Fatalf("failed to remove member, err: %v", err)
+		}
+		assert.Assert(t, removed)
+		removed, _ = repo.SRem(ctx, "set", "a")
+		assert.Assert(t, !removed)
+		isMember, _ = repo.SIsMember(ctx, "set", "a")
+		assert.Assert(t, !isMember)
+
+		// existing members are kept once
+		if err = repo.SAddAll(ctx, "set", []string{"b", "c", "d"}); err != nil {
+			t.Fatalf("failed to add members, err: %v", err)
+		}
+		members, _ = repo.SMembers(ctx, "set")
+		sort.Strings(members)
+		assert.DeepEqual(t, []string{"b", "c", "d"}, members)
+	})
+
+	t.Run("Hash", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.HSet(ctx, "hash", "a", "1")
+		repo.HSet(ctx, "hash", "b", "2")
+		repo.HDel(ctx, "hash", "a")
+
+		values, err := repo.HGetAll(ctx, "hash")
+		if err != nil {
+			t.Fatalf("failed to get fields, err: %v", err)
+		}
+		assert.DeepEqual(t, map[string]string{"b": "2"}, values)
+
+		for key, expected := range map[string]int64{"hash": 1, "nothing": 0} {
+			n, err := repo.HLen(ctx, key)
+			if err != nil {
+				t.Fatalf("failed to count fields, err: %v", err)
+			}
+			assert.Equal(t, expected, n)
+		}
+
+		value, ok, err := repo.HGet(ctx, "hash", "b")
+		if err != nil {
+			t.Fatalf("failed to get field, err: %v", err)
+		}
+		assert.Assert(t, ok)
+		assert.Equal(t, "2", value)
+
+		for _, key := range []string{"hash", "nothing"} {
+			_, ok, err = repo.HGet(ctx, key, "a")
+			if err != nil {
+				t.Fatalf("failed to get field, err: %v", err)
+			}
+			assert.Assert(t, !ok)
+		}
+
+		if err = repo.HMSet(ctx, "hash", map[string]string{"b": "3", "c": "4"}); err != nil {
+			t.Fatalf("failed to set fields, err: %v", err)
+		}
+		values, _ = repo.HGetAll(ctx, "hash")
+		assert.DeepEqual(t, map[string]string{"b": "3", "c": "4"}, values)
+	})
+
+	t.Run("SortedSet", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.ZAdd(ctx, "sorted", "b", "d", "a"); err != nil {
+			t.Fatalf("failed to add members, err: %v", err)
+		}
+		for _, member := range []string{"C", "c", "b"} {
+			if err := repo.ZAdd(ctx, "sorted", member); err != nil {
+				t.Fatalf("failed to add member, err: %v", err)
+			}
+		}
+		removed, _ := repo.ZRem(ctx, "sorted", "d")
+		assert.Assert(t, removed)
+		removed, _ = repo.ZRem(ctx, "sorted", "d")
+		assert.Assert(t, !removed)
+
+		cases := []struct {
+			start     string
+			inclusive bool
+			desc      bool
+			limit     int
+			expected  []string
+		}{
+			{"", false, false, 10, []string{"C", "a", "b", "c"}},
+			{"", false, true, 2, []string{"c", "b"}},
+			{"a", false, false, 10, []string{"b", "c"}},
+			{"a", true, false, 2, []string{"a", "b"}},
+			{"aa", false, false, 10, []string{"b", "c"}},
+			{"b", false, true, 10, []string{"a", "C"}},
+			{"b", true, true, 10, []string{"b", "a", "C"}},
+			{"bb", true, true, 1, []string{"b"}},
+			{"z", false, true, 1, []string{"c"}},
+			{"c", false, false, 10, nil},
+		}
+		for _, c := range cases {
+			members, err := repo.ZRangeByLex(ctx, "sorted", c.start, c.inclusive, c.desc, c.limit)
+			if err != nil {
+				t.Fatalf("failed to get members, err: %v", err)
+			}
+			if len(members) == 0 {
+				members = nil
+			}
+			assert.DeepEqual(t, c.expected, members)
+		}
+
+		n, err := repo.ZCountBefore(ctx, "sorted", "b")
+		if err != nil {
+			t.Fatalf("failed to count members, err: %v", err)
+		}
+		assert.Equal(t, int64(2), n)
+		n, err = repo.ZCard(ctx, "sorted")
+		if err != nil {
+			t.Fatalf("failed to count members, err: %v", err)
+		}
+		assert.Equal(t, int64(4), n)
+
+		exists, _ := repo.Exists(ctx, "sorted")
+		assert.Assert(t, exists)
+		deleted, _ := repo.Del(ctx, "sorted")
+		assert.Assert(t, deleted)
+		n, _ = repo.ZCard(ctx, "sorted")
+		assert.Equal(t, int64(0), n)
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, key := range []string{"url:abc", "url:abd", "url:x#http://a.com/*"} {
+			repo.Set(ctx, key, object{}, nil)
+		}
+		// a hit counter is only a number in SQL
+		repo.Incr(ctx, "hits:abc")
+
+		cases := map[string][]string{
+			"url:*":          {"url:abc", "url:abd", "url:x#http://a.com/*"},
+			"url:ab?":        {"url:abc", "url:abd"},
+			"url:ab[c]":      {"url:abc"},
+			"url:ab[^c]":     {"url:abd"},
+			"url:ab[a-c]":    {"url:abc"},
+			"*#*\\*":         {"url:x#http://a.com/*"},
+			"url:\\*":        nil,
+			"*abc":           {"hits:abc", "url:abc"},
+			"url:x#http://*": {"url:x#http://a.com/*"},
+		}
+		for pattern, expected := range cases {
+			keys, err := repo.Keys(ctx, pattern)
+			if err != nil {
+				t.Fatalf("failed to get keys, err: %v", err)
+			}
+			scanned, err := repo.Scan(ctx, pattern)
+			if err != nil {
+				t.Fatalf("failed to scan keys, err: %v", err)
+			}
+			assert.DeepEqual(t, expected, sortStrings(keys))
+			assert.DeepEqual(t, expected, sortStrings(scanned))
+		}
+	})
+}
+
+func TestRedisRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("failed to run redis, err: %v", err)
+		}
+		t.Cleanup(mr.Close)
+
+		repo, _ := NewPool(mr.Addr())
+		return repo
+	})
+}
+
+func TestRedisRepository_SetExpiry(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := NewPool(mr.Addr())
+	ctx := context.Background()
+	future := time.Now().Add(time.Hour)
+
+	// a key and its expiry are set in one command, so a key is never left without its expiry
+	for _, key := range []string{"set", "setnx"} {
+		count := mr.CommandCount()
+		if key == "set" {
+			_, err = repo.Set(ctx, key, object{Name: key}, &future)
+		} else {
+			_, err = repo.SetNX(ctx, key, object{Name: key}, &future)
+		}
+		if err != nil {
+			t.Fatalf("failed to set, err: %v", err)
+		}
+		assert.Equal(t, 1, mr.CommandCount()-count)
+		assert.Assert(t, mr.TTL(key) > 59*time.Minute, key)
+	}
+
+	if _, err = repo.MSetNX(ctx, []Entry{{Key: "msetnx", Object: object{Name: "msetnx"}, Expiry: &future}}); err != nil {
+		t.Fatalf("failed to set, err: %v", err)
+	}
+	assert.Assert(t, mr.TTL("msetnx") > 59*time.Minute)
+}
+
+func TestMemoryRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewMemory()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		dir, err := ioutil.TempDir("", "repository")
+		if err != nil {
+			t.Fatalf("failed to create temp dir, err: %v", err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		repo, err := NewSQL("sqlite3", filepath.Join(dir, "test.db"))
+		if err != nil {
+			t.Fatalf("failed to init sqlite, err: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	})
+}
+
+func TestSQLiteRepository_UrlTables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repository")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	repo, err := NewSQL("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to init sqlite, err: %v", err)
+	}
+	defer repo.Close()
+	db := repo.(*sqlRepository).db
+	ctx := context.Background()
+
+	// url objects are kept in columns of urls
+	createdAt := time.Date(2021, 8, 20, 22, 6, 32, 5, time.FixedZone("ICT", 7*60*60))
+	expiry := time.Now().Add(time.Hour)
+	urlObject := model.UrlObject{
+		ShortCode: "abc",
+		FullURL:   "http://www.facebook.com",
+		CreatedAt: &createdAt,
+		Expiry:    &expiry,
+		Owner:     "apikey:1",
+		Tenant:    "marketing",
+		Domain:    "brand.ly",
+		Tags:      []string{"email", "summer"},
+		Folder:    "campaigns/summer",
+	}
+	key := "tenant:marketing:domain:brand.ly:url:abc"
+	if _, err = repo.SetNX(ctx, key, &urlObject, &expiry); err != nil {
+		t.Fatalf("failed to set, err: %v", err)
+	}
+	var fullUrl, tags, created string
+	err = db.QueryRow(
+		`SELECT full_url, tags, created_at FROM urls WHERE tenant = 'marketing' AND domain = 'brand.ly' AND short_code = 'abc'`,
+	).Scan(&fullUrl, &tags, &created)
+	assert.NilError(t, err)
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+	assert.Equal(t, "email,summer", tags)
+	assert.Equal(t, "2021-08-20T15:06:32.000000005Z", created)
+
+	var found model.UrlObject
+	assert.NilError(t, repo.Get(ctx, key, &found))
+	assert.Equal(t, urlObject.Tenant, found.Tenant)
+	assert.Equal(t, urlObject.ShortCode, found.ShortCode)
+	assert.DeepEqual(t, urlObject.Tags, found.Tags)
+	assert.Assert(t, found.CreatedAt.Equal(createdAt))
+
+	// hit counters are kept in url_hits and added to url objects in url_reports
+	for i := 0; i < 2; i++ {
+		if _, _, err = repo.IncrIfExists(ctx, key, "tenant:marketing:domain:brand.ly:hits:abc", 3); err != nil {
+			t.Fatalf("failed to increment, err: %v", err)
+		}
+	}
+	hits := make([]uint64, 2)
+	err = repo.MGet(ctx, []interface{}{"tenant:marketing:domain:brand.ly:hits:abc", "hits:missing"}, &hits)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []uint64{6, 0}, hits)
+	var reported int64
+	assert.NilError(t, db.QueryRow(`SELECT hits FROM url_reports WHERE short_code = 'abc'`).Scan(&reported))
+	assert.Equal(t, int64(6), reported)
+
+	// deleted url objects are kept in deleted_urls
+	deletedAt := time.Now()
+	urlObject.Hits = 6
+	urlObject.DeletedAt = &deletedAt
+	urlObject.DeletedBy = "apikey:1"
+	if _, err = repo.Set(ctx, "tenant:marketing:domain:brand.ly:deletedUrl:abc", &urlObject, nil); err != nil {
+		t.Fatalf("failed to set, err: %v", err)
+	}
+	deleted, err := repo.Del(ctx, key)
+	assert.NilError(t, err)
+	assert.Assert(t, deleted)
+	var deletedBy string
+	assert.NilError(t, db.QueryRow(`SELECT deleted_by, hits FROM deleted_urls WHERE short_code = 'abc'`).Scan(&deletedBy, &reported))
+	assert.Equal(t, "apikey:1", deletedBy)
+	assert.Equal(t, int64(6), reported)
+
+	// a legacy key is moved to urls when it's renamed
+	legacy := model.UrlObject{ShortCode: "def", FullURL: "http://www.netflix.com"}
+	if _, err = repo.Set(ctx, "url:def#http://www.netflix.com", &legacy, nil); err != nil {
+		t.Fatalf("failed to set, err: %v", err)
+	}
+	renamed, err := repo.Rename(ctx, "url:def#http://www.netflix.com", "url:def")
+	assert.NilError(t, err)
+	assert.Assert(t, renamed)
+	assert.NilError(t, db.QueryRow(`SELECT full_url FROM urls WHERE tenant = '' AND domain = '' AND short_code = 'def'`).Scan(&fullUrl))
+	assert.Equal(t, "http://www.netflix.com", fullUrl)
+
+	// values saved in entries before url tables existed are moved to them
+	_, err = db.Exec(`INSERT INTO entries (key, value) VALUES ('url:ghi', '{"shortCode":"ghi","fullUrl":"http://www.github.com"}'), ('hits:ghi', '2')`)
+	assert.NilError(t, err)
+	assert.NilError(t, repo.(*sqlRepository).inTx(ctx, func(tx *sql.Tx) error {
+		return moveEntries(ctx, tx, sqlDialects["sqlite3"])
+	}))
+	assert.NilError(t, db.QueryRow(`SELECT hits FROM url_reports WHERE short_code = 'ghi'`).Scan(&reported))
+	assert.Equal(t, int64(2), reported)
+	var left int
+	assert.NilError(t, db.QueryRow(`SELECT COUNT(*) FROM entries WHERE key LIKE '%ghi'`).Scan(&left))
+	assert.Equal(t, 0, left)
+}
+
+func TestBoltRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return newTestBolt(t)
+	})
+}
+
+func TestBoltRepository_Sweep(t *testing.T) {
+	repo := newTestBolt(t).(*boltRepository)
+	ctx := context.Background()
+
+	expiry := time.Now().Add(time.Minute)
+	repo.Set(ctx, "a", object{}, &expiry)
+	repo.Set(ctx, "b", object{}, nil)
+
+	repo.now = func() time.Time { return expiry.Add(time.Second) }
+	if err := repo.sweep(); err != nil {
+		t.Fatalf("failed to sweep, err: %v", err)
+	}
+
+	repo.db.View(func(tx *bolt.Tx) error {
+		assert.Assert(t, tx.Bucket(entriesBucket).Get([]byte("a")) == nil)
+		assert.Assert(t, tx.Bucket(entriesBucket).Get([]byte("b")) != nil)
+		assert.Equal(t, 0, tx.Bucket(expiriesBucket).Stats().KeyN)
+		return nil
+	})
+}
+
+// newTestBolt opens a bolt repository in a temp dir removed after a test
+func newTestBolt(t *testing.T) Repository {
+	dir, err := ioutil.TempDir("", "repository")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, err: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	repo, err := NewBolt(filepath.Join(dir, "test.db"), time.Minute)
+	if err != nil {
+		t.Fatalf("failed to init bolt, err: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// TestPostgresRepository runs only if POSTGRES_DSN is set to an empty database
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN is not set")
+	}
+
+	testRepository(t, func(t *testing.T) Repository {
+		repo, err := NewSQL("postgres", dsn)
+		if err != nil {
+			t.Fatalf("failed to init postgres, err: %v", err)
+		}
+		db := repo.(*sqlRepository).db
+		t.Cleanup(func() {
+			db.Exec(`TRUNCATE entries, set_members, hash_fields, sorted_members, urls, url_hits, deleted_urls`)
+			repo.Close()
+		})
+		return repo
+	})
+}
+
+// sortStrings sorts keys returned in any order, it keeps nil for no keys
+func sortStrings(keys []string) []string {
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,1189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sqlMigration is a schema change applied in a transaction
+type sqlMigration func(ctx context.Context, tx *sql.Tx, dialect sqlDialect) error
+
+// execSQL returns a migration of a statement
+func execSQL(statement string) sqlMigration {
+	return func(ctx context.Context, tx *sql.Tx, dialect sqlDialect) error {
+		_, err := tx.ExecContext(ctx, statement)
+		return err
+	}
+}
+
+// sqlMigrations are schema changes applied in order, a new migration must be appended at the end.
+// `urls`, `url_hits` and `deleted_urls` keep url objects, hit counters and deleted url objects of short codes
+// in columns so that they can be reported by SQL, `url_reports` adds hit counters to url objects.
+// Times of url objects are RFC 3339 text in UTC and `expires_at` is when a row expires in Unix milliseconds.
+// `entries` keeps other string values such as reservations of short codes, `set_members` keeps sets
+// such as deleted short codes and `hash_fields` keeps hashes such as the full url index.
+// `sorted_members` keeps sorted sets such as listing indexes, members are compared byte by byte.
+var sqlMigrations = []sqlMigration{
+	execSQL(`CREATE TABLE entries (
+		key        TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,
+		expires_at BIGINT
+	)`),
+	execSQL(`CREATE INDEX entries_expires_at ON entries (expires_at)`),
+	execSQL(`CREATE TABLE set_members (
+		key    TEXT NOT NULL,
+		member TEXT NOT NULL,
+		PRIMARY KEY (key, member)
+	)`),
+	execSQL(`CREATE TABLE hash_fields (
+		key   TEXT NOT NULL,
+		field TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (key, field)
+	)`),
+	execSQL(`CREATE TABLE urls (
+		tenant     TEXT NOT NULL,
+		domain     TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		full_url   TEXT NOT NULL,
+		owner      TEXT NOT NULL,
+		folder     TEXT NOT NULL,
+		tags       TEXT NOT NULL,
+		base_hits  BIGINT NOT NULL,
+		created_at TEXT,
+		expiry     TEXT,
+		expires_at BIGINT,
+		PRIMARY KEY (tenant, domain, short_code)
+	)`),
+	execSQL(`CREATE INDEX urls_expires_at ON urls (expires_at)`),
+	execSQL(`CREATE INDEX urls_owner ON urls (owner)`),
+	execSQL(`CREATE TABLE url_hits (
+		tenant     TEXT NOT NULL,
+		domain     TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		hits       BIGINT NOT NULL,
+		expires_at BIGINT,
+		PRIMARY KEY (tenant, domain, short_code)
+	)`),
+	execSQL(`CREATE INDEX url_hits_expires_at ON url_hits (expires_at)`),
+	execSQL(`CREATE TABLE deleted_urls (
+		tenant     TEXT NOT NULL,
+		domain     TEXT NOT NULL,
+		short_code TEXT NOT NULL,
+		full_url   TEXT NOT NULL,
+		owner      TEXT NOT NULL,
+		folder     TEXT NOT NULL,
+		tags       TEXT NOT NULL,
+		hits       BIGINT NOT NULL,
+		created_at TEXT,
+		expiry     TEXT,
+		deleted_at TEXT,
+		deleted_by TEXT NOT NULL,
+		expires_at BIGINT,
+		PRIMARY KEY (tenant, domain, short_code)
+	)`),
+	execSQL(`CREATE INDEX deleted_urls_expires_at ON deleted_urls (expires_at)`),
+	execSQL(`CREATE VIEW url_reports AS
+		SELECT u.tenant, u.domain, u.short_code, u.full_url, u.owner, u.folder, u.tags,
+			u.base_hits + COALESCE(h.hits, 0) AS hits, u.created_at, u.expiry, u.expires_at
+		FROM urls u
+		LEFT JOIN url_hits h ON h.tenant = u.tenant AND h.domain = u.domain AND h.short_code = u.short_code`),
+	moveEntries,
+	func(ctx context.Context, tx *sql.Tx, dialect sqlDialect) error {
+		_, err := tx.ExecContext(ctx, `CREATE TABLE sorted_members (
+			key    TEXT NOT NULL,
+			member `+dialect.binaryText+` NOT NULL,
+			PRIMARY KEY (key, member)
+		)`)
+		return err
+	},
+}
+
+// moveEntries moves values saved in entries before tables of their keys existed to their tables
+func moveEntries(ctx context.Context, tx *sql.Tx, dialect sqlDialect) error {
+	rows, err := tx.QueryContext(ctx, `SELECT key, value, expires_at FROM entries`)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		key       string
+		value     string
+		expiresAt sql.NullInt64
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err = rows.Scan(&e.key, &e.value, &e.expiresAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if table, _ := tableOf(e.key); table != entriesTable {
+			entries = append(entries, e)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		table, keys := tableOf(e.key)
+		values, err := table.encode([]byte(e.value))
+		if err != nil {
+			return fmt.Errorf("failed to move key: %s, err: %v", e.key, err)
+		}
+		if err = upsert(ctx, tx, table, keys, values, e.expiresAt); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `DELETE FROM entries WHERE key = $1`, e.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlDialect is a difference between supported databases
+type sqlDialect struct {
+	// forUpdate locks selected rows until a transaction ends
+	forUpdate string
+	// binaryText is a type of text compared byte by byte like Redis rather than by a locale
+	binaryText string
+}
+
+// sqlDialects are supported database drivers
+var sqlDialects = map[string]sqlDialect{
+	"sqlite3":  {forUpdate: "", binaryText: "TEXT"},
+	"postgres": {forUpdate: " FOR UPDATE", binaryText: `TEXT COLLATE "C"`},
+}
+
+// sqlRepository is a storage management on a relational database.
+// It keeps the same key-value semantics as redisRepository, an expired entry is treated as not existing
+// and removed once in a while. A string value is kept in a table of its key, see sqlTable.
+type sqlRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+	now     func() time.Time
+
+	mu     sync.Mutex
+	writes int
+}
+
+// NewSQL connects to a relational database of `driver` and migrates its schema.
+// Supported drivers are `sqlite3` and `postgres`, the driver package must be imported by the caller.
+func NewSQL(driver string, dsn string) (Repository, error) {
+	dialect, ok := sqlDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sql driver: %s", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database, err: %v", err)
+	}
+	if driver == "sqlite3" {
+		// SQLite allows a single writer, serialize all queries instead of failing on a locked database
+		db.SetMaxOpenConns(1)
+	}
+
+	r := &sqlRepository{
+		db:      db,
+		dialect: dialect,
+		now:     time.Now,
+	}
+	if err = r.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// migrate applies migrations which haven't been applied yet
+func (r *sqlRepository) migrate(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations, err: %v", err)
+	}
+
+	var version int
+	err = r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version, err: %v", err)
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		err = r.inTx(ctx, func(tx *sql.Tx) error {
+			if err := sqlMigrations[i](ctx, tx, r.dialect); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, i+1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d, err: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Set sets an object to a specified key with expiry
+func (r *sqlRepository) Set(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	table, keys := tableOf(key)
+	values, err := encode(table, object)
+	if err != nil {
+		return false, err
+	}
+
+	err = upsert(ctx, r.db, table, keys, values, r.expiresAt(expiry))
+	if err != nil {
+		return false, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	r.sweep(ctx)
+	return true, nil
+}
+
+// SetNX sets an object to a specified key with expiry only if `key` doesn't exist.
+// It returns false if `key` already exists.
+func (r *sqlRepository) SetNX(ctx context.Context, key string, object interface{}, expiry *time.Time) (bool, error) {
+	table, keys := tableOf(key)
+	values, err := encode(table, object)
+	if err != nil {
+		return false, err
+	}
+
+	set := false
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		set, err = r.setNX(ctx, tx, table, keys, values, expiry)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	r.sweep(ctx)
+	return set, nil
+}
+
+// MSetNX sets each object to its key with expiry only if the key doesn't exist, all entries are set in a transaction.
+// It returns whether each key is set in the same order.
+func (r *sqlRepository) MSetNX(ctx context.Context, entries []Entry) ([]bool, error) {
+	set := make([]bool, len(entries))
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for i, entry := range entries {
+			table, keys := tableOf(entry.Key)
+			values, err := encode(table, entry.Object)
+			if err != nil {
+				return err
+			}
+			if set[i], err = r.setNX(ctx, tx, table, keys, values, entry.Expiry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set data: %v", err)
+	}
+
+	r.sweep(ctx)
+	return set, nil
+}
+
+// setNX inserts a row of a key only if it doesn't exist and returns whether it's inserted
+func (r *sqlRepository) setNX(ctx context.Context, tx *sql.Tx, table *sqlTable, keys []interface{}, values []interface{}, expiry *time.Time) (bool, error) {
+	// an expired entry of a key may be left
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM `+table.name+` WHERE `+table.where(1)+fmt.Sprintf(` AND expires_at <= $%d`, len(keys)+1),
+		append(keys, r.nowMillis())...,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	columns := table.columns()
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO `+table.name+` (`+strings.Join(columns, ", ")+`) VALUES (`+placeholders(1, len(columns))+`)
+		ON CONFLICT (`+strings.Join(table.keyColumns, ", ")+`) DO NOTHING`,
+		row(keys, values, r.expiresAt(expiry))...,
+	)
+	if err != nil {
+		return false, err
+	}
+	return affected(result)
+}
+
+// Update replaces an object of existing `key` and keeps its expiry.
+// It returns false if `key` doesn't exist.
+func (r *sqlRepository) Update(ctx context.Context, key string, object interface{}) (bool, error) {
+	table, keys := tableOf(key)
+	values, err := encode(table, object)
+	if err != nil {
+		return false, err
+	}
+
+	assignments := make([]string, len(table.valueColumns))
+	for i, column := range table.valueColumns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+	n := len(values)
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE `+table.name+` SET `+strings.Join(assignments, ", ")+` WHERE `+table.where(n+1)+live(n+len(keys)+1),
+		append(append(values, keys...), r.nowMillis())...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update data: %v", err)
+	}
+
+	return affected(result)
+}
+
+// ExpireAt changes an expiry of `key`, a nil or zero expiry makes `key` never expire.
+// It returns false if `key` doesn't exist.
+func (r *sqlRepository) ExpireAt(ctx context.Context, key string, expiry *time.Time) (bool, error) {
+	table, keys := tableOf(key)
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE `+table.name+` SET expires_at = $1 WHERE `+table.where(2)+live(len(keys)+2),
+		append(append([]interface{}{r.expiresAt(expiry)}, keys...), r.nowMillis())...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to set expire at: %v", err)
+	}
+
+	return affected(result)
+}
+
+// Get unmarshals a stored value to value `v`.
+// It returns ErrNotFound if `key` doesn't exist.
+func (r *sqlRepository) Get(ctx context.Context, key string, v interface{}) error {
+	table, keys := tableOf(key)
+	dest, decode := table.scan()
+	err := r.db.QueryRowContext(ctx,
+		`SELECT `+strings.Join(table.valueColumns, ", ")+` FROM `+table.name+` WHERE `+table.where(1)+live(len(keys)+1),
+		append(keys, r.nowMillis())...,
+	).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get data from do: %v", err)
+	}
+
+	value, err := decode(keyStrings(keys))
+	if err != nil {
+		return fmt.Errorf("failed to get data: %v", err)
+	}
+	err = json.Unmarshal(value, v)
+	if err != nil {
+		return fmt.Errorf("failed to get data: %v", err)
+	}
+
+	return nil
+}
+
+// MGet unmarshals stored values to each elements of value `v`.
+// The length of value `v` must be equal to the number elements of `keys`.
+// Elements of keys which don't exist are left untouched.
+func (r *sqlRepository) MGet(ctx context.Context, keys []interface{}, v interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// keys are queried by each table
+	var tables []*sqlTable
+	keysOf := make(map[*sqlTable][][]interface{})
+	for _, key := range keys {
+		table, columns := tableOf(fmt.Sprint(key))
+		if _, ok := keysOf[table]; !ok {
+			tables = append(tables, table)
+		}
+		keysOf[table] = append(keysOf[table], columns)
+	}
+
+	values := make(map[string][]byte)
+	for _, table := range tables {
+		if err := r.mget(ctx, table, keysOf[table], values); err != nil {
+			return fmt.Errorf("failed to get data by MGET, err: %v", err)
+		}
+	}
+
+	// unmarshal to a slice of any literals
+	p := reflect.ValueOf(v)
+	s := reflect.Indirect(p)
+	for i := 0; i < s.Len(); i++ {
+		value, ok := values[fmt.Sprint(keys[i])]
+		if !ok {
+			continue
+		}
+		addr := s.Index(i).Addr().Interface()
+		if err := json.Unmarshal(value, addr); err != nil {
+			return fmt.Errorf("failed to get data by MGET, err: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// mget finds values of keys of a table and adds them to `values` by their keys
+func (r *sqlRepository) mget(ctx context.Context, table *sqlTable, keys [][]interface{}, values map[string][]byte) error {
+	conditions := make([]string, len(keys))
+	args := []interface{}{r.nowMillis()}
+	for i, columns := range keys {
+		conditions[i] = "(" + table.where(len(args)+1) + ")"
+		args = append(args, columns...)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+strings.Join(table.columns()[:len(table.keyColumns)+len(table.valueColumns)], ", ")+
+			` FROM `+table.name+` WHERE (expires_at IS NULL OR expires_at > $1) AND (`+strings.Join(conditions, " OR ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// key columns are selected before value columns
+		keyColumns := make([]string, len(table.keyColumns))
+		dest := make([]interface{}, 0, len(table.keyColumns)+len(table.valueColumns))
+		for i := range keyColumns {
+			dest = append(dest, &keyColumns[i])
+		}
+		valueDest, decode := table.scan()
+		dest = append(dest, valueDest...)
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		value, err := decode(keyColumns)
+		if err != nil {
+			return err
+		}
+		values[table.format(keyColumns)] = value
+	}
+	return rows.Err()
+}
+
+// Del removes `key` and returns whether it existed
+func (r *sqlRepository) Del(ctx context.Context, key string) (bool, error) {
+	table, keys := tableOf(key)
+	var deleted int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// an expired entry isn't counted and it's removed by a sweep
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{`DELETE FROM ` + table.name + ` WHERE ` + table.where(1) + live(len(keys)+1), append(keys, r.nowMillis())},
+			{`DELETE FROM set_members WHERE key = $1`, []interface{}{key}},
+			{`DELETE FROM hash_fields WHERE key = $1`, []interface{}{key}},
+			{`DELETE FROM sorted_members WHERE key = $1`, []interface{}{key}},
+		}
+		for _, statement := range statements {
+			result, err := tx.ExecContext(ctx, statement.query, statement.args...)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete key. err: %v", err)
+	}
+
+	return deleted > 0, nil
+}
+
+// Exists returns whether `key` exists.
+func (r *sqlRepository) Exists(ctx context.Context, key string) (bool, error) {
+	table, keys := tableOf(key)
+	n := len(keys)
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM `+table.name+` WHERE `+table.where(1)+live(n+1)+`) +`+
+			fmt.Sprintf(`
+			(SELECT COUNT(*) FROM set_members WHERE key = $%d) +
+			(SELECT COUNT(*) FROM hash_fields WHERE key = $%d) +
+			(SELECT COUNT(*) FROM sorted_members WHERE key = $%d)`, n+2, n+2, n+2),
+		append(keys, r.nowMillis(), key)...,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check existance: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+// Incr atomically increments the integer stored at `key` by one and returns the new value
+func (r *sqlRepository) Incr(ctx context.Context, key string) (int64, error) {
+	var value int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		value, err = r.increment(ctx, tx, key, 1, nil)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment: %v", err)
+	}
+
+	return value, nil
+}
+
+// IncrIfExists atomically increments the integer stored at `counterKey` by `n` only if `key` exists.
+// The counter expires together with `key`. It returns the new value and whether `key` exists.
+func (r *sqlRepository) IncrIfExists(ctx context.Context, key string, counterKey string, n int64) (int64, bool, error) {
+	var value int64
+	exists := false
+
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		table, keys := tableOf(key)
+
+		// lock `key` so that it can't be deleted until the counter is incremented
+		var expiresAt sql.NullInt64
+		err := tx.QueryRowContext(ctx,
+			`SELECT expires_at FROM `+table.name+` WHERE `+table.where(1)+live(len(keys)+1)+r.dialect.forUpdate,
+			append(keys, r.nowMillis())...,
+		).Scan(&expiresAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		exists = true
+
+		value, err = r.increment(ctx, tx, counterKey, n, &expiresAt)
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to increment counter: %v", err)
+	}
+
+	return value, exists, nil
+}
+
+// increment adds `n` to a counter in a transaction and returns the new value.
+// An expiry of a counter is changed to `expiresAt` unless it's nil.
+func (r *sqlRepository) increment(ctx context.Context, tx *sql.Tx, key string, n int64, expiresAt *sql.NullInt64) (int64, error) {
+	table, keys := tableOf(key)
+	if table.increment == "" {
+		return 0, fmt.Errorf("value of key isn't a counter, key: %s", key)
+	}
+	values, err := table.encode([]byte(strconv.FormatInt(n, 10)))
+	if err != nil {
+		return 0, err
+	}
+
+	// an expired entry of `key` may be left
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM `+table.name+` WHERE `+table.where(1)+fmt.Sprintf(` AND expires_at <= $%d`, len(keys)+1),
+		append(keys, r.nowMillis())...,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// the upsert locks the row until the transaction ends
+	assignments := table.valueColumns[0] + ` = ` + table.increment
+	var expiry sql.NullInt64
+	if expiresAt != nil {
+		assignments += `, expires_at = excluded.expires_at`
+		expiry = *expiresAt
+	}
+	columns := table.columns()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO `+table.name+` (`+strings.Join(columns, ", ")+`) VALUES (`+placeholders(1, len(columns))+`)
+		ON CONFLICT (`+strings.Join(table.keyColumns, ", ")+`) DO UPDATE SET `+assignments,
+		row(keys, values, expiry)...,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	dest, decode := table.scan()
+	err = tx.QueryRowContext(ctx,
+		`SELECT `+strings.Join(table.valueColumns, ", ")+` FROM `+table.name+` WHERE `+table.where(1),
+		keys...,
+	).Scan(dest...)
+	if err != nil {
+		return 0, err
+	}
+	current, err := decode(keyStrings(keys))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(current), 10, 64)
+}
+
+// Rename renames `key` to `newKey` only if `newKey` doesn't exist. The expiry of `key` is kept.
+// A value is moved to a table of `newKey`, e.g. a key of the legacy layout is moved to `urls`.
+func (r *sqlRepository) Rename(ctx context.Context, key string, newKey string) (bool, error) {
+	renamed := false
+
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		now := r.nowMillis()
+		table, keys := tableOf(key)
+		newTable, newKeys := tableOf(newKey)
+
+		var count int
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM `+newTable.name+` WHERE `+newTable.where(1)+live(len(newKeys)+1),
+			append(newKeys, now)...,
+		).Scan(&count)
+		if err != nil || count > 0 {
+			return err
+		}
+
+		var expiresAt sql.NullInt64
+		dest, decode := table.scan()
+		err = tx.QueryRowContext(ctx,
+			`SELECT `+strings.Join(table.valueColumns, ", ")+`, expires_at FROM `+table.name+
+				` WHERE `+table.where(1)+live(len(keys)+1),
+			append(keys, now)...,
+		).Scan(append(dest, &expiresAt)...)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no such key")
+		}
+		if err != nil {
+			return err
+		}
+		value, err := decode(keyStrings(keys))
+		if err != nil {
+			return err
+		}
+		values, err := newTable.encode(value)
+		if err != nil {
+			return err
+		}
+
+		// an expired entry of `newKey` may be left
+		if _, err = tx.ExecContext(ctx, `DELETE FROM `+newTable.name+` WHERE `+newTable.where(1), newKeys...); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `DELETE FROM `+table.name+` WHERE `+table.where(1), keys...); err != nil {
+			return err
+		}
+		if err = upsert(ctx, tx, newTable, newKeys, values, expiresAt); err != nil {
+			return err
+		}
+		renamed = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to rename key: %v", err)
+	}
+
+	return renamed, nil
+}
+
+// SAdd adds a specified member to the set stored at key
+func (r *sqlRepository) SAdd(ctx context.Context, setGroup string, member string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO set_members (key, member) VALUES ($1, $2) ON CONFLICT (key, member) DO NOTHING`,
+		setGroup, member,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to add member, err: %v", err)
+	}
+
+	added, err := affected(result)
+	if err != nil {
+		return false, fmt.Errorf("failed to add member, err: %v", err)
+	}
+	if !added {
+		return false, fmt.Errorf("failed to add member, setGroup: %s, member: %s", setGroup, member)
+	}
+
+	return true, nil
+}
+
+// SIsMember returns whether it is a member of the set stored at key.
+func (r *sqlRepository) SIsMember(ctx context.Context, key string, member string) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM set_members WHERE key = $1 AND member = $2`,
+		key, member,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to search members in set: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+// SMembers returns all members of the set stored at key
+func (r *sqlRepository) SMembers(ctx context.Context, key string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT member FROM set_members WHERE key = $1`, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of set: %v", err)
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var member string
+		if err = rows.Scan(&member); err != nil {
+			return nil, fmt.Errorf("failed to get members of set: %v", err)
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get members of set: %v", err)
+	}
+
+	return members, nil
+}
+
+// SRem removes a member from the set stored at key, it returns false if it isn't a member
+func (r *sqlRepository) SRem(ctx context.Context, key string, member string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM set_members WHERE key = $1 AND member = $2`, key, member)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	removed, err := affected(result)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	return removed, nil
+}
+
+// SAddAll adds members to the set stored at key, a member which is already a member isn't an error unlike SAdd
+func (r *sqlRepository) SAddAll(ctx context.Context, key string, members []string) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for _, member := range members {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO set_members (key, member) VALUES ($1, $2) ON CONFLICT (key, member) DO NOTHING`,
+				key, member,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add members: %v", err)
+	}
+
+	return nil
+}
+
+// ZAdd adds members to the sorted set stored at key, members are sorted byte by byte
+func (r *sqlRepository) ZAdd(ctx context.Context, key string, members ...string) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for _, member := range members {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO sorted_members (key, member) VALUES ($1, $2) ON CONFLICT (key, member) DO NOTHING`,
+				key, member,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add member: %v", err)
+	}
+
+	return nil
+}
+
+// ZRem removes a member from the sorted set stored at key, it returns false if it isn't a member
+func (r *sqlRepository) ZRem(ctx context.Context, key string, member string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sorted_members WHERE key = $1 AND member = $2`, key, member)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	removed, err := affected(result)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove member: %v", err)
+	}
+
+	return removed, nil
+}
+
+// ZRangeByLex returns at most `limit` members of the sorted set stored at key after `start`,
+// or before `start` in reverse order if `desc`. `start` itself is returned only if `inclusive`
+// and all members are returned from the first one if `start` is empty.
+func (r *sqlRepository) ZRangeByLex(ctx context.Context, key string, start string, inclusive bool, desc bool, limit int) ([]string, error) {
+	operator, order := ">", "ASC"
+	if desc {
+		operator, order = "<", "DESC"
+	}
+	if inclusive {
+		operator += "="
+	}
+	// SQLite binds parameters in order of appearance, a limit is the last one
+	condition := ``
+	args := []interface{}{key}
+	if start != "" {
+		condition = ` AND member ` + operator + ` $2`
+		args = append(args, start)
+	}
+	args = append(args, limit)
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT member FROM sorted_members WHERE key = $1`+condition+
+			fmt.Sprintf(` ORDER BY member %s LIMIT $%d`, order, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of sorted set: %v", err)
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var member string
+		if err = rows.Scan(&member); err != nil {
+			return nil, fmt.Errorf("failed to get members of sorted set: %v", err)
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get members of sorted set: %v", err)
+	}
+
+	return members, nil
+}
+
+// ZCountBefore returns the number of members of the sorted set stored at key before `max`
+func (r *sqlRepository) ZCountBefore(ctx context.Context, key string, max string) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sorted_members WHERE key = $1 AND member < $2`, key, max).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	return n, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key
+func (r *sqlRepository) ZCard(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sorted_members WHERE key = $1`, key).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	return n, nil
+}
+
+// HSet sets `field` of the hash stored at `key` to `value`
+func (r *sqlRepository) HSet(ctx context.Context, key string, field string, value string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO hash_fields (key, field, value) VALUES ($1, $2, $3)
+		ON CONFLICT (key, field) DO UPDATE SET value = excluded.value`,
+		key, field, value,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set field: %v", err)
+	}
+
+	return nil
+}
+
+// HMSet sets fields of the hash stored at `key` to their values at once
+func (r *sqlRepository) HMSet(ctx context.Context, key string, values map[string]string) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		for field, value := range values {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO hash_fields (key, field, value) VALUES ($1, $2, $3)
+				ON CONFLICT (key, field) DO UPDATE SET value = excluded.value`,
+				key, field, value,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set fields: %v", err)
+	}
+
+	return nil
+}
+
+// HGet returns the value of `field` of the hash stored at `key` and whether it exists
+func (r *sqlRepository) HGet(ctx context.Context, key string, field string) (string, bool, error) {
+	var value string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT value FROM hash_fields WHERE key = $1 AND field = $2`,
+		key, field,
+	).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get field: %v", err)
+	}
+
+	return value, true, nil
+}
+
+// HDel removes `field` from the hash stored at `key`
+func (r *sqlRepository) HDel(ctx context.Context, key string, field string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM hash_fields WHERE key = $1 AND field = $2`, key, field)
+	if err != nil {
+		return fmt.Errorf("failed to delete field: %v", err)
+	}
+
+	return nil
+}
+
+// HGetAll returns all fields and values of the hash stored at `key`
+func (r *sqlRepository) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT field, value FROM hash_fields WHERE key = $1`, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields: %v", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var field, value string
+		if err = rows.Scan(&field, &value); err != nil {
+			return nil, fmt.Errorf("failed to get fields: %v", err)
+		}
+		values[field] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get fields: %v", err)
+	}
+
+	return values, nil
+}
+
+// HLen returns the number of fields in the hash stored at `key`
+func (r *sqlRepository) HLen(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM hash_fields WHERE key = $1`, key).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count fields: %v", err)
+	}
+
+	return n, nil
+}
+
+// Keys returns all keys matching `pattern`.
+func (r *sqlRepository) Keys(ctx context.Context, pattern string) ([]string, error) {
+	matched := make(map[string]bool)
+	for _, table := range append([]*sqlTable{entriesTable}, sqlTables...) {
+		rows, err := r.db.QueryContext(ctx,
+			`SELECT `+strings.Join(table.keyColumns, ", ")+` FROM `+table.name+` WHERE expires_at IS NULL OR expires_at > $1`,
+			r.nowMillis(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get members: %v", err)
+		}
+		err = scanKeys(rows, len(table.keyColumns), func(columns []string) {
+			if key := table.format(columns); matchGlob(pattern, key) {
+				matched[key] = true
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get members: %v", err)
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT key FROM set_members UNION SELECT key FROM hash_fields UNION SELECT key FROM sorted_members`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %v", err)
+	}
+	err = scanKeys(rows, 1, func(columns []string) {
+		if matchGlob(pattern, columns[0]) {
+			matched[columns[0]] = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %v", err)
+	}
+
+	var keys []string
+	for key := range matched {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// scanKeys calls `fn` with key columns of each row and closes rows
+func scanKeys(rows *sql.Rows, n int, fn func(columns []string)) error {
+	defer rows.Close()
+	for rows.Next() {
+		columns := make([]string, n)
+		dest := make([]interface{}, n)
+		for i := range columns {
+			dest[i] = &columns[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		fn(columns)
+	}
+	return rows.Err()
+}
+
+// Scan returns all keys matching `pattern`, it is the same as Keys in SQL.
+func (r *sqlRepository) Scan(ctx context.Context, pattern string) ([]string, error) {
+	return r.Keys(ctx, pattern)
+}
+
+// Close closes the database
+func (r *sqlRepository) Close() error {
+	return r.db.Close()
+}
+
+// execer is either *sql.DB or *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// upsert sets values and an expiry of a key of a table whether it exists or not
+func upsert(ctx context.Context, db execer, table *sqlTable, keys []interface{}, values []interface{}, expiresAt sql.NullInt64) error {
+	columns := table.columns()
+	assignments := make([]string, 0, len(table.valueColumns)+1)
+	for _, column := range append(table.valueColumns, "expires_at") {
+		assignments = append(assignments, column+" = excluded."+column)
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO `+table.name+` (`+strings.Join(columns, ", ")+`) VALUES (`+placeholders(1, len(columns))+`)
+		ON CONFLICT (`+strings.Join(table.keyColumns, ", ")+`) DO UPDATE SET `+strings.Join(assignments, ", "),
+		row(keys, values, expiresAt)...,
+	)
+	return err
+}
+
+// encode marshals an object to values of value columns of a table
+func encode(table *sqlTable, object interface{}) ([]interface{}, error) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json, err: %v", err)
+	}
+	values, err := table.encode(jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value of %s, err: %v", table.name, err)
+	}
+	return values, nil
+}
+
+// columns returns key columns, value columns and `expires_at` of a table in this order
+func (t *sqlTable) columns() []string {
+	columns := make([]string, 0, len(t.keyColumns)+len(t.valueColumns)+1)
+	columns = append(columns, t.keyColumns...)
+	columns = append(columns, t.valueColumns...)
+	return append(columns, "expires_at")
+}
+
+// where returns a condition of key columns with placeholders from `$n`
+func (t *sqlTable) where(n int) string {
+	conditions := make([]string, len(t.keyColumns))
+	for i, column := range t.keyColumns {
+		conditions[i] = fmt.Sprintf("%s = $%d", column, n+i)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// live returns a condition of rows which aren't expired at a time of a placeholder `$n`
+func live(n int) string {
+	return fmt.Sprintf(" AND (expires_at IS NULL OR expires_at > $%d)", n)
+}
+
+// placeholders returns `count` placeholders from `$n`
+func placeholders(n int, count int) string {
+	list := make([]string, count)
+	for i := range list {
+		list[i] = fmt.Sprintf("$%d", n+i)
+	}
+	return strings.Join(list, ", ")
+}
+
+// row returns arguments of all columns of a table in the order of columns
+func row(keys []interface{}, values []interface{}, expiresAt sql.NullInt64) []interface{} {
+	args := make([]interface{}, 0, len(keys)+len(values)+1)
+	args = append(args, keys...)
+	args = append(args, values...)
+	return append(args, expiresAt)
+}
+
+// keyStrings returns values of key columns as strings
+func keyStrings(keys []interface{}) []string {
+	list := make([]string, len(keys))
+	for i, key := range keys {
+		list[i] = fmt.Sprint(key)
+	}
+	return list
+}
+
+// inTx runs `fn` in a transaction which is committed only if `fn` succeeds
+func (r *sqlRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sweep removes expired entries once in a while
+func (r *sqlRepository) sweep(ctx context.Context) {
+	r.mu.Lock()
+	r.writes++
+	if r.writes < sweepEvery {
+		r.mu.Unlock()
+		return
+	}
+	r.writes = 0
+	r.mu.Unlock()
+
+	// an expired entry is invisible already, a failure only delays the cleanup
+	for _, table := range append([]*sqlTable{entriesTable}, sqlTables...) {
+		r.db.ExecContext(ctx, `DELETE FROM `+table.name+` WHERE expires_at <= $1`, r.nowMillis())
+	}
+}
+
+// expiresAt converts an expiry to milliseconds, nil or zero expiry means no expiry
+func (r *sqlRepository) expiresAt(expiry *time.Time) sql.NullInt64 {
+	if expiry == nil || expiry.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: expiry.UnixNano() / int64(time.Millisecond), Valid: true}
+}
+
+// nowMillis returns current time in milliseconds
+func (r *sqlRepository) nowMillis() int64 {
+	return r.now().UnixNano() / int64(time.Millisecond)
+}
+
+// affected returns whether any row is affected
+func affected(result sql.Result) (bool, error) {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/model"
+)
+
+// sqlTable is a table keeping values of keys of a layout, e.g. url objects.
+// A key is split into key columns and a JSON value into value columns so that a table can be queried by SQL.
+type sqlTable struct {
+	name         string
+	keyColumns   []string
+	valueColumns []string
+	// parse returns values of key columns of a key, it returns false if a key isn't kept in a table
+	parse func(key string) ([]interface{}, bool)
+	// format returns a key of values of key columns
+	format func(keys []string) string
+	// encode converts a JSON value to values of value columns
+	encode func(value []byte) ([]interface{}, error)
+	// scan returns destinations of value columns and a function converting them with values of key columns to a JSON value
+	scan func() ([]interface{}, func(keys []string) ([]byte, error))
+	// increment is an expression adding an inserted counter to an existing one, it's empty if a value isn't a counter
+	increment string
+}
+
+// entriesTable keeps values of any other keys as they are
+var entriesTable = &sqlTable{
+	name:         "entries",
+	keyColumns:   []string{"key"},
+	valueColumns: []string{"value"},
+	parse: func(key string) ([]interface{}, bool) {
+		return []interface{}{key}, true
+	},
+	format: func(keys []string) string {
+		return keys[0]
+	},
+	encode: func(value []byte) ([]interface{}, error) {
+		return []interface{}{string(value)}, nil
+	},
+	scan: func() ([]interface{}, func(keys []string) ([]byte, error)) {
+		var value string
+		return []interface{}{&value}, func(keys []string) ([]byte, error) {
+			return []byte(value), nil
+		}
+	},
+	increment: "CAST(CAST(entries.value AS BIGINT) + CAST(excluded.value AS BIGINT) AS TEXT)",
+}
+
+// urlsTable keeps url objects of keys `url:{shortCode}` of each tenant and domain
+var urlsTable = &sqlTable{
+	name:         "urls",
+	keyColumns:   spaceColumns,
+	valueColumns: []string{"full_url", "owner", "folder", "tags", "base_hits", "created_at", "expiry"},
+	parse:        parseSpaceKey("url:"),
+	format:       formatSpaceKey("url:"),
+	encode: func(value []byte) ([]interface{}, error) {
+		var object model.UrlObject
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, err
+		}
+		return []interface{}{
+			object.FullURL, object.Owner, object.Folder, strings.Join(object.Tags, ","), int64(object.Hits),
+			formatTime(object.CreatedAt), formatTime(object.Expiry),
+		}, nil
+	},
+	scan: func() ([]interface{}, func(keys []string) ([]byte, error)) {
+		var object model.UrlObject
+		var tags string
+		var hits int64
+		var createdAt, expiry *string
+		dest := []interface{}{&object.FullURL, &object.Owner, &object.Folder, &tags, &hits, &createdAt, &expiry}
+		return dest, func(keys []string) ([]byte, error) {
+			object.Tenant, object.Domain, object.ShortCode = keys[0], keys[1], keys[2]
+			object.Tags = splitTags(tags)
+			object.Hits = uint64(hits)
+			object.CreatedAt = parseTime(createdAt)
+			object.Expiry = parseTime(expiry)
+			return json.Marshal(&object)
+		}
+	},
+}
+
+// urlHitsTable keeps hit counters of keys `hits:{shortCode}` of each tenant and domain
+var urlHitsTable = &sqlTable{
+	name:         "url_hits",
+	keyColumns:   spaceColumns,
+	valueColumns: []string{"hits"},
+	parse:        parseSpaceKey("hits:"),
+	format:       formatSpaceKey("hits:"),
+	encode: func(value []byte) ([]interface{}, error) {
+		hits, err := strconv.ParseInt(strings.Trim(string(value), `"`), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("hits must be an integer, value: %s", value)
+		}
+		return []interface{}{hits}, nil
+	},
+	scan: func() ([]interface{}, func(keys []string) ([]byte, error)) {
+		var hits int64
+		return []interface{}{&hits}, func(keys []string) ([]byte, error) {
+			return []byte(strconv.FormatInt(hits, 10)), nil
+		}
+	},
+	increment: "url_hits.hits + excluded.hits",
+}
+
+// deletedUrlsTable keeps deleted url objects of keys `deletedUrl:{shortCode}` of each tenant and domain
+var deletedUrlsTable = &sqlTable{
+	name:       "deleted_urls",
+	keyColumns: spaceColumns,
+	valueColumns: []string{
+		"full_url", "owner", "folder", "tags", "hits", "created_at", "expiry", "deleted_at", "deleted_by",
+	},
+	parse:  parseSpaceKey("deletedUrl:"),
+	format: formatSpaceKey("deletedUrl:"),
+	encode: func(value []byte) ([]interface{}, error) {
+		var object model.UrlObject
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, err
+		}
+		return []interface{}{
+			object.FullURL, object.Owner, object.Folder, strings.Join(object.Tags, ","), int64(object.Hits),
+			formatTime(object.CreatedAt), formatTime(object.Expiry), formatTime(object.DeletedAt), object.DeletedBy,
+		}, nil
+	},
+	scan: func() ([]interface{}, func(keys []string) ([]byte, error)) {
+		var object model.UrlObject
+		var tags string
+		var hits int64
+		var createdAt, expiry, deletedAt *string
+		dest := []interface{}{
+			&object.FullURL, &object.Owner, &object.Folder, &tags, &hits, &createdAt, &expiry, &deletedAt, &object.DeletedBy,
+		}
+		return dest, func(keys []string) ([]byte, error) {
+			object.Tenant, object.Domain, object.ShortCode = keys[0], keys[1], keys[2]
+			object.Tags = splitTags(tags)
+			object.Hits = uint64(hits)
+			object.CreatedAt = parseTime(createdAt)
+			object.Expiry = parseTime(expiry)
+			object.DeletedAt = parseTime(deletedAt)
+			return json.Marshal(&object)
+		}
+	},
+}
+
+// sqlTables are tables of keys of a layout, a key of none of them is kept in entriesTable
+var sqlTables = []*sqlTable{urlsTable, urlHitsTable, deletedUrlsTable}
+
+// tableOf returns a table of a key and values of its key columns
+func tableOf(key string) (*sqlTable, []interface{}) {
+	for _, table := range sqlTables {
+		if keys, ok := table.parse(key); ok {
+			return table, keys
+		}
+	}
+	keys, _ := entriesTable.parse(key)
+	return entriesTable, keys
+}
+
+// spaceColumns identify a short code in a tenant and a domain
+var spaceColumns = []string{"tenant", "domain", "short_code"}
+
+// spaceKeyPattern matches keys of short codes which are prefixed by `tenant:{id}:` other than the default tenant
+// and `domain:{name}:` other than the default domain like keys of the service.
+// Keys of the legacy `url:{shortCode}#{fullUrl}` layout aren't matched.
+var spaceKeyPattern = regexp.MustCompile(`^(?:tenant:([a-z0-9-]+):)?(?:domain:([a-z0-9.-]+):)?([a-zA-Z]+:)([^:#]+)$`)
+
+// parseSpaceKey returns a parser of keys of short codes with a kind of keys, e.g. `url:`
+func parseSpaceKey(kind string) func(key string) ([]interface{}, bool) {
+	return func(key string) ([]interface{}, bool) {
+		match := spaceKeyPattern.FindStringSubmatch(key)
+		if match == nil || match[3] != kind {
+			return nil, false
+		}
+		return []interface{}{match[1], match[2], match[4]}, true
+	}
+}
+
+// formatSpaceKey returns a formatter of keys of short codes with a kind of keys, e.g. `url:`
+func formatSpaceKey(kind string) func(keys []string) string {
+	return func(keys []string) string {
+		var b strings.Builder
+		if keys[0] != "" {
+			b.WriteString("tenant:" + keys[0] + ":")
+		}
+		if keys[1] != "" {
+			b.WriteString("domain:" + keys[1] + ":")
+		}
+		b.WriteString(kind + keys[2])
+		return b.String()
+	}
+}
+
+// sqlTimeLayout is a layout of times in url tables, times are saved in UTC so that they are sorted as text
+const sqlTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// formatTime formats a time of an url object, nil is saved as NULL
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(sqlTimeLayout)
+	return &s
+}
+
+// parseTime parses a time of an url object, an invalid time is treated as NULL
+func parseTime(s *string) *time.Time {
+	if s == nil {
+		return nil
+	}
+	t, err := time.Parse(sqlTimeLayout, *s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// splitTags splits tags saved as comma separated text, tags never have a comma
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
@@ -0,0 +1,562 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/audit"
+	"url-shortener/customError"
+	"url-shortener/domain"
+	"url-shortener/model"
+	"url-shortener/repository"
+	"url-shortener/tenant"
+)
+
+// bulkBatchSize is the number of rows whose short codes, url objects and indexes are written at once by EncodeBulk
+const bulkBatchSize = 500
+
+// MaxBulkUpdate is the maximum number of short codes changed by a BulkUpdate
+const MaxBulkUpdate = 10000
+
+// bulkRow is a row of EncodeBulk which creates a new url object
+type bulkRow struct {
+	index  int
+	space  keySpace
+	object *model.UrlObject
+	alias  *string
+}
+
+// EncodeBulk encodes rows in batches and returns a result of each row in the same order.
+// Rows of a batch which would be deduplicated to each other are encoded once, then short codes are reserved,
+// url objects are saved and indexed with a few writes of the whole batch.
+// A tenant of a context with a quota gets short codes of rows in row order until its quota is reached.
+func (s *service) EncodeBulk(ctx context.Context, requests []model.EncodeRequest) []model.EncodeResult {
+	results := make([]model.EncodeResult, len(requests))
+	for start := 0; start < len(requests); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		// rows which aren't started before a request is cancelled fail without being encoded
+		if err := ctx.Err(); err != nil {
+			for i := start; i < len(requests); i++ {
+				results[i].Err = customError.Unavailable("bulk shortening is cancelled", err)
+			}
+			break
+		}
+
+		s.encodeBatch(ctx, requests[start:end], results[start:end])
+	}
+	return results
+}
+
+// encodeBatch encodes rows of a batch and sets their results
+func (s *service) encodeBatch(ctx context.Context, requests []model.EncodeRequest, results []model.EncodeResult) {
+	// a row deduplicated to a previous row of a batch gets the result of the previous row,
+	// since the previous row isn't indexed yet when a duplicate is looked up
+	leaders := make(map[string]int)
+	followers := make(map[int]int)
+	rows := make([]*bulkRow, 0, len(requests))
+	for i, request := range requests {
+		space := s.encodeSpace(domain.NewContext(ctx, request.Domain))
+		object, err := newObject(space, request.FullURL, request.Options)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if s.dedupes(request.Options) {
+			key := dedupeKey(space, object)
+			if leader, ok := leaders[key]; ok {
+				followers[i] = leader
+				continue
+			}
+			leaders[key] = i
+
+			duplicate, err := s.findDuplicate(ctx, space, request.FullURL, object.Expiry, object.Owner)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			if duplicate != nil {
+				results[i].Object = duplicate
+				continue
+			}
+		}
+		rows = append(rows, &bulkRow{index: i, space: space, object: object, alias: request.Options.Alias})
+	}
+
+	claimed := s.claimBulk(ctx, rows, results)
+	claimed = s.recheckBulkQuota(ctx, claimed, results)
+	if err := s.indexBulk(ctx, claimed); err != nil {
+		for _, row := range claimed {
+			results[row.index].Err = err
+		}
+	} else {
+		for _, row := range claimed {
+			results[row.index].Object = row.object
+		}
+	}
+
+	for i, leader := range followers {
+		results[i] = results[leader]
+	}
+}
+
+// dedupeKey returns a key of url objects which are deduplicated to each other
+func dedupeKey(space keySpace, object *model.UrlObject) string {
+	expiry := ""
+	if object.Expiry != nil {
+		expiry = strconv.FormatInt(object.Expiry.UnixNano(), 10)
+	}
+	return strings.Join([]string{space.prefix, NormalizeUrl(object.FullURL), expiry, object.Owner}, "\x00")
+}
+
+// claimBulk saves url objects of rows at their aliases or generated short codes and returns rows which are saved.
+// Rows are claimed in row order within a quota, a row which fails to be claimed leaves its place to a next row.
+func (s *service) claimBulk(ctx context.Context, rows []*bulkRow, results []model.EncodeResult) []*bulkRow {
+	id, _ := tenant.FromContext(ctx)
+	quota := s.config.Tenants.Get(id).Quota
+	if quota <= 0 {
+		return s.claimRows(ctx, rows, results)
+	}
+
+	n, err := s.countShortCodes(ctx, id)
+	if err != nil {
+		for _, row := range rows {
+			results[row.index].Err = err
+		}
+		return nil
+	}
+	var claimed []*bulkRow
+	for len(rows) > 0 && n < int64(quota) {
+		size := int64(quota) - n
+		if size > int64(len(rows)) {
+			size = int64(len(rows))
+		}
+		saved := s.claimRows(ctx, rows[:size], results)
+		claimed = append(claimed, saved...)
+		n += int64(len(saved))
+		rows = rows[size:]
+	}
+	for _, row := range rows {
+		results[row.index].Err = errQuotaExceeded(quota)
+	}
+	return claimed
+}
+
+// recheckBulkQuota indexes claimed rows in sort indexes, which counts them in a quota, and releases the last rows
+// over a quota of a tenant of a context if concurrent claims exceed it. It returns rows which are kept.
+func (s *service) recheckBulkQuota(ctx context.Context, rows []*bulkRow, results []model.EncodeResult) []*bulkRow {
+	fail := func(rows []*bulkRow, err error) {
+		for _, row := range rows {
+			results[row.index].Err = err
+		}
+	}
+	if err := s.indexBulkSorted(ctx, rows); err != nil {
+		fail(rows, err)
+		return nil
+	}
+
+	id, _ := tenant.FromContext(ctx)
+	quota := s.config.Tenants.Get(id).Quota
+	if quota <= 0 || len(rows) == 0 {
+		return rows
+	}
+	n, err := s.countShortCodes(ctx, id)
+	if err != nil {
+		fail(rows, err)
+		return nil
+	}
+
+	kept := len(rows)
+	if excess := n - int64(quota); excess > 0 {
+		kept -= int(excess)
+		if kept < 0 {
+			kept = 0
+		}
+	}
+	for _, row := range rows[kept:] {
+		results[row.index].Err = errQuotaExceeded(quota)
+		if err = s.release(ctx, row.space, row.object); err != nil {
+			results[row.index].Err = err
+		}
+	}
+	return rows[:kept]
+}
+
+// claimRows saves url objects of rows like claimAlias and claimGenerated, but short codes of all rows are
+// reserved at once and url objects are saved at once. Another code is generated for a row on collision.
+func (s *service) claimRows(ctx context.Context, rows []*bulkRow, results []model.EncodeResult) []*bulkRow {
+	aliasTaken := customError.Conflict(customError.CodeAliasTaken, "this alias is already taken")
+
+	var claimed []*bulkRow
+	pending := rows
+	for attempt := 0; len(pending) > 0; attempt++ {
+		var retried, tried []*bulkRow
+		tryLater := func(row *bulkRow) {
+			if row.alias != nil {
+				results[row.index].Err = aliasTaken
+				return
+			}
+			retried = append(retried, row)
+		}
+
+		// a short code is tried by one row of a batch
+		seen := make(map[string]bool, len(pending))
+		for _, row := range pending {
+			shortCode := ""
+			if row.alias != nil {
+				shortCode = *row.alias
+			} else if attempt == maxGenerateAttempts {
+				results[row.index].Err = customError.Internal(
+					customError.CodeGenerationFailed,
+					fmt.Sprintf("failed to generate unique short code after %d attempts", maxGenerateAttempts),
+					nil,
+				)
+				continue
+			} else {
+				code, err := s.config.Generator.Generate(ctx)
+				if err != nil {
+					results[row.index].Err = customError.Internal(customError.CodeGenerationFailed, "failed to generate short code", err)
+					continue
+				}
+				shortCode = code
+			}
+
+			// a deleted short code isn't reused until it is purged
+			deleted, err := s.isDeleted(ctx, row.space, shortCode)
+			if err != nil {
+				results[row.index].Err = err
+				continue
+			}
+			reservation := row.space.reservation(shortCode)
+			if deleted || seen[reservation] {
+				tryLater(row)
+				continue
+			}
+			seen[reservation] = true
+			row.object.ShortCode = shortCode
+			tried = append(tried, row)
+		}
+
+		saved, collided := s.claimTried(ctx, tried, results)
+		claimed = append(claimed, saved...)
+		for _, row := range collided {
+			tryLater(row)
+		}
+		pending = retried
+	}
+
+	// rows are indexed in row order so that the latest short code of a full url is reused in dedupe mode
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].index < claimed[j].index
+	})
+	return claimed
+}
+
+// claimTried reserves short codes of rows and saves their url objects, it returns rows which are saved
+// and rows whose short codes are taken
+func (s *service) claimTried(ctx context.Context, rows []*bulkRow, results []model.EncodeResult) ([]*bulkRow, []*bulkRow) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	fail := func(rows []*bulkRow, err error) {
+		for _, row := range rows {
+			results[row.index].Err = err
+		}
+	}
+
+	// short codes are reserved for a tenant first so that they're unique across tenants
+	entries := make([]repository.Entry, len(rows))
+	for i, row := range rows {
+		entries[i] = repository.Entry{Key: row.space.reservation(row.object.ShortCode), Object: row.space.tenant, Expiry: row.object.Expiry}
+	}
+	reserved, err := s.repository.MSetNX(ctx, entries)
+	if err != nil {
+		fail(rows, customError.Unavailable("failed to reserve short code", err))
+		return nil, nil
+	}
+	var reservedRows, collided []*bulkRow
+	for i, row := range rows {
+		if reserved[i] {
+			reservedRows = append(reservedRows, row)
+			continue
+		}
+		collided = append(collided, row)
+	}
+
+	saved, err := s.claimReservedRows(ctx, reservedRows)
+	if err != nil {
+		fail(reservedRows, err)
+	}
+	var claimed []*bulkRow
+	for i, row := range reservedRows {
+		if err == nil && saved[i] {
+			claimed = append(claimed, row)
+			continue
+		}
+		// release a reservation, a short code of the default tenant is found without it
+		if _, delErr := s.repository.Del(ctx, row.space.reservation(row.object.ShortCode)); delErr != nil && err == nil {
+			results[row.index].Err = customError.Unavailable("failed to release short code", delErr)
+			continue
+		}
+		if err == nil {
+			collided = append(collided, row)
+		}
+	}
+	return claimed, collided
+}
+
+// claimReservedRows saves url objects of rows at reserved short codes like claimReserved and returns whether each one is saved
+func (s *service) claimReservedRows(ctx context.Context, rows []*bulkRow) ([]bool, error) {
+	saved := make([]bool, len(rows))
+	if len(rows) == 0 {
+		return saved, nil
+	}
+
+	// short codes of the default tenant saved before tenants were introduced aren't reserved
+	legacy := make([]*model.UrlObject, len(rows))
+	if rows[0].space.tenant != tenant.Default {
+		keys := make([]interface{}, len(rows))
+		for i, row := range rows {
+			keys[i] = newKeySpace(tenant.Default, row.space.domain).object(row.object.ShortCode)
+		}
+		if err := s.repository.MGet(ctx, keys, &legacy); err != nil {
+			return nil, customError.Unavailable("failed to get url", err)
+		}
+	}
+
+	var entries []repository.Entry
+	var indexes []int
+	for i, row := range rows {
+		if legacy[i] != nil {
+			continue
+		}
+		entries = append(entries, repository.Entry{Key: row.space.object(row.object.ShortCode), Object: row.object, Expiry: row.object.Expiry})
+		indexes = append(indexes, i)
+	}
+	if len(entries) == 0 {
+		return saved, nil
+	}
+	set, err := s.repository.MSetNX(ctx, entries)
+	if err != nil {
+		return nil, customError.Unavailable("failed to set object", err)
+	}
+	for i, index := range indexes {
+		saved[index] = set[i]
+	}
+	return saved, nil
+}
+
+// bulkIndexes are indexes of a key space written at once for rows of a batch
+type bulkIndexes struct {
+	space   keySpace
+	index   map[string]string
+	reverse map[string]string
+	tags    map[string][]string
+}
+
+// indexBulk indexes url objects of rows in full url and tag indexes like Encode, each index of a key space is written once
+func (s *service) indexBulk(ctx context.Context, rows []*bulkRow) error {
+	var spaces []*bulkIndexes
+	bySpace := make(map[string]*bulkIndexes)
+	for _, row := range rows {
+		indexes, ok := bySpace[row.space.prefix]
+		if !ok {
+			indexes = &bulkIndexes{
+				space:   row.space,
+				index:   make(map[string]string),
+				reverse: make(map[string]string),
+				tags:    make(map[string][]string),
+			}
+			bySpace[row.space.prefix] = indexes
+			spaces = append(spaces, indexes)
+		}
+
+		object := row.object
+		indexes.index[object.ShortCode] = object.FullURL
+		indexes.reverse[NormalizeUrl(object.FullURL)] = object.ShortCode
+		for _, tag := range object.Tags {
+			indexes.tags[tag] = append(indexes.tags[tag], object.ShortCode)
+		}
+	}
+
+	for _, indexes := range spaces {
+		space := indexes.space
+		if err := s.repository.HMSet(ctx, space.index(), indexes.index); err != nil {
+			return customError.Unavailable("failed to index object", err)
+		}
+		if err := s.repository.HMSet(ctx, space.reverseIndex(), indexes.reverse); err != nil {
+			return customError.Unavailable("failed to index object", err)
+		}
+
+		tags := make([]string, 0, len(indexes.tags))
+		for tag, codes := range indexes.tags {
+			if err := s.repository.SAddAll(ctx, space.tag(tag), codes); err != nil {
+				return customError.Unavailable("failed to index tag", err)
+			}
+			tags = append(tags, tag)
+		}
+		if len(tags) > 0 {
+			if err := s.repository.SAddAll(ctx, space.tags(), tags); err != nil {
+				return customError.Unavailable("failed to index tag", err)
+			}
+		}
+	}
+	return nil
+}
+
+// indexBulkSorted indexes url objects of rows in all orders, each sort index of a key space is written once
+func (s *service) indexBulkSorted(ctx context.Context, rows []*bulkRow) error {
+	var spaces []keySpace
+	members := make(map[string]map[string][]string)
+	for _, row := range rows {
+		sorted, ok := members[row.space.prefix]
+		if !ok {
+			sorted = make(map[string][]string)
+			members[row.space.prefix] = sorted
+			spaces = append(spaces, row.space)
+		}
+		for _, sortName := range sortNames {
+			sorted[sortName] = append(sorted[sortName], sortMember(sortName, sortValue(sortName, row.object), row.object.ShortCode))
+		}
+	}
+
+	for _, space := range spaces {
+		for _, sortName := range sortNames {
+			if err := s.repository.ZAdd(ctx, space.sortIndex(sortName), members[space.prefix][sortName]...); err != nil {
+				return customError.Unavailable("failed to index object", err)
+			}
+		}
+	}
+	return nil
+}
+
+// BulkUpdate deletes, expires or sets an expiry of listed short codes or short codes matching a query.
+// A listed short code which isn't found or is of another owner fails without stopping other short codes.
+// Each change is recorded in an audit entry, nothing is changed in a dry run.
+func (s *service) BulkUpdate(ctx context.Context, request model.BulkUpdateRequest) ([]model.BulkUpdateResult, error) {
+	var results []model.BulkUpdateResult
+	var err error
+	if len(request.ShortCodes) > 0 {
+		results = s.bulkListed(ctx, request)
+	} else if results, err = s.bulkMatched(ctx, request.Query); err != nil {
+		return nil, err
+	}
+	if request.DryRun {
+		return results, nil
+	}
+
+	for i := range results {
+		result := &results[i]
+		if result.Err != nil {
+			continue
+		}
+
+		// a short code is changed in its own tenant and domain, which may differ from a context listing all of them
+		object := result.Object
+		objectCtx := tenant.NewContext(domain.NewContext(ctx, object.Domain), object.Tenant)
+		now := time.Now()
+		entry := audit.Entry{
+			Time:      now,
+			Actor:     request.Actor,
+			Action:    request.Action,
+			ShortCode: object.ShortCode,
+			Tenant:    object.Tenant,
+			Domain:    object.Domain,
+		}
+		switch request.Action {
+		case model.BulkDelete:
+			_, err = s.DeleteUrl(objectCtx, object.ShortCode, request.Actor)
+		case model.BulkExpire:
+			entry.Expiry = &now
+			_, err = s.Update(objectCtx, object.ShortCode, model.UpdateOptions{Expiry: &now})
+		case model.BulkSetExpiry:
+			// a zero expiry removes an expiry
+			expiry := time.Time{}
+			if request.Expiry != nil {
+				expiry = *request.Expiry
+			}
+			entry.Expiry = request.Expiry
+			_, err = s.Update(objectCtx, object.ShortCode, model.UpdateOptions{Expiry: &expiry})
+		default:
+			err = customError.Validation(customError.CodeInvalidInput, fmt.Sprintf("unknown bulk action: %s", request.Action))
+		}
+		if err != nil {
+			result.Err = err
+			continue
+		}
+		s.record(ctx, entry)
+	}
+	return results, nil
+}
+
+// bulkListed finds listed short codes in a domain of a context, a short code listed twice is changed once
+func (s *service) bulkListed(ctx context.Context, request model.BulkUpdateRequest) []model.BulkUpdateResult {
+	seen := make(map[string]bool, len(request.ShortCodes))
+	results := make([]model.BulkUpdateResult, 0, len(request.ShortCodes))
+	for _, code := range request.ShortCodes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		result := model.BulkUpdateResult{ShortCode: code}
+		object, err := s.GetUrlObject(ctx, code)
+		switch {
+		case err != nil:
+			result.Err = err
+		case request.Owner != nil && object.Owner != *request.Owner:
+			result.Err = customError.Forbidden(fmt.Sprintf(
+				"short code %s isn't owned by caller %s, only its owner or an admin can manage it",
+				code, *request.Owner,
+			))
+		default:
+			result.Object = object
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// bulkMatched finds all short codes matching a query, it fails if they're more than MaxBulkUpdate.
+// Short codes are listed once in a single listing of one more than MaxBulkUpdate entries instead of paging through them.
+func (s *service) bulkMatched(ctx context.Context, query model.UrlQuery) ([]model.BulkUpdateResult, error) {
+	if query.Sort == "" {
+		query.Sort = model.SortShortCode
+	}
+	query.Cursor = ""
+	query.Limit = MaxBulkUpdate
+	entries, _, err := s.listEntries(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > MaxBulkUpdate {
+		return nil, customError.Validation(
+			customError.CodeInvalidQuery,
+			fmt.Sprintf("more than %d short codes match a filter, at most %d short codes can be changed at once", MaxBulkUpdate, MaxBulkUpdate),
+		)
+	}
+
+	results := make([]model.BulkUpdateResult, len(entries))
+	for i, entry := range entries {
+		results[i] = model.BulkUpdateResult{ShortCode: entry.shortCode, Object: entry.object}
+	}
+	return results, nil
+}
+
+// record records an audit entry of a change which is already made, so a failure is only logged
+func (s *service) record(ctx context.Context, entry audit.Entry) {
+	if s.config.Audit == nil {
+		return
+	}
+	if err := s.config.Audit.Record(ctx, entry); err != nil {
+		log.Printf("failed to record audit entry, entry: %+v, err: %v", entry, err)
+	}
+}
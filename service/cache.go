@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"url-shortener/cache"
+	"url-shortener/customError"
+	"url-shortener/domain"
+	"url-shortener/model"
+	"url-shortener/repository"
+)
+
+// CachedService is a Service serving popular short codes from an in-process cache
+type CachedService interface {
+	Service
+	// Stats returns hit and miss counters of the cache
+	Stats() cache.Stats
+	// Close stops the background flusher and writes pending hits to the repository
+	Close(ctx context.Context) error
+}
+
+// defaultFlushInterval is used when flush interval isn't specified
+const defaultFlushInterval = 10 * time.Second
+
+// cachedService decorates service with a LRU cache of short code to full url.
+// Hits served from the cache are counted in memory and flushed to the repository in batches.
+type cachedService struct {
+	*service
+	cache *cache.LRU
+
+	mu      sync.Mutex
+	pending map[codeRef]uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// codeRef is a short code in a short domain, the same short code may exist in several domains
+type codeRef struct {
+	domain    string
+	shortCode string
+}
+
+// refOf returns a short code in a domain of a context
+func refOf(ctx context.Context, shortCode string) codeRef {
+	return codeRef{domain: domain.FromContext(ctx), shortCode: shortCode}
+}
+
+// String returns a key of a short code in the cache
+func (r codeRef) String() string {
+	return r.domain + "/" + r.shortCode
+}
+
+// NewCached is a constructor of CachedService.
+// Up to `size` short codes are cached for at most `ttl` and pending hits are flushed every `flushInterval`.
+func NewCached(repo repository.Repository, config Config, size int, ttl time.Duration, flushInterval time.Duration) CachedService {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	c := &cachedService{
+		service: newService(repo, config),
+		cache:   cache.New(size, ttl),
+		pending: make(map[codeRef]uint64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run(flushInterval)
+	return c
+}
+
+// Decode finds a full url for specified short code from cache first
+func (c *cachedService) Decode(ctx context.Context, shortCode string) (string, error) {
+	ref := refOf(ctx, shortCode)
+	if fullUrl, ok := c.cache.Get(ref.String()); ok {
+		c.countHit(ref)
+		return fullUrl.(string), nil
+	}
+
+	space, err := c.spaceOf(ctx, shortCode)
+	if err != nil {
+		return "", err
+	}
+	_, object, err := c.find(ctx, space, shortCode)
+	if err != nil {
+		return "", err
+	}
+
+	var expiresAt time.Time
+	if object.Expiry != nil {
+		expiresAt = *object.Expiry
+	}
+	c.cache.Add(ref.String(), object.FullURL, expiresAt)
+	c.countHit(ref)
+
+	return object.FullURL, nil
+}
+
+// GetUrlObject flushes pending hits of a short code before finding its url object so that its hit count is up to date.
+// It is reachable from public routes, so other pending hits are left to the background flusher.
+func (c *cachedService) GetUrlObject(ctx context.Context, shortCode string) (*model.UrlObject, error) {
+	c.flushRef(ctx, refOf(ctx, shortCode))
+	return c.service.GetUrlObject(ctx, shortCode)
+}
+
+// GetUrlObjects flushes pending hits before listing url objects so that hit counts are up to date
+func (c *cachedService) GetUrlObjects(ctx context.Context, query model.UrlQuery) ([]*model.UrlObject, *model.Page, error) {
+	c.flush(ctx)
+	return c.service.GetUrlObjects(ctx, query)
+}
+
+// DeleteUrl removes a short code and invalidates its cache,
+// pending hits are flushed first so that they are kept in a deleted url object.
+// The cache is invalidated again after deletion since a concurrent Decode may cache it in the meantime.
+func (c *cachedService) DeleteUrl(ctx context.Context, shortCode string, actor string) (bool, error) {
+	ref := refOf(ctx, shortCode)
+	c.cache.Remove(ref.String())
+	c.flushRef(ctx, ref)
+	deleted, err := c.service.DeleteUrl(ctx, shortCode, actor)
+	c.cache.Remove(ref.String())
+	return deleted, err
+}
+
+// UpdateExpiry changes an expiry of specified short code and invalidates its cache
+func (c *cachedService) UpdateExpiry(ctx context.Context, shortCode string, expiry *time.Time) (bool, error) {
+	updated, err := c.service.UpdateExpiry(ctx, shortCode, expiry)
+	c.cache.Remove(refOf(ctx, shortCode).String())
+	return updated, err
+}
+
+// Update changes specified short code and invalidates its cache,
+// pending hits are flushed first so that a returned hit count is up to date
+func (c *cachedService) Update(ctx context.Context, shortCode string, options model.UpdateOptions) (*model.UrlObject, error) {
+	ref := refOf(ctx, shortCode)
+	c.flushRef(ctx, ref)
+	object, err := c.service.Update(ctx, shortCode, options)
+	c.cache.Remove(ref.String())
+	return object, err
+}
+
+// BulkUpdate flushes pending hits before changing short codes and invalidates caches of changed ones
+func (c *cachedService) BulkUpdate(ctx context.Context, request model.BulkUpdateRequest) ([]model.BulkUpdateResult, error) {
+	c.flush(ctx)
+	results, err := c.service.BulkUpdate(ctx, request)
+	if err != nil || request.DryRun {
+		return results, err
+	}
+	for _, result := range results {
+		if result.Err == nil {
+			c.cache.Remove(codeRef{domain: result.Object.Domain, shortCode: result.ShortCode}.String())
+		}
+	}
+	return results, nil
+}
+
+// GetTagStats flushes pending hits before counting hits of tags so that they are up to date
+func (c *cachedService) GetTagStats(ctx context.Context, owner *string, domain *string) ([]*model.TagStats, error) {
+	c.flush(ctx)
+	return c.service.GetTagStats(ctx, owner, domain)
+}
+
+// Stats returns hit and miss counters of the cache
+func (c *cachedService) Stats() cache.Stats {
+	return c.cache.Stats()
+}
+
+// Close stops the background flusher and writes pending hits to the repository
+func (c *cachedService) Close(ctx context.Context) error {
+	close(c.stop)
+	<-c.done
+	c.flush(ctx)
+	return nil
+}
+
+// countHit records a hit which will be written by the next flush
+func (c *cachedService) countHit(ref codeRef) {
+	c.mu.Lock()
+	c.pending[ref]++
+	c.mu.Unlock()
+}
+
+// run flushes pending hits periodically until Close is called
+func (c *cachedService) run(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flush(context.Background())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// flush writes all pending hits to the repository.
+// Hits failed to be written are kept for the next flush unless the short code no longer exists.
+func (c *cachedService) flush(ctx context.Context) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[codeRef]uint64)
+	c.mu.Unlock()
+
+	for ref, hits := range pending {
+		c.writeHits(ctx, ref, hits)
+	}
+
+	// moves in the hits order are written in batches too, so a failure never drops counted hits
+	if err := c.writeHitsMoves(ctx); err != nil {
+		log.Printf("failed to move short codes in hits order, err: %v", err)
+	}
+}
+
+// flushRef writes pending hits of a short code to the repository
+func (c *cachedService) flushRef(ctx context.Context, ref codeRef) {
+	c.mu.Lock()
+	hits, ok := c.pending[ref]
+	delete(c.pending, ref)
+	c.mu.Unlock()
+
+	if ok {
+		c.writeHits(ctx, ref, hits)
+	}
+}
+
+// writeHits adds hits of a short code to the repository, they are kept pending if they fail to be written
+func (c *cachedService) writeHits(ctx context.Context, ref codeRef, hits uint64) {
+	// short codes are unique across tenants, so a tenant is found by a short code
+	// even if pending hits are flushed by a request of another tenant
+	space, err := c.reservedSpace(ctx, ref.domain, ref.shortCode)
+	var object *model.UrlObject
+	if err == nil {
+		_, object, err = c.find(ctx, space, ref.shortCode)
+	}
+	if err == nil {
+		err = c.addHits(ctx, space, object, hits)
+	}
+	if err == nil {
+		return
+	}
+	var cerr *customError.Error
+	if errors.As(err, &cerr) && (cerr.Kind == customError.KindNotFound || cerr.Kind == customError.KindGone) {
+		// a short code is deleted or expired
+		c.cache.Remove(ref.String())
+		return
+	}
+
+	log.Printf("failed to flush hits, shortCode: %s, err: %v", ref, err)
+	c.mu.Lock()
+	c.pending[ref] += hits
+	c.mu.Unlock()
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+	"url-shortener/customError"
+	"url-shortener/model"
+	"url-shortener/repository"
+)
+
+// GetDeletedUrls finds deleted url objects with filtered owner and short domain.
+// Deleted url objects whose retention is expired are purged instead of being returned.
+func (s *service) GetDeletedUrls(ctx context.Context, owner *string, domain *string) ([]*model.UrlObject, error) {
+	var urlObjects []*model.UrlObject
+	for _, space := range s.listSpaces(ctx, domain) {
+		objects, _, err := s.deletedObjects(ctx, space)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if owner != nil && object.Owner != *owner {
+				continue
+			}
+			urlObjects = append(urlObjects, object)
+		}
+	}
+	return urlObjects, nil
+}
+
+// PurgeExpiredUrls purges deleted url objects whose retention is expired in all key spaces of a context
+// and returns the number of purged short codes
+func (s *service) PurgeExpiredUrls(ctx context.Context) (int, error) {
+	if s.config.DeletedRetention <= 0 {
+		return 0, nil
+	}
+	total := 0
+	for _, space := range s.listSpaces(ctx, nil) {
+		_, purged, err := s.deletedObjects(ctx, space)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// deletedObjects returns deleted url objects of a key space sorted by short codes.
+// Deleted url objects whose retention is expired are purged instead and counted.
+func (s *service) deletedObjects(ctx context.Context, space keySpace) ([]*model.UrlObject, int, error) {
+	shortCodes, err := s.repository.SMembers(ctx, space.deleted())
+	if err != nil {
+		return nil, 0, customError.Unavailable("failed to get deleted short codes", err)
+	}
+	if len(shortCodes) == 0 {
+		return nil, 0, nil
+	}
+	sort.Strings(shortCodes)
+
+	keys := make([]interface{}, len(shortCodes))
+	for i, code := range shortCodes {
+		keys[i] = space.tombstone(code)
+	}
+	objects := make([]*model.UrlObject, len(keys))
+	err = s.repository.MGet(ctx, keys, &objects)
+	if err != nil {
+		return nil, 0, customError.Unavailable("failed to get deleted urls", err)
+	}
+
+	kept := make([]*model.UrlObject, 0, len(objects))
+	purged := 0
+	for i, object := range objects {
+		if object == nil {
+			// a short code is deleted before deleted url objects were kept
+			object = &model.UrlObject{ShortCode: shortCodes[i], Tenant: space.tenant, Domain: space.domain}
+		}
+		if s.retentionExpired(object) {
+			if err = s.purge(ctx, space, shortCodes[i]); err != nil {
+				return nil, purged, err
+			}
+			purged++
+			continue
+		}
+		kept = append(kept, object)
+	}
+	return kept, purged, nil
+}
+
+// GetDeletedUrl finds a deleted url object of specified short code
+func (s *service) GetDeletedUrl(ctx context.Context, shortCode string) (*model.UrlObject, error) {
+	space, err := s.spaceOf(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return s.findDeleted(ctx, space, shortCode)
+}
+
+// RestoreUrl restores a deleted short code with its hits if its retention isn't expired
+func (s *service) RestoreUrl(ctx context.Context, shortCode string) (*model.UrlObject, error) {
+	space, err := s.spaceOf(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.findDeleted(ctx, space, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if object.DeletedAt == nil {
+		return nil, customError.Conflict(
+			customError.CodeNotRestorable,
+			"this short code was deleted before deleted urls were kept, it can only be purged",
+		)
+	}
+	if object.Expiry != nil && !object.Expiry.After(time.Now()) {
+		// an expired short code can't be restored, so it's purged instead of being kept until its retention expires
+		if err = s.purge(ctx, space, shortCode); err != nil {
+			return nil, err
+		}
+		return nil, errNotFound()
+	}
+
+	// a restored short code is counted in a quota again
+	if err = s.checkQuota(ctx, space); err != nil {
+		return nil, err
+	}
+
+	object.DeletedAt = nil
+	object.DeletedBy = ""
+	set, err := s.repository.SetNX(ctx, space.object(shortCode), object, object.Expiry)
+	if err != nil {
+		return nil, customError.Unavailable("failed to restore url", err)
+	}
+	if !set {
+		return nil, customError.Conflict(customError.CodeAliasTaken, "this short code is already in use")
+	}
+
+	// a restored short code is kept deleted if concurrent claims exceed a quota
+	if err = s.indexSorted(ctx, space, object); err != nil {
+		return nil, err
+	}
+	if err = s.recheckQuota(ctx, space); err != nil {
+		if unclaimErr := s.unclaim(ctx, space, object); unclaimErr != nil {
+			return nil, unclaimErr
+		}
+		return nil, err
+	}
+
+	// a short code is found once it isn't deleted
+	_, err = s.repository.SRem(ctx, space.deleted(), shortCode)
+	if err != nil {
+		return nil, customError.Unavailable("failed to restore url", err)
+	}
+	_, err = s.repository.Del(ctx, space.tombstone(shortCode))
+	if err != nil {
+		return nil, customError.Unavailable("failed to restore url", err)
+	}
+	_, err = s.repository.ExpireAt(ctx, space.reservation(shortCode), object.Expiry)
+	if err != nil {
+		return nil, customError.Unavailable("failed to update expiry of short code reservation", err)
+	}
+
+	// index a full url again, the reverse index isn't changed if a newer short code of the same url exists
+	err = s.repository.HSet(ctx, space.index(), shortCode, object.FullURL)
+	if err != nil {
+		return nil, customError.Unavailable("failed to index object", err)
+	}
+	normalized := NormalizeUrl(object.FullURL)
+	_, ok, err := s.repository.HGet(ctx, space.reverseIndex(), normalized)
+	if err != nil {
+		return nil, customError.Unavailable("failed to get index", err)
+	}
+	if !ok {
+		if err = s.repository.HSet(ctx, space.reverseIndex(), normalized, shortCode); err != nil {
+			return nil, customError.Unavailable("failed to index object", err)
+		}
+	}
+	if err = s.indexTags(ctx, space, shortCode, object.Tags); err != nil {
+		return nil, err
+	}
+
+	return object, nil
+}
+
+// PurgeUrl permanently removes a deleted short code, it can be reused after that
+func (s *service) PurgeUrl(ctx context.Context, shortCode string) error {
+	space, err := s.spaceOf(ctx, shortCode)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repository.SIsMember(ctx, space.deleted(), shortCode)
+	if err != nil {
+		return customError.Unavailable("failed to check deleted short codes", err)
+	}
+	if !deleted {
+		return errNotDeleted()
+	}
+	return s.purge(ctx, space, shortCode)
+}
+
+// isDeleted reports whether a short code is deleted, it is purged if its retention is expired
+func (s *service) isDeleted(ctx context.Context, space keySpace, shortCode string) (bool, error) {
+	deleted, err := s.repository.SIsMember(ctx, space.deleted(), shortCode)
+	if err != nil {
+		return false, customError.Unavailable("failed to check deleted short codes", err)
+	}
+	if !deleted || s.config.DeletedRetention <= 0 {
+		return deleted, nil
+	}
+
+	var object model.UrlObject
+	err = s.repository.Get(ctx, space.tombstone(shortCode), &object)
+	if err == repository.ErrNotFound {
+		// a short code deleted before deleted url objects were kept is only purged manually
+		return true, nil
+	}
+	if err != nil {
+		return false, customError.Unavailable("failed to get deleted url", err)
+	}
+	if !s.retentionExpired(&object) {
+		return true, nil
+	}
+
+	if err = s.purge(ctx, space, shortCode); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// findDeleted returns a deleted url object of specified short code in a key space.
+// A deleted url object whose retention is expired is purged.
+func (s *service) findDeleted(ctx context.Context, space keySpace, shortCode string) (*model.UrlObject, error) {
+	deleted, err := s.repository.SIsMember(ctx, space.deleted(), shortCode)
+	if err != nil {
+		return nil, customError.Unavailable("failed to check deleted short codes", err)
+	}
+	if !deleted {
+		return nil, errNotDeleted()
+	}
+
+	var object model.UrlObject
+	err = s.repository.Get(ctx, space.tombstone(shortCode), &object)
+	if err == repository.ErrNotFound {
+		// a short code is deleted before deleted url objects were kept
+		return &model.UrlObject{ShortCode: shortCode, Tenant: space.tenant, Domain: space.domain}, nil
+	}
+	if err != nil {
+		return nil, customError.Unavailable("failed to get deleted url", err)
+	}
+
+	if s.retentionExpired(&object) {
+		if err = s.purge(ctx, space, shortCode); err != nil {
+			return nil, err
+		}
+		return nil, customError.Gone(customError.CodeRetentionExpired, "retention of this deleted short code is expired")
+	}
+	return &object, nil
+}
+
+// purge removes a deleted url object and its reservation so that its short code can be reused
+func (s *service) purge(ctx context.Context, space keySpace, shortCode string) error {
+	_, err := s.repository.Del(ctx, space.tombstone(shortCode))
+	if err != nil {
+		return customError.Unavailable("failed to purge deleted url", err)
+	}
+	_, err = s.repository.Del(ctx, space.reservation(shortCode))
+	if err != nil {
+		return customError.Unavailable("failed to release short code", err)
+	}
+	_, err = s.repository.SRem(ctx, space.deleted(), shortCode)
+	if err != nil {
+		return customError.Unavailable("failed to purge deleted url", err)
+	}
+	return nil
+}
+
+// retentionExpired reports whether a deleted url object can no longer be restored
+func (s *service) retentionExpired(object *model.UrlObject) bool {
+	return s.config.DeletedRetention > 0 && object.DeletedAt != nil &&
+		time.Since(*object.DeletedAt) > s.config.DeletedRetention
+}
+
+// errNotDeleted returns an error of a short code which isn't deleted
+func errNotDeleted() error {
+	return customError.NotFound(customError.CodeShortCodeNotFound, "this short code is not deleted")
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"url-shortener/customError"
+	"url-shortener/domain"
+	"url-shortener/repository"
+	"url-shortener/tenant"
+)
+
+// key of a tenant of a short code, it has a pattern `codeTenant:{shortCode}` with a prefix of its domain.
+// It is shared by all tenants so that a short code is unique across tenants and public routes find its tenant.
+const codeTenantKeyPattern = "codeTenant:%s"
+
+// prefix of keys of a tenant other than the default one, it has a pattern `tenant:{id}:`
+const tenantPrefixPattern = "tenant:%s:"
+
+// prefix of keys of a short domain other than the default one, it has a pattern `domain:{name}:`
+const domainPrefixPattern = "domain:%s:"
+
+// keySpace builds keys of a tenant in a short domain, each domain has its own short codes.
+// Keys of the default tenant and domain have no prefix so that data saved before they were introduced is kept.
+type keySpace struct {
+	tenant string
+	domain string
+	prefix string
+}
+
+// newKeySpace returns a key space of a tenant in a short domain
+func newKeySpace(id string, name string) keySpace {
+	space := keySpace{tenant: id, domain: name}
+	if id != tenant.Default {
+		space.prefix = fmt.Sprintf(tenantPrefixPattern, id)
+	}
+	space.prefix += domainPrefix(name)
+	return space
+}
+
+// domainPrefix returns a prefix of keys of a short domain
+func domainPrefix(name string) string {
+	if name == domain.Default {
+		return ""
+	}
+	return fmt.Sprintf(domainPrefixPattern, name)
+}
+
+// reservationKey returns a key of a tenant which a short code of a domain is reserved for
+func reservationKey(name string, shortCode string) string {
+	return domainPrefix(name) + fmt.Sprintf(codeTenantKeyPattern, shortCode)
+}
+
+// reservation returns a key of a tenant which a short code is reserved for
+func (k keySpace) reservation(shortCode string) string {
+	return reservationKey(k.domain, shortCode)
+}
+
+// object returns a key of an url object
+func (k keySpace) object(shortCode string) string {
+	return k.prefix + fmt.Sprintf(keyPattern, shortCode)
+}
+
+// hits returns a key of a hit counter
+func (k keySpace) hits(shortCode string) string {
+	return k.prefix + fmt.Sprintf(hitsKeyPattern, shortCode)
+}
+
+// index returns a key of a hash indexing short codes to their full urls
+func (k keySpace) index() string {
+	return k.prefix + urlIndexKey
+}
+
+// reverseIndex returns a key of a hash indexing normalized full urls to their latest short codes
+func (k keySpace) reverseIndex() string {
+	return k.prefix + reverseIndexKey
+}
+
+// tag returns a key of a set of short codes with a tag
+func (k keySpace) tag(name string) string {
+	return k.prefix + fmt.Sprintf(tagKeyPattern, name)
+}
+
+// tags returns a key of a set of used tags
+func (k keySpace) tags() string {
+	return k.prefix + tagsKey
+}
+
+// tombstone returns a key of a deleted url object
+func (k keySpace) tombstone(shortCode string) string {
+	return k.prefix + fmt.Sprintf(tombstoneKeyPattern, shortCode)
+}
+
+// deleted returns a key of a set of deleted short codes
+func (k keySpace) deleted() string {
+	return k.prefix + deletedShortUrlKey
+}
+
+// encodeSpace returns a key space where new short codes are saved, it is a domain of a context
+// in the default tenant unless a context is scoped to a tenant
+func (s *service) encodeSpace(ctx context.Context) keySpace {
+	id, _ := tenant.FromContext(ctx)
+	return newKeySpace(id, domain.FromContext(ctx))
+}
+
+// spaceOf returns a key space of a short code in a domain of a context.
+// A tenant of a context is used if it's scoped to a tenant, so that a short code of another tenant isn't found.
+// Otherwise, e.g. for public routes, a tenant is found by a short code.
+func (s *service) spaceOf(ctx context.Context, shortCode string) (keySpace, error) {
+	name := domain.FromContext(ctx)
+	if id, ok := tenant.FromContext(ctx); ok {
+		return newKeySpace(id, name), nil
+	}
+	return s.reservedSpace(ctx, name, shortCode)
+}
+
+// reservedSpace returns a key space of a tenant which a short code of a domain is reserved for regardless of a context
+func (s *service) reservedSpace(ctx context.Context, name string, shortCode string) (keySpace, error) {
+	var id string
+	err := s.repository.Get(ctx, reservationKey(name, shortCode), &id)
+	if err == repository.ErrNotFound {
+		// a short code is saved before tenants were introduced or it doesn't exist
+		return newKeySpace(tenant.Default, name), nil
+	}
+	if err != nil {
+		return keySpace{}, customError.Unavailable("failed to get tenant of short code", err)
+	}
+	return newKeySpace(id, name), nil
+}
+
+// listSpaces returns key spaces listed for a context in a domain, or all domains if `name` is nil.
+// All configured tenants are listed unless a context is scoped to a tenant.
+func (s *service) listSpaces(ctx context.Context, name *string) []keySpace {
+	ids := []string{tenant.Default}
+	if id, ok := tenant.FromContext(ctx); ok {
+		ids = []string{id}
+	} else {
+		for id := range s.config.Tenants {
+			if id != tenant.Default {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids[1:])
+	}
+
+	names := s.domains()
+	if name != nil {
+		names = []string{*name}
+	}
+
+	spaces := make([]keySpace, 0, len(ids)*len(names))
+	for _, id := range ids {
+		for _, n := range names {
+			spaces = append(spaces, newKeySpace(id, n))
+		}
+	}
+	return spaces
+}
+
+// domains returns the default domain followed by configured short domains
+func (s *service) domains() []string {
+	return append([]string{domain.Default}, s.config.Domains...)
+}
+
+// checkQuota returns an error if a tenant has as many short codes in all domains as its quota
+func (s *service) checkQuota(ctx context.Context, space keySpace) error {
+	quota := s.config.Tenants.Get(space.tenant).Quota
+	if quota <= 0 {
+		return nil
+	}
+
+	n, err := s.countShortCodes(ctx, space.tenant)
+	if err != nil {
+		return err
+	}
+	if n >= int64(quota) {
+		return errQuotaExceeded(quota)
+	}
+	return nil
+}
+
+// recheckQuota returns an error if a tenant has more short codes in all domains than its quota.
+// It's checked after a short code is claimed and indexed in sort indexes, since concurrent claims all pass
+// checkQuota, so a short code counted over a quota is released by its caller.
+func (s *service) recheckQuota(ctx context.Context, space keySpace) error {
+	quota := s.config.Tenants.Get(space.tenant).Quota
+	if quota <= 0 {
+		return nil
+	}
+
+	n, err := s.countShortCodes(ctx, space.tenant)
+	if err != nil {
+		return err
+	}
+	if n > int64(quota) {
+		return errQuotaExceeded(quota)
+	}
+	return nil
+}
+
+// countShortCodes returns the number of short codes of a tenant in all domains which aren't expired.
+// Short codes are counted in sort indexes, so a short code is counted once it's claimed and indexed
+// and it isn't counted after it expires even if it isn't removed from indexes yet.
+func (s *service) countShortCodes(ctx context.Context, id string) (int64, error) {
+	spaces := make([]keySpace, 0, len(s.config.Domains)+1)
+	for _, name := range s.domains() {
+		space := newKeySpace(id, name)
+		if err := s.buildSortIndexes(ctx, space); err != nil {
+			return 0, err
+		}
+		spaces = append(spaces, space)
+	}
+	n, err := s.countListed(ctx, spaces, time.Now())
+	return int64(n), err
+}
+
+// errQuotaExceeded returns an error of an exceeded quota
+func errQuotaExceeded(quota int) error {
+	return customError.QuotaExceeded(fmt.Sprintf("quota of %d short codes is exceeded", quota))
+}
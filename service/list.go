@@ -0,0 +1,517 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"url-shortener/customError"
+	"url-shortener/model"
+)
+
+// DefaultPageSize is the number of url objects listed in a page if a limit isn't specified
+const DefaultPageSize = 50
+
+// MaxPageSize is the maximum number of url objects listed in a page
+const MaxPageSize = 500
+
+// loadBatchSize is the number of url objects loaded by a MGet
+const loadBatchSize = 500
+
+// maxPatternLength is the maximum length of a regex filter
+const maxPatternLength = 256
+
+// maxCountedTotal is the maximum number of short codes scanned to count a total of a filtered listing,
+// a total is approximate if there're more
+const maxCountedTotal = 5000
+
+// listEntry is a listed short code in a key space, its url object is loaded lazily
+type listEntry struct {
+	space     keySpace
+	shortCode string
+	fullUrl   string
+	object    *model.UrlObject
+	// tag is a tag of an index an entry is listed from, its full url is unknown until it's loaded
+	tag string
+	// sortName and member are an order and a member of a sort index an entry is listed from
+	sortName string
+	member   string
+}
+
+// listKey is a position of an entry in a listing, entries are sorted by a value and then by a short code
+type listKey struct {
+	Sort      string `json:"s"`
+	Value     int64  `json:"v,omitempty"`
+	ShortCode string `json:"c"`
+	Tenant    string `json:"t,omitempty"`
+	Domain    string `json:"d,omitempty"`
+}
+
+// filter matches listed url objects of a query, short codes are matched before url objects are loaded
+// and other filters are matched in loaded url objects
+type filter struct {
+	query     model.UrlQuery
+	shortCode func(string) bool
+	fullUrl   func(string) bool
+}
+
+// GetUrlObjects finds a page of url objects matching a query.
+// Url objects of a tenant of a context are found, or of all tenants if a context isn't scoped to a tenant.
+// Short codes are listed from sort indexes of key spaces in an order of a query, so only url objects
+// around a page are loaded unless most of them don't match filters. Url objects with a tag are listed
+// from an index of the tag and sorted in memory instead. A total of a filtered listing is counted by
+// scanning at most maxCountedTotal short codes.
+func (s *service) GetUrlObjects(ctx context.Context, query model.UrlQuery) ([]*model.UrlObject, *model.Page, error) {
+	if query.Sort == "" {
+		query.Sort = model.SortShortCode
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageSize
+	}
+	if query.Limit > MaxPageSize {
+		query.Limit = MaxPageSize
+	}
+
+	entries, total, err := s.listEntries(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &model.Page{Total: total, Limit: query.Limit}
+	if total == nil {
+		n, approximate, err := s.countMatched(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.Total, page.TotalApproximate = &n, approximate
+	}
+	if len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+		page.NextCursor = encodeCursor(entries[len(entries)-1].key(listOrder(query)))
+	}
+	urlObjects := make([]*model.UrlObject, len(entries))
+	for i, entry := range entries {
+		urlObjects[i] = entry.object
+	}
+
+	return urlObjects, page, nil
+}
+
+// listEntries returns loaded entries matching a query after its cursor, one more than its limit if there're more
+func (s *service) listEntries(ctx context.Context, query model.UrlQuery) ([]*listEntry, *int, error) {
+	order := listOrder(query)
+	f, err := newFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var after *listKey
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil || cursor.Sort != order {
+			return nil, nil, customError.Validation(customError.CodeInvalidCursor, "cursor is invalid or of another order")
+		}
+		after = cursor
+	}
+
+	if query.Tag != nil {
+		return s.listTagged(ctx, f, order, after)
+	}
+	return s.listSorted(ctx, f, order, after)
+}
+
+// countMatched counts short codes matching a filtered query in all its key spaces.
+// Short codes are scanned in the short code order and loaded in batches, at most maxCountedTotal of them
+// are scanned, so a total is approximate and only counts the scanned ones if there're more.
+func (s *service) countMatched(ctx context.Context, query model.UrlQuery) (int, bool, error) {
+	f, err := newFilter(query)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var n, scanned int
+	approximate := false
+	for _, space := range s.listSpaces(ctx, query.Domain) {
+		scan := newSortScan(space, model.SortShortCode, false, nil)
+		done := false
+		for !done {
+			var batch []*listEntry
+			for i := 0; i < loadBatchSize; i++ {
+				entry, err := scan.next(ctx, s.repository, loadBatchSize)
+				if err != nil {
+					return 0, false, err
+				}
+				if entry == nil {
+					done = true
+					break
+				}
+				if scanned == maxCountedTotal {
+					approximate, done = true, true
+					break
+				}
+				scan.pop()
+				scanned++
+				if f.shortCode == nil || f.shortCode(entry.shortCode) {
+					batch = append(batch, entry)
+				}
+			}
+
+			loaded, err := s.loadEntries(ctx, batch, f)
+			if err != nil {
+				return 0, false, err
+			}
+			n += len(loaded)
+		}
+		if approximate {
+			break
+		}
+	}
+	return n, approximate, nil
+}
+
+// listOrder returns an order of a query which a cursor is bound to
+func listOrder(query model.UrlQuery) string {
+	if query.Desc {
+		return query.Sort + ":desc"
+	}
+	return query.Sort
+}
+
+// listSorted returns loaded entries matching a filter after a position, one more than a limit if there're more.
+// Sort indexes of all key spaces are merged in an order, and short codes are loaded in batches until a page is full.
+// A total is only counted from sort indexes without filters, a caller counts a filtered total.
+func (s *service) listSorted(ctx context.Context, f *filter, order string, after *listKey) ([]*listEntry, *int, error) {
+	q := f.query
+	sortName := q.Sort
+	limit := q.Limit + 1
+	now := time.Now()
+
+	if sortName == model.SortHits {
+		if err := s.writeHitsMoves(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	spaces := s.listSpaces(ctx, q.Domain)
+	scans := make([]*sortScan, len(spaces))
+	for i, space := range spaces {
+		if err := s.buildSortIndexes(ctx, space); err != nil {
+			return nil, nil, err
+		}
+		if err := s.sweepExpired(ctx, space, now); err != nil {
+			return nil, nil, err
+		}
+		scans[i] = newSortScan(space, sortName, q.Desc, after)
+	}
+
+	var total *int
+	if q.ShortCode == nil && q.FullURL == nil && !f.needsObjects() {
+		n, err := s.countListed(ctx, spaces, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		total = &n
+	}
+
+	var listed []*listEntry
+	for len(listed) < limit {
+		// take the first entries of all key spaces in an order
+		var batch []*listEntry
+		for len(batch) < limit {
+			var first *sortScan
+			var firstEntry *listEntry
+			for _, scan := range scans {
+				entry, err := scan.next(ctx, s.repository, limit)
+				if err != nil {
+					return nil, nil, err
+				}
+				if entry != nil && (firstEntry == nil || f.less(entry.position(order), firstEntry.position(order))) {
+					first, firstEntry = scan, entry
+				}
+			}
+			if first == nil {
+				break
+			}
+			first.pop()
+			if f.shortCode == nil || f.shortCode(firstEntry.shortCode) {
+				batch = append(batch, firstEntry)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		loaded, err := s.loadEntries(ctx, batch, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		listed = append(listed, loaded...)
+	}
+	if len(listed) > limit {
+		listed = listed[:limit]
+	}
+
+	return listed, total, nil
+}
+
+// listTagged returns loaded entries with a tag matching a filter after a position, one more than a limit if there're more.
+// All url objects with a tag are loaded and sorted in memory, so a total is always counted.
+func (s *service) listTagged(ctx context.Context, f *filter, order string, after *listKey) ([]*listEntry, *int, error) {
+	var entries []*listEntry
+	for _, space := range s.listSpaces(ctx, f.query.Domain) {
+		tagged, err := s.tagEntries(ctx, space, *f.query.Tag, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, tagged...)
+	}
+	entries, err := s.loadEntries(ctx, entries, f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return f.less(entries[i].key(order), entries[j].key(order))
+	})
+	total := len(entries)
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(entries), func(i int) bool {
+			return f.less(*after, entries[i].key(order))
+		})
+	}
+	end := start + f.query.Limit + 1
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	return entries[start:end], &total, nil
+}
+
+// loadEntries loads url objects and their hits of entries in batches.
+// Entries of expired url objects are removed from indexes and entries not matching a filter are left out,
+// a nil filter keeps all entries. An entry listed from a stale member of a sort index is left out and
+// the member is moved to its current value, so the url object is listed from it by a later batch or listing.
+func (s *service) loadEntries(ctx context.Context, entries []*listEntry, f *filter) ([]*listEntry, error) {
+	loaded := make([]*listEntry, 0, len(entries))
+	for start := 0; start < len(entries); start += loadBatchSize {
+		end := start + loadBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		batch := entries[start:end]
+
+		// get url objects and their hit counts at once
+		keys := make([]interface{}, len(batch))
+		hitsKeys := make([]interface{}, len(batch))
+		for i, entry := range batch {
+			keys[i] = entry.space.object(entry.shortCode)
+			hitsKeys[i] = entry.space.hits(entry.shortCode)
+		}
+		objects := make([]*model.UrlObject, len(keys))
+		err := s.repository.MGet(ctx, keys, &objects)
+		if err != nil {
+			return nil, customError.Unavailable("failed to get url", err)
+		}
+		hits := make([]uint64, len(hitsKeys))
+		err = s.repository.MGet(ctx, hitsKeys, &hits)
+		if err != nil {
+			return nil, customError.Unavailable("failed to get hits", err)
+		}
+
+		for i, object := range objects {
+			entry := batch[i]
+			if object == nil {
+				// an url object is expired, remove it from an index it's listed from
+				switch {
+				case entry.tag != "":
+					err = s.removeTags(ctx, entry.space, entry.shortCode, []string{entry.tag})
+				case entry.member != "":
+					err = s.removeListed(ctx, entry)
+				default:
+					err = s.removeIndex(ctx, entry.space, entry.shortCode, entry.fullUrl)
+				}
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			// hits saved in an url object are counted before hits were moved to a counter
+			object.Hits += hits[i]
+			object.ShortCode = entry.shortCode
+			entry.object = object
+			if entry.stale() {
+				// a member is moved to a current value, e.g. hits counted by another instance
+				from, _, _ := parseSortMember(entry.sortName, entry.member)
+				err = s.moveSorted(ctx, entry.space, entry.sortName, entry.shortCode, from, sortValue(entry.sortName, object))
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if entry.tag != "" && !hasTag(object.Tags, entry.tag) {
+				// a short code reclaimed after it expired is left in an index of a tag of its previous url object
+				if err = s.removeTags(ctx, entry.space, entry.shortCode, []string{entry.tag}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if f != nil && !f.matchObject(object) {
+				continue
+			}
+			loaded = append(loaded, entry)
+		}
+	}
+	return loaded, nil
+}
+
+// newFilter validates string filters of a query and compiles their matchers
+func newFilter(query model.UrlQuery) (*filter, error) {
+	shortCode, err := matcher("shortCode", query.ShortCode, query.ShortCodeMatch)
+	if err != nil {
+		return nil, err
+	}
+	fullUrl, err := matcher("fullUrl", query.FullURL, query.FullURLMatch)
+	if err != nil {
+		return nil, err
+	}
+	return &filter{query: query, shortCode: shortCode, fullUrl: fullUrl}, nil
+}
+
+// matcher returns a function matching strings by a value and a mode, it is nil if a value isn't specified.
+// Values are only compared as strings, so glob and regex characters are literal unless a mode is regex.
+func matcher(name string, value *string, mode string) (func(string) bool, error) {
+	if value == nil {
+		return nil, nil
+	}
+	v := *value
+	switch mode {
+	case "", model.MatchContains:
+		return func(s string) bool { return strings.Contains(s, v) }, nil
+	case model.MatchExact:
+		return func(s string) bool { return s == v }, nil
+	case model.MatchPrefix:
+		return func(s string) bool { return strings.HasPrefix(s, v) }, nil
+	case model.MatchRegex:
+		if len(v) > maxPatternLength {
+			return nil, customError.Validation(
+				customError.CodeInvalidQuery,
+				fmt.Sprintf("%s pattern is longer than %d characters", name, maxPatternLength),
+			)
+		}
+		pattern, err := regexp.Compile(v)
+		if err != nil {
+			return nil, customError.Validation(
+				customError.CodeInvalidQuery,
+				fmt.Sprintf("%s pattern is invalid, err: %v", name, err),
+			)
+		}
+		return pattern.MatchString, nil
+	default:
+		return nil, customError.Validation(customError.CodeInvalidQuery, fmt.Sprintf("unknown %s match mode: %s", name, mode))
+	}
+}
+
+// needsObjects reports whether a filter matches fields only saved in url objects
+func (f *filter) needsObjects() bool {
+	q := f.query
+	return q.Owner != nil || q.Tag != nil || q.Folder != nil || q.MinHits != nil || q.MaxHits != nil ||
+		q.ExpiresBefore != nil || q.ExpiresAfter != nil || q.CreatedAfter != nil || q.CreatedBefore != nil
+}
+
+// matchObject reports whether a loaded url object with its hits matches a filter
+func (f *filter) matchObject(object *model.UrlObject) bool {
+	q := f.query
+	if q.Owner != nil && object.Owner != *q.Owner {
+		return false
+	}
+	if q.Tag != nil && !hasTag(object.Tags, *q.Tag) {
+		return false
+	}
+	if f.fullUrl != nil && !f.fullUrl(object.FullURL) {
+		return false
+	}
+	if q.Folder != nil && object.Folder != *q.Folder && !strings.HasPrefix(object.Folder, *q.Folder+"/") {
+		return false
+	}
+	if q.MinHits != nil && object.Hits < *q.MinHits {
+		return false
+	}
+	if q.MaxHits != nil && object.Hits > *q.MaxHits {
+		return false
+	}
+	// url objects without an expiry never expire
+	if q.ExpiresBefore != nil && (object.Expiry == nil || !object.Expiry.Before(*q.ExpiresBefore)) {
+		return false
+	}
+	if q.ExpiresAfter != nil && object.Expiry != nil && !object.Expiry.After(*q.ExpiresAfter) {
+		return false
+	}
+	if q.CreatedAfter != nil && (object.CreatedAt == nil || !object.CreatedAt.After(*q.CreatedAfter)) {
+		return false
+	}
+	if q.CreatedBefore != nil && (object.CreatedAt == nil || !object.CreatedAt.Before(*q.CreatedBefore)) {
+		return false
+	}
+	return true
+}
+
+// key returns a position of a loaded entry in an order
+func (e *listEntry) key(order string) listKey {
+	return listKey{
+		Sort:      order,
+		Value:     sortValue(strings.TrimSuffix(order, ":desc"), e.object),
+		ShortCode: e.shortCode,
+		Tenant:    e.space.tenant,
+		Domain:    e.space.domain,
+	}
+}
+
+// less reports whether a position is before another one in an order of a query
+func (f *filter) less(a listKey, b listKey) bool {
+	if f.query.Desc {
+		return compareKeys(b, a) < 0
+	}
+	return compareKeys(a, b) < 0
+}
+
+// compareKeys returns -1, 0 or 1 if `a` is before, at or after `b` in ascending order
+func compareKeys(a listKey, b listKey) int {
+	switch {
+	case a.Value != b.Value:
+		if a.Value < b.Value {
+			return -1
+		}
+		return 1
+	case a.ShortCode != b.ShortCode:
+		return strings.Compare(a.ShortCode, b.ShortCode)
+	case a.Tenant != b.Tenant:
+		return strings.Compare(a.Tenant, b.Tenant)
+	default:
+		return strings.Compare(a.Domain, b.Domain)
+	}
+}
+
+// encodeCursor returns an opaque cursor of a position
+func encodeCursor(key listKey) string {
+	jsonBytes, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(jsonBytes)
+}
+
+// decodeCursor returns a position of a cursor
+func decodeCursor(cursor string) (*listKey, error) {
+	jsonBytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var key listKey
+	if err = json.Unmarshal(jsonBytes, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
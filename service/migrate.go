@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"url-shortener/domain"
+	"url-shortener/model"
+	"url-shortener/repository"
+	"url-shortener/tenant"
+)
+
+// key of the legacy layout which embeds a full url in the key,
+// it has a pattern `url:{shortCode}#{fullUrl}`.
+const legacyKeyPattern = "url:%s#%s"
+
+// key of a marker set once all legacy keys are migrated, legacy keys aren't looked up after that
+const legacyMigratedKey = "migrated:legacyKeys"
+
+// MigrateLegacyKeys rewrites all keys of the legacy `url:{shortCode}#{fullUrl}` layout
+// into `url:{shortCode}` and indexes their full urls. Keys are renamed one by one
+// so the service keeps working while it runs, and it is safe to run more than once.
+// Once all keys are migrated, a marker is set so that the service stops looking up legacy keys.
+func MigrateLegacyKeys(ctx context.Context, repo repository.Repository) (int, error) {
+	keys, err := repo.Scan(ctx, fmt.Sprintf(legacyKeyPattern, "*", "*"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan legacy keys, err: %v", err)
+	}
+
+	migrated := 0
+	for _, key := range keys {
+		if err = migrateKey(ctx, repo, key); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	if _, err = repo.Set(ctx, legacyMigratedKey, true, nil); err != nil {
+		return migrated, fmt.Errorf("failed to mark legacy keys migrated, err: %v", err)
+	}
+	return migrated, nil
+}
+
+// legacyPending reports whether legacy keys may still exist, it is false once MigrateLegacyKeys is done.
+// The marker is remembered so that a lookup of an unknown short code never scans keys after that.
+func (s *service) legacyPending(ctx context.Context) (bool, error) {
+	if atomic.LoadInt32(&s.legacyMigrated) == 1 {
+		return false, nil
+	}
+	migrated, err := s.repository.Exists(ctx, legacyMigratedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to check legacy keys migrated, err: %v", err)
+	}
+	if migrated {
+		atomic.StoreInt32(&s.legacyMigrated, 1)
+	}
+	return !migrated, nil
+}
+
+// migrateLegacyKey migrates a legacy key of specified short code if it exists
+func migrateLegacyKey(ctx context.Context, repo repository.Repository, shortCode string) (bool, error) {
+	keys, err := repo.Scan(ctx, fmt.Sprintf(legacyKeyPattern, escapeGlob(shortCode), "*"))
+	if err != nil {
+		return false, fmt.Errorf("failed to scan legacy keys, err: %v", err)
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	if len(keys) != 1 {
+		return false, fmt.Errorf("not single key, keys: %v", keys)
+	}
+
+	if err = migrateKey(ctx, repo, keys[0]); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// migrateKey renames a legacy key to the new layout with its expiry and indexes its full url and its orders
+func migrateKey(ctx context.Context, repo repository.Repository, legacyKey string) error {
+	shortCode, fullUrl, ok := parseLegacyKey(legacyKey)
+	if !ok {
+		return fmt.Errorf("failed to parse legacy key: %s", legacyKey)
+	}
+
+	// index first so that a migrated url object is always searchable
+	err := repo.HSet(ctx, urlIndexKey, shortCode, fullUrl)
+	if err != nil {
+		return fmt.Errorf("failed to index url, key: %s, err: %v", legacyKey, err)
+	}
+
+	renamed, err := repo.Rename(ctx, legacyKey, fmt.Sprintf(keyPattern, shortCode))
+	if err != nil {
+		return fmt.Errorf("failed to rename key: %s, err: %v", legacyKey, err)
+	}
+	if !renamed {
+		// a short code is already migrated, the legacy key is stale
+		if _, err = repo.Del(ctx, legacyKey); err != nil {
+			return fmt.Errorf("failed to delete stale key: %s, err: %v", legacyKey, err)
+		}
+		return nil
+	}
+
+	// hits of a legacy url object are saved in it, they are counted in the hits order
+	var object model.UrlObject
+	err = repo.Get(ctx, fmt.Sprintf(keyPattern, shortCode), &object)
+	if err == repository.ErrNotFound {
+		// a migrated url object is expired in the meantime
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get url, key: %s, err: %v", legacyKey, err)
+	}
+	object.ShortCode = shortCode
+	if err = addSortIndexes(ctx, repo, newKeySpace(tenant.Default, domain.Default), &object); err != nil {
+		return fmt.Errorf("failed to index url, key: %s, err: %v", legacyKey, err)
+	}
+
+	return nil
+}
+
+// parseLegacyKey splits a legacy key into a short code and a full url
+func parseLegacyKey(key string) (string, string, bool) {
+	const prefix = "url:"
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, prefix), "#", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// escapeGlob escapes special characters of glob-style pattern
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"url-shortener/model"
+	"url-shortener/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"gotest.tools/assert"
+)
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := repository.NewPool(mr.Addr())
+	ctx := context.Background()
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	legacyObjects := []*model.UrlObject{
+		{ShortCode: "abc", FullURL: "http://www.facebook.com", Hits: 3},
+		{ShortCode: "def", FullURL: "http://www.netflix.com/#home", Expiry: &expiry},
+	}
+	for _, object := range legacyObjects {
+		key := "url:" + object.ShortCode + "#" + object.FullURL
+		if _, err := repo.Set(ctx, key, object, object.Expiry); err != nil {
+			t.Fatalf("failed to set legacy key, err: %v", err)
+		}
+	}
+
+	migrated, err := MigrateLegacyKeys(ctx, repo)
+	if err != nil {
+		t.Fatalf("failed to migrate, err: %v", err)
+	}
+	assert.Equal(t, 2, migrated)
+
+	// running again is a no-op
+	migrated, err = MigrateLegacyKeys(ctx, repo)
+	if err != nil {
+		t.Fatalf("failed to migrate, err: %v", err)
+	}
+	assert.Equal(t, 0, migrated)
+
+	assert.Assert(t, mr.TTL("url:def") > 0)
+	assert.Equal(t, "http://www.netflix.com/#home", mr.HGet("urls", "def"))
+
+	serv := New(repo, Config{})
+	fullUrl, err := serv.Decode(ctx, "abc")
+	if err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 2, len(objects))
+	assert.Equal(t, uint64(4), objects[0].Hits)
+}
+
+func TestDecode_LegacyKeyFallback(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := repository.NewPool(mr.Addr())
+	ctx := context.Background()
+
+	object := &model.UrlObject{ShortCode: "abc", FullURL: "http://www.facebook.com"}
+	if _, err := repo.Set(ctx, "url:abc#http://www.facebook.com", object, nil); err != nil {
+		t.Fatalf("failed to set legacy key, err: %v", err)
+	}
+
+	if _, err := New(repo, Config{}).Decode(ctx, "abc"); err == nil {
+		t.Fatalf("legacy key should not be found without fallback")
+	}
+
+	fullUrl, err := New(repo, Config{LegacyKeyFallback: true}).Decode(ctx, "abc")
+	if err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+	assert.Assert(t, !mr.Exists("url:abc#http://www.facebook.com"))
+
+	// a glob in short code must not match other legacy keys
+	if _, err = New(repo, Config{LegacyKeyFallback: true}).Decode(ctx, "*"); err == nil {
+		t.Fatalf("glob short code should not be found")
+	}
+
+	// legacy keys aren't looked up once all keys are migrated
+	if _, err = MigrateLegacyKeys(ctx, repo); err != nil {
+		t.Fatalf("failed to migrate, err: %v", err)
+	}
+	if _, err := repo.Set(ctx, "url:def#http://www.netflix.com", object, nil); err != nil {
+		t.Fatalf("failed to set legacy key, err: %v", err)
+	}
+	if _, err = New(repo, Config{LegacyKeyFallback: true}).Decode(ctx, "def"); err == nil {
+		t.Fatalf("legacy key should not be looked up after migration")
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// defaultRetentionSweepInterval is used when retention sweep interval isn't specified
+const defaultRetentionSweepInterval = time.Hour
+
+// RetentionSweeper purges deleted url objects whose retention is expired periodically,
+// so that they're purged even if they're never listed, restored or reused
+type RetentionSweeper struct {
+	service Service
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRetentionSweeper is a constructor of RetentionSweeper, deleted url objects of all tenants are swept every `interval`
+func NewRetentionSweeper(serv Service, interval time.Duration) *RetentionSweeper {
+	if interval <= 0 {
+		interval = defaultRetentionSweepInterval
+	}
+
+	r := &RetentionSweeper{
+		service: serv,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.run(interval)
+	return r
+}
+
+// Close stops the sweeper and waits for a running sweep
+func (r *RetentionSweeper) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+// run sweeps periodically until Close is called
+func (r *RetentionSweeper) run(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.sweep(context.Background())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// sweep purges expired deleted url objects, a failure is logged and retried by the next sweep
+func (r *RetentionSweeper) sweep(ctx context.Context) {
+	purged, err := r.service.PurgeExpiredUrls(ctx)
+	if err != nil {
+		log.Printf("failed to purge expired deleted urls, purged: %d, err: %v", purged, err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("purged %d expired deleted urls", purged)
+	}
+}
@@ -2,188 +2,721 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/catinello/base62"
-	"math/rand"
-	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
+	"url-shortener/audit"
 	"url-shortener/customError"
+	"url-shortener/domain"
+	"url-shortener/generator"
 	"url-shortener/model"
 	"url-shortener/repository"
+	"url-shortener/tenant"
 )
 
 const deletedShortUrlKey = "deletedShortUrlKey" // key for saving all deleted short codes
 
+// key for saving a deleted url object until it is purged, it has a pattern `deletedUrl:{shortCode}`
+const tombstoneKeyPattern = "deletedUrl:%s"
+
 // key for saving a struct of urlObject
-// and it has a pattern `url:{shortCode}:{fullUrl}`.
-const keyPattern = "url:%s#%s"
+// and it has a pattern `url:{shortCode}`.
+const keyPattern = "url:%s"
+
+// key for counting hits of a short code, it has a pattern `hits:{shortCode}`.
+// Hits are counted atomically in this key instead of the url object.
+const hitsKeyPattern = "hits:%s"
+
+// key of a hash indexing all short codes to their full urls, it is used for searching
+const urlIndexKey = "urls"
+
+// key of a hash indexing normalized full urls to their latest short codes, it is used for deduplication
+const reverseIndexKey = "urlCodes"
+
+// key of a set of short codes with a tag, it has a pattern `tag:{tag}`
+const tagKeyPattern = "tag:%s"
+
+// key of a set of all tags used in a key space, a tag may have no short codes after they're removed
+const tagsKey = "tags"
+
+// maxGenerateAttempts is the number of generated codes tried before giving up when they collide
+const maxGenerateAttempts = 10
+
+// defaultCodeLength is the length of random codes if no generator is configured
+const defaultCodeLength = 8
 
 // Controller is an interface for service functions
 type Service interface {
-	Encode(ctx context.Context, fullUrl string, expiry *time.Time) (string, error)
+	Encode(ctx context.Context, fullUrl string, options model.EncodeOptions) (*model.UrlObject, error)
+	EncodeBulk(ctx context.Context, requests []model.EncodeRequest) []model.EncodeResult
+	BulkUpdate(ctx context.Context, request model.BulkUpdateRequest) ([]model.BulkUpdateResult, error)
 	Decode(ctx context.Context, shortCode string) (string, error)
-	GetUrlObjects(ctx context.Context, shortCode *string, fullUrl *string) ([]*model.UrlObject, error)
-	DeleteUrl(ctx context.Context, url string) (bool, error)
+	GetUrlObject(ctx context.Context, shortCode string) (*model.UrlObject, error)
+	GetUrlObjects(ctx context.Context, query model.UrlQuery) ([]*model.UrlObject, *model.Page, error)
+	DeleteUrl(ctx context.Context, shortCode string, actor string) (bool, error)
+	GetDeletedUrls(ctx context.Context, owner *string, domain *string) ([]*model.UrlObject, error)
+	GetDeletedUrl(ctx context.Context, shortCode string) (*model.UrlObject, error)
+	RestoreUrl(ctx context.Context, shortCode string) (*model.UrlObject, error)
+	PurgeUrl(ctx context.Context, shortCode string) error
+	PurgeExpiredUrls(ctx context.Context) (int, error)
+	UpdateExpiry(ctx context.Context, shortCode string, expiry *time.Time) (bool, error)
+	Update(ctx context.Context, shortCode string, options model.UpdateOptions) (*model.UrlObject, error)
+	GetTagStats(ctx context.Context, owner *string, domain *string) ([]*model.TagStats, error)
+}
+
+// Config is a configuration of service
+type Config struct {
+	// LegacyKeyFallback looks up a short code saved in the legacy `url:{shortCode}#{fullUrl}` layout
+	// and migrates it when the short code isn't found, until MigrateLegacyKeys is done.
+	// A lookup scans keys, so it should only be enabled while legacy keys are being migrated.
+	LegacyKeyFallback bool
+
+	// Dedupe returns an existing short code of the same full url instead of a new one,
+	// it can be overridden by EncodeOptions.Dedupe
+	Dedupe bool
+
+	// Generator generates new short codes, random codes of defaultCodeLength characters are used if nil
+	Generator generator.Generator
+
+	// Tenants are configured tenants with their quotas, only the default tenant exists if nil
+	Tenants tenant.Registry
+
+	// Domains are short domains other than the default one, each of them has its own short codes
+	Domains domain.List
+
+	// DeletedRetention is how long a deleted short code can be restored, it is purged and can be reused after that.
+	// Deleted short codes are kept forever if it is 0.
+	DeletedRetention time.Duration
+
+	// Audit records changes of short codes made in bulk, they aren't recorded if it is nil
+	Audit audit.Recorder
 }
 
 // service is a service management
 type service struct {
 	repository repository.Repository
+	config     Config
+
+	// legacyMigrated is 1 once legacy keys are known to be migrated
+	legacyMigrated int32
+	// sortIndexed keeps prefixes of key spaces whose sort indexes are known to be built
+	sortIndexed sync.Map
+
+	// hitsMoves are moves of short codes in the hits order which aren't written yet
+	movesMu   sync.Mutex
+	hitsMoves map[string]*hitsMove
 }
 
 // New is a constructor of service
-func New(repo repository.Repository) Service {
-	service := &service{
+func New(repo repository.Repository, config Config) Service {
+	return newService(repo, config)
+}
+
+// newService initiates a service with defaults of unset configuration
+func newService(repo repository.Repository, config Config) *service {
+	if config.Generator == nil {
+		config.Generator, _ = generator.NewRandom(defaultCodeLength)
+	}
+	return &service{
 		repository: repo,
+		config:     config,
+		hitsMoves:  make(map[string]*hitsMove),
 	}
-	return service
 }
 
-// Encode randoms new short code and sets timeout if specified
-func (s *service) Encode(ctx context.Context, fullUrl string, expiry *time.Time) (string, error) {
-	object := &model.UrlObject{
-		FullURL: fullUrl,
-		Hits:    0,
+// Encode generates new short code, or uses an alias if specified, and sets timeout if specified.
+// It returns a saved url object. In dedupe mode, an existing url object of the same full url and expiry is returned instead.
+// A short code is saved in a tenant of a context, or the default tenant if a context isn't scoped to a tenant,
+// and in a short domain of a context.
+func (s *service) Encode(ctx context.Context, fullUrl string, options model.EncodeOptions) (*model.UrlObject, error) {
+	space := s.encodeSpace(ctx)
+	object, err := newObject(space, fullUrl, options)
+	if err != nil {
+		return nil, err
 	}
 
-	shortCode := s.generateShortUrl(ctx)
-	object.ShortCode = shortCode
+	if s.dedupes(options) {
+		duplicate, err := s.findDuplicate(ctx, space, fullUrl, object.Expiry, object.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate != nil {
+			return duplicate, nil
+		}
+	}
+
+	// a duplicate is returned even if a quota is exceeded since nothing is created
+	err = s.checkQuota(ctx, space)
+	if err != nil {
+		return nil, err
+	}
 
-	if expiry != nil {
-		object.Expiry = expiry
+	var shortCode string
+	if options.Alias != nil {
+		shortCode, err = s.claimAlias(ctx, space, *options.Alias, object)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		shortCode, err = s.claimGenerated(ctx, space, object)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	shortCodeKey := fmt.Sprintf(keyPattern, shortCode, fullUrl)
-	_, err := s.repository.Set(ctx, shortCodeKey, object, object.Expiry)
+	// a short code is counted in a quota once it's in sort indexes, it's released if concurrent claims exceed a quota
+	if err = s.indexSorted(ctx, space, object); err != nil {
+		return nil, err
+	}
+	if err = s.recheckQuota(ctx, space); err != nil {
+		if releaseErr := s.release(ctx, space, object); releaseErr != nil {
+			return nil, releaseErr
+		}
+		return nil, err
+	}
+
+	// index a full url for searching
+	err = s.repository.HSet(ctx, space.index(), shortCode, fullUrl)
 	if err != nil {
-		return "", fmt.Errorf("failed to set object, err: %v", err)
+		return nil, customError.Unavailable("failed to index object", err)
+	}
+
+	// the latest short code of a full url is reused in dedupe mode
+	err = s.repository.HSet(ctx, space.reverseIndex(), NormalizeUrl(fullUrl), shortCode)
+	if err != nil {
+		return nil, customError.Unavailable("failed to index object", err)
+	}
+
+	if err = s.indexTags(ctx, space, shortCode, object.Tags); err != nil {
+		return nil, err
 	}
 
-	return shortCode, nil
+	return object, nil
 }
 
 // Decode finds a full url for specified short code
 func (s *service) Decode(ctx context.Context, shortCode string) (string, error) {
-	// check whether a short code has been deleted
-	deleted, err := s.repository.SIsMember(ctx, deletedShortUrlKey, shortCode)
+	space, err := s.spaceOf(ctx, shortCode)
 	if err != nil {
 		return "", err
 	}
-	if deleted {
-		return "", &customError.InternalError{
-			Code:           0,
-			Message:        "this short code is already deleted",
-			HTTPStatusCode: http.StatusGone,
+	_, object, err := s.find(ctx, space, shortCode)
+	if err != nil {
+		return "", err
+	}
+
+	// update hit count
+	err = s.addHits(ctx, space, object, 1)
+	if err != nil {
+		return "", err
+	}
+	return object.FullURL, nil
+}
+
+// GetUrlObject finds an url object of specified short code without counting a hit
+func (s *service) GetUrlObject(ctx context.Context, shortCode string) (*model.UrlObject, error) {
+	space, err := s.spaceOf(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	_, object, err := s.find(ctx, space, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]uint64, 1)
+	err = s.repository.MGet(ctx, []interface{}{space.hits(shortCode)}, &hits)
+	if err != nil {
+		return nil, customError.Unavailable("failed to get hits", err)
+	}
+	object.Hits += hits[0]
+
+	return object, nil
+}
+
+// DeleteUrl removes a shortCode by `actor`.
+// A deleted url object is kept with its hits until it is purged so that it can be restored.
+func (s *service) DeleteUrl(ctx context.Context, shortCode string, actor string) (bool, error) {
+	space, err := s.spaceOf(ctx, shortCode)
+	if err != nil {
+		return false, err
+	}
+	shortCodeKey, object, err := s.find(ctx, space, shortCode)
+	if err != nil {
+		return false, err
+	}
+
+	// keep a deleted url object with its hit count before it is removed so that it is never lost
+	hits := make([]uint64, 1)
+	err = s.repository.MGet(ctx, []interface{}{space.hits(shortCode)}, &hits)
+	if err != nil {
+		return false, customError.Unavailable("failed to get hits", err)
+	}
+	deletedAt := time.Now()
+	object.Hits += hits[0]
+	object.DeletedAt = &deletedAt
+	object.DeletedBy = actor
+	_, err = s.repository.Set(ctx, space.tombstone(shortCode), object, nil)
+	if err != nil {
+		return false, customError.Unavailable("failed to keep deleted url", err)
+	}
+
+	// delete a short code from database
+	isDeleted, err := s.repository.Del(ctx, shortCodeKey)
+	if err != nil {
+		return false, customError.Unavailable("failed to delete url", err)
+	}
+	if !isDeleted {
+		// a short code is expired in the meantime
+		if _, err = s.repository.Del(ctx, space.tombstone(shortCode)); err != nil {
+			return false, customError.Unavailable("failed to delete url", err)
 		}
+		return false, errNotFound()
 	}
 
-	shortCodeKey := fmt.Sprintf(keyPattern, shortCode, "*")
+	// remove its hit count
+	_, err = s.repository.Del(ctx, space.hits(shortCode))
+	if err != nil {
+		return false, customError.Unavailable("failed to delete hits", err)
+	}
 
-	// search short code
-	keys, err := s.repository.Keys(ctx, shortCodeKey)
+	// remove a short code from index
+	err = s.removeIndex(ctx, space, shortCode, object.FullURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to get url, err: %v", err)
+		return false, err
+	}
+	if err = s.removeTags(ctx, space, shortCode, object.Tags); err != nil {
+		return false, err
+	}
+	if err = s.removeSorted(ctx, space, object); err != nil {
+		return false, err
 	}
 
-	if len(keys) != 1 {
-		return "", fmt.Errorf("failed to get url, err: not single key, keys: %v", keys)
+	// add a deleted short code to deletedShortUrlKey set
+	_, err = s.repository.SAdd(ctx, space.deleted(), shortCode)
+	if err != nil {
+		return false, customError.Unavailable("failed to set object", err)
 	}
 
-	// find url object and update hit count
-	var object model.UrlObject
-	err = s.repository.Get(ctx, keys[0], &object)
+	// a deleted short code is kept reserved so that no tenant reuses it
+	_, err = s.repository.ExpireAt(ctx, space.reservation(shortCode), nil)
+	if err != nil {
+		return false, customError.Unavailable("failed to keep short code reserved", err)
+	}
+	return isDeleted, err
+}
+
+// UpdateExpiry changes an expiry of specified short code and its hit count.
+// A nil expiry makes it never expire and an expiry in the past expires it immediately.
+func (s *service) UpdateExpiry(ctx context.Context, shortCode string, expiry *time.Time) (bool, error) {
+	if expiry == nil {
+		expiry = &time.Time{}
+	}
+	_, err := s.Update(ctx, shortCode, model.UpdateOptions{Expiry: expiry})
 	if err != nil {
-		return "", fmt.Errorf("failed to get url, err: %v", err)
+		return false, err
 	}
+	return true, nil
+}
 
-	object.Hits += 1
+// Update changes a full url and an expiry of specified short code, its hit count is kept.
+// An url object is replaced at once so that it is never seen half updated.
+func (s *service) Update(ctx context.Context, shortCode string, options model.UpdateOptions) (*model.UrlObject, error) {
+	space, err := s.spaceOf(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	shortCodeKey, object, err := s.find(ctx, space, shortCode)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err = s.repository.Set(ctx, keys[0], object, object.Expiry)
+	previousUrl := object.FullURL
+	previousExpiry := sortValue(model.SortExpiry, object)
+	if options.FullURL != nil {
+		object.FullURL = *options.FullURL
+	}
+	if options.Expiry != nil {
+		object.Expiry = options.Expiry
+		if options.Expiry.IsZero() {
+			object.Expiry = nil
+		}
+	}
+	if options.Folder != nil {
+		object.Folder = *options.Folder
+	}
+	if len(options.AddTags) > 0 || len(options.RemoveTags) > 0 {
+		if object.Tags, err = mergeTags(object.Tags, options.AddTags, options.RemoveTags); err != nil {
+			return nil, err
+		}
+	}
+
+	// update an url object first so that its expiry is always the one saved in it
+	updated, err := s.repository.Update(ctx, shortCodeKey, object)
 	if err != nil {
-		return "", fmt.Errorf("failed to set object, err: %v", err)
+		return nil, customError.Unavailable("failed to update object", err)
 	}
-	return object.FullURL, nil
+	if !updated {
+		return nil, errNotFound()
+	}
+
+	if options.Expiry != nil {
+		_, err = s.repository.ExpireAt(ctx, shortCodeKey, object.Expiry)
+		if err != nil {
+			return nil, customError.Unavailable("failed to update expiry", err)
+		}
+		_, err = s.repository.ExpireAt(ctx, space.hits(shortCode), object.Expiry)
+		if err != nil {
+			return nil, customError.Unavailable("failed to update expiry of hits", err)
+		}
+		_, err = s.repository.ExpireAt(ctx, space.reservation(shortCode), object.Expiry)
+		if err != nil {
+			return nil, customError.Unavailable("failed to update expiry of short code reservation", err)
+		}
+		err = s.moveSorted(ctx, space, model.SortExpiry, shortCode, previousExpiry, sortValue(model.SortExpiry, object))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if object.FullURL != previousUrl {
+		// index a new full url for searching and dedupe instead of the previous one
+		if err = s.removeIndex(ctx, space, shortCode, previousUrl); err != nil {
+			return nil, err
+		}
+		err = s.repository.HSet(ctx, space.index(), shortCode, object.FullURL)
+		if err != nil {
+			return nil, customError.Unavailable("failed to index object", err)
+		}
+		err = s.repository.HSet(ctx, space.reverseIndex(), NormalizeUrl(object.FullURL), shortCode)
+		if err != nil {
+			return nil, customError.Unavailable("failed to index object", err)
+		}
+	}
+
+	if len(options.AddTags) > 0 || len(options.RemoveTags) > 0 {
+		if err = s.indexTags(ctx, space, shortCode, object.Tags); err != nil {
+			return nil, err
+		}
+		if err = s.removeTags(ctx, space, shortCode, options.RemoveTags); err != nil {
+			return nil, err
+		}
+	}
+
+	hits := make([]uint64, 1)
+	err = s.repository.MGet(ctx, []interface{}{space.hits(shortCode)}, &hits)
+	if err != nil {
+		return nil, customError.Unavailable("failed to get hits", err)
+	}
+	object.Hits += hits[0]
+
+	return object, nil
+}
+
+// newObject returns a new url object of `fullUrl` in a key space
+func newObject(space keySpace, fullUrl string, options model.EncodeOptions) (*model.UrlObject, error) {
+	createdAt := time.Now()
+	object := &model.UrlObject{
+		FullURL:   fullUrl,
+		Hits:      0,
+		CreatedAt: &createdAt,
+		Owner:     options.Owner,
+		Tenant:    space.tenant,
+		Domain:    space.domain,
+		Folder:    options.Folder,
+	}
+	tags, err := mergeTags(nil, options.Tags, nil)
+	if err != nil {
+		return nil, err
+	}
+	object.Tags = tags
+
+	// a zero expiry means no expiry
+	if options.Expiry != nil && !options.Expiry.IsZero() {
+		object.Expiry = options.Expiry
+	}
+	return object, nil
+}
+
+// dedupes reports whether a duplicate url object is reused instead of creating a new one, an alias is never reused
+func (s *service) dedupes(options model.EncodeOptions) bool {
+	dedupe := s.config.Dedupe
+	if options.Dedupe != nil {
+		dedupe = *options.Dedupe
+	}
+	return dedupe && options.Alias == nil
+}
+
+// release removes a claimed url object which is only indexed in sort indexes and its reservation
+func (s *service) release(ctx context.Context, space keySpace, object *model.UrlObject) error {
+	if err := s.unclaim(ctx, space, object); err != nil {
+		return err
+	}
+	if _, err := s.repository.Del(ctx, space.reservation(object.ShortCode)); err != nil {
+		return customError.Unavailable("failed to release short code", err)
+	}
+	return nil
+}
+
+// unclaim removes a saved url object which is only indexed in sort indexes
+func (s *service) unclaim(ctx context.Context, space keySpace, object *model.UrlObject) error {
+	if err := s.removeSorted(ctx, space, object); err != nil {
+		return err
+	}
+	if _, err := s.repository.Del(ctx, space.object(object.ShortCode)); err != nil {
+		return customError.Unavailable("failed to release short code", err)
+	}
+	return nil
 }
 
-// GetUrlObjects finds all url objects with filtered short code and full url
-func (s *service) GetUrlObjects(ctx context.Context, shortCode *string, fullUrl *string) ([]*model.UrlObject, error) {
-	var shortCodeKeys []string
-	var err error
+// claimAlias saves an url object at an alias unless the alias is taken or was deleted
+func (s *service) claimAlias(ctx context.Context, space keySpace, alias string, object *model.UrlObject) (string, error) {
+	aliasTaken := customError.Conflict(customError.CodeAliasTaken, "this alias is already taken")
 
-	// filter short code
-	shortCodePattern := fmt.Sprintf(keyPattern, "*", "*")
-	if shortCode != nil && fullUrl != nil {
-		shortCodePattern = fmt.Sprintf(keyPattern, "*"+*shortCode+"*", "*"+*fullUrl+"*")
-	} else if shortCode != nil {
-		shortCodePattern = fmt.Sprintf(keyPattern, "*"+*shortCode+"*", "*")
-	} else if fullUrl != nil {
-		shortCodePattern = fmt.Sprintf(keyPattern, "*", "*"+*fullUrl+"*")
+	// a deleted short code isn't reused until it is purged
+	deleted, err := s.isDeleted(ctx, space, alias)
+	if err != nil {
+		return "", err
+	}
+	if deleted {
+		return "", aliasTaken
 	}
 
-	// search all possible shortCodeKeys
-	shortCodeKeys, err = s.repository.Keys(ctx, shortCodePattern)
+	claimed, err := s.claim(ctx, space, alias, object)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get members, err: %v", err)
+		return "", err
+	}
+	if !claimed {
+		return "", aliasTaken
 	}
 
-	// get all url objects
-	var urlObjects []*model.UrlObject
-	for _, shortCodeKey := range shortCodeKeys {
-		var urlObject model.UrlObject
-		err := s.repository.Get(ctx, shortCodeKey, &urlObject)
+	return alias, nil
+}
+
+// claimGenerated saves an url object at a generated short code, another code is generated on collision
+func (s *service) claimGenerated(ctx context.Context, space keySpace, object *model.UrlObject) (string, error) {
+	for i := 0; i < maxGenerateAttempts; i++ {
+		shortCode, err := s.config.Generator.Generate(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get url, err: %v", err)
+			return "", customError.Internal(customError.CodeGenerationFailed, "failed to generate short code", err)
+		}
+
+		// a deleted short code isn't reused until it is purged
+		deleted, err := s.isDeleted(ctx, space, shortCode)
+		if err != nil {
+			return "", err
+		}
+		if deleted {
+			continue
+		}
+
+		claimed, err := s.claim(ctx, space, shortCode, object)
+		if err != nil {
+			return "", err
+		}
+		if claimed {
+			return shortCode, nil
+		}
+	}
+
+	return "", customError.Internal(
+		customError.CodeGenerationFailed,
+		fmt.Sprintf("failed to generate unique short code after %d attempts", maxGenerateAttempts),
+		nil,
+	)
+}
+
+// claim saves an url object at a short code only if the short code isn't used by any tenant in its domain
+func (s *service) claim(ctx context.Context, space keySpace, shortCode string, object *model.UrlObject) (bool, error) {
+	// a short code is reserved for a tenant first so that it is unique across tenants
+	codeTenantKey := space.reservation(shortCode)
+	reserved, err := s.repository.SetNX(ctx, codeTenantKey, space.tenant, object.Expiry)
+	if err != nil {
+		return false, customError.Unavailable("failed to reserve short code", err)
+	}
+	if !reserved {
+		return false, nil
+	}
+
+	object.ShortCode = shortCode
+	set, err := s.claimReserved(ctx, space, shortCode, object)
+	if err != nil || !set {
+		// release a reservation, a short code of the default tenant is found without it
+		if _, delErr := s.repository.Del(ctx, codeTenantKey); delErr != nil && err == nil {
+			err = customError.Unavailable("failed to release short code", delErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// claimReserved saves an url object at a reserved short code
+func (s *service) claimReserved(ctx context.Context, space keySpace, shortCode string, object *model.UrlObject) (bool, error) {
+	if space.tenant != tenant.Default {
+		// short codes of the default tenant saved before tenants were introduced aren't reserved
+		var legacy model.UrlObject
+		err := s.repository.Get(ctx, newKeySpace(tenant.Default, space.domain).object(shortCode), &legacy)
+		if err == nil {
+			return false, nil
+		}
+		if err != repository.ErrNotFound {
+			return false, customError.Unavailable("failed to get url", err)
 		}
-		urlObjects = append(urlObjects, &urlObject)
 	}
 
-	return urlObjects, nil
+	set, err := s.repository.SetNX(ctx, space.object(shortCode), object, object.Expiry)
+	if err != nil {
+		return false, customError.Unavailable("failed to set object", err)
+	}
+	return set, nil
 }
 
-// DeleteUrl removes a shortCode.
-func (s *service) DeleteUrl(ctx context.Context, shortCode string) (bool, error) {
-	shortCodeKey := fmt.Sprintf(keyPattern, shortCode, "*")
+// findDuplicate returns the url object of the latest short code of `fullUrl`
+// if it's neither deleted nor expired and it has the same expiry and owner, otherwise nil is returned
+func (s *service) findDuplicate(ctx context.Context, space keySpace, fullUrl string, expiry *time.Time, owner string) (*model.UrlObject, error) {
+	normalized := NormalizeUrl(fullUrl)
+	shortCode, ok, err := s.repository.HGet(ctx, space.reverseIndex(), normalized)
+	if err != nil {
+		return nil, customError.Unavailable("failed to get index", err)
+	}
+	if !ok {
+		return nil, nil
+	}
 
-	// search key by shortCode
-	keys, err := s.repository.Keys(ctx, shortCodeKey)
+	_, object, err := s.find(ctx, space, shortCode)
+	var cerr *customError.Error
+	if errors.As(err, &cerr) && (cerr.Kind == customError.KindNotFound || cerr.Kind == customError.KindGone) {
+		// a short code is deleted or expired, a new one will be indexed
+		return nil, nil
+	}
 	if err != nil {
-		return false, fmt.Errorf("failed to get key, err: %v", err)
+		return nil, err
 	}
-	if len(keys) != 1 {
-		return false, fmt.Errorf("failed to get key, err: not single key, keys: %v", keys)
+
+	if NormalizeUrl(object.FullURL) != normalized {
+		return nil, nil
+	}
+	if (object.Expiry == nil) != (expiry == nil) || (expiry != nil && !object.Expiry.Equal(*expiry)) {
+		return nil, nil
+	}
+	// a short code of another owner can't be managed by a caller, so it isn't shared
+	if object.Owner != owner {
+		return nil, nil
 	}
 
-	// delete a short code from database
-	isDeleted, err := s.repository.Del(ctx, keys[0])
-	if err != nil || !isDeleted {
-		return false, fmt.Errorf("failed to delete url, err: %v", err)
+	return object, nil
+}
+
+// removeIndex removes a short code of `fullUrl` from indexes
+func (s *service) removeIndex(ctx context.Context, space keySpace, shortCode string, fullUrl string) error {
+	err := s.repository.HDel(ctx, space.index(), shortCode)
+	if err != nil {
+		return customError.Unavailable("failed to remove index", err)
 	}
 
-	// add a deleted short code to deletedShortUrlKey set
-	_, err = s.repository.SAdd(ctx, deletedShortUrlKey, shortCode)
+	// the reverse index may point to a newer short code of the same full url
+	normalized := NormalizeUrl(fullUrl)
+	latest, ok, err := s.repository.HGet(ctx, space.reverseIndex(), normalized)
 	if err != nil {
-		return false, fmt.Errorf("failed to set object, err: %v", err)
+		return customError.Unavailable("failed to get index", err)
 	}
-	return isDeleted, err
+	if ok && latest == shortCode {
+		if err = s.repository.HDel(ctx, space.reverseIndex(), normalized); err != nil {
+			return customError.Unavailable("failed to remove index", err)
+		}
+	}
+
+	return nil
 }
 
-// generateShortUrl is a helper function for generating new short code
-func (s *service) generateShortUrl(ctx context.Context) string {
-	var id int
-	var err error
-	var key string
-	exist := true
-	for exist {
-		id = rand.Int()
-		key = base62.Encode(id)
-		exist, err = s.repository.Exists(ctx, key)
-		if err != nil || exist {
-			continue
+// find returns a key and an url object of specified short code in a key space
+func (s *service) find(ctx context.Context, space keySpace, shortCode string) (string, *model.UrlObject, error) {
+	// check whether a short code has been deleted
+	deleted, err := s.isDeleted(ctx, space, shortCode)
+	if err != nil {
+		return "", nil, err
+	}
+	if deleted {
+		return "", nil, customError.Gone(customError.CodeShortCodeDeleted, "this short code is already deleted")
+	}
+
+	// find url object
+	shortCodeKey := space.object(shortCode)
+	var object model.UrlObject
+	err = s.repository.Get(ctx, shortCodeKey, &object)
+	if err == repository.ErrNotFound && s.config.LegacyKeyFallback && space == newKeySpace(tenant.Default, domain.Default) {
+		// a short code may not be migrated yet, legacy keys only exist in the default tenant and domain
+		var pending, migrated bool
+		pending, err = s.legacyPending(ctx)
+		if err == nil && pending {
+			migrated, err = migrateLegacyKey(ctx, s.repository, shortCode)
 		}
-		exist, err = s.repository.SIsMember(ctx, deletedShortUrlKey, key)
-		if err != nil || exist {
-			continue
+		if err != nil {
+			return "", nil, customError.Unavailable("failed to migrate url", err)
+		}
+		err = repository.ErrNotFound
+		if migrated {
+			err = s.repository.Get(ctx, shortCodeKey, &object)
 		}
 	}
-	return key
+	if err == repository.ErrNotFound {
+		return "", nil, errNotFound()
+	}
+	if err != nil {
+		return "", nil, customError.Unavailable("failed to get url", err)
+	}
+	// url objects saved in the legacy layout have no short code
+	object.ShortCode = shortCode
+
+	return shortCodeKey, &object, nil
+}
+
+// addHits atomically increases hit count of a found url object in a key space by `hits`
+// and moves it in the hits order, hits saved in the url object are added to counted ones
+func (s *service) addHits(ctx context.Context, space keySpace, object *model.UrlObject, hits uint64) error {
+	shortCodeKey := space.object(object.ShortCode)
+	hitsKey := space.hits(object.ShortCode)
+
+	counted, exists, err := s.repository.IncrIfExists(ctx, shortCodeKey, hitsKey, int64(hits))
+	if err != nil {
+		return customError.Unavailable("failed to count hits", err)
+	}
+	if !exists {
+		// a short code is deleted or expired in the meantime
+		return errNotFound()
+	}
+
+	// the hits order is written before short codes are listed by hits instead of on every redirect
+	total := int64(object.Hits) + counted
+	s.recordHitsMove(space, object.ShortCode, total-int64(hits), total)
+	return nil
+}
+
+// NormalizeUrl returns a canonical form of a full url so that equivalent urls are deduplicated.
+// A scheme and a host are lowercased, a default port is removed and an empty path becomes `/`.
+func NormalizeUrl(fullUrl string) string {
+	uri, err := url.Parse(fullUrl)
+	if err != nil || uri.Host == "" {
+		return fullUrl
+	}
+
+	uri.Scheme = strings.ToLower(uri.Scheme)
+	uri.Host = strings.ToLower(uri.Host)
+	if (uri.Scheme == "http" && strings.HasSuffix(uri.Host, ":80")) ||
+		(uri.Scheme == "https" && strings.HasSuffix(uri.Host, ":443")) {
+		uri.Host = uri.Host[:strings.LastIndex(uri.Host, ":")]
+	}
+	if uri.Path == "" {
+		uri.Path = "/"
+	}
+
+	return uri.String()
+}
+
+// errNotFound returns an error of a short code which doesn't exist or is expired
+func errNotFound() error {
+	return customError.NotFound(customError.CodeShortCodeNotFound, "this short code is not found")
 }
@@ -0,0 +1,1726 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/audit"
+	"url-shortener/customError"
+	"url-shortener/domain"
+	"url-shortener/model"
+	"url-shortener/repository"
+	"url-shortener/tenant"
+
+	"github.com/alicebob/miniredis/v2"
+	"gotest.tools/assert"
+)
+
+func TestDecode_ConcurrentHits(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := repository.NewPool(mr.Addr())
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+
+	const workers = 50
+	const redirects = 2000
+
+	var wg sync.WaitGroup
+	errs := make(chan error, redirects)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < redirects/workers; i++ {
+				if _, err := serv.Decode(ctx, shortCode); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &shortCode})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, uint64(redirects), objects[0].Hits)
+}
+
+func TestDecode_DeletedIsNotResurrected(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := repository.NewPool(mr.Addr())
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	if _, err = serv.DeleteUrl(ctx, shortCode, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+
+	// a hit arriving right after deletion must not create any key
+	if err = serv.(*service).addHits(ctx, newKeySpace(tenant.Default, domain.Default), object, 1); err == nil {
+		t.Fatalf("hits should not be counted for a deleted short code")
+	}
+	assert.Assert(t, !mr.Exists("url:"+shortCode))
+	assert.Assert(t, !mr.Exists("hits:"+shortCode))
+}
+
+// failingSortIndex fails writes of sort indexes once `failing` is set
+type failingSortIndex struct {
+	repository.Repository
+	failing bool
+}
+
+func (r *failingSortIndex) ZAdd(ctx context.Context, key string, members ...string) error {
+	if r.failing {
+		return fmt.Errorf("sort index is unavailable")
+	}
+	return r.Repository.ZAdd(ctx, key, members...)
+}
+
+func (r *failingSortIndex) ZRem(ctx context.Context, key string, member string) (bool, error) {
+	if r.failing {
+		return false, fmt.Errorf("sort index is unavailable")
+	}
+	return r.Repository.ZRem(ctx, key, member)
+}
+
+func TestDecode_HitsOrder(t *testing.T) {
+	repo := &failingSortIndex{Repository: repository.NewMemory()}
+	serv := New(repo, Config{})
+	other := New(repo, Config{})
+	ctx := context.Background()
+
+	codes := make([]string, 3)
+	for i := range codes {
+		object, err := serv.Encode(ctx, fmt.Sprintf("http://www.example.com/%d", i), model.EncodeOptions{})
+		if err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+		codes[i] = object.ShortCode
+	}
+	listed := func(s Service) []string {
+		objects, _, err := s.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits, Desc: true})
+		assert.NilError(t, err)
+		listed := make([]string, len(objects))
+		for i, object := range objects {
+			listed[i] = object.ShortCode
+		}
+		return listed
+	}
+	listed(serv)
+
+	// a redirect doesn't write sort indexes, so it never fails because of them
+	repo.failing = true
+	for i := 0; i < 2; i++ {
+		_, err := serv.Decode(ctx, codes[1])
+		assert.NilError(t, err)
+	}
+	_, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits})
+	assert.ErrorContains(t, err, "failed to")
+
+	// hits are moved in the hits order before a listing by hits
+	repo.failing = false
+	assert.Equal(t, codes[1], listed(serv)[0])
+
+	// hits counted by another instance are moved once a short code is listed at a stale position
+	for i := 0; i < 3; i++ {
+		_, err = other.Decode(ctx, codes[2])
+		assert.NilError(t, err)
+	}
+	listed(serv)
+	assert.DeepEqual(t, []string{codes[2], codes[1], codes[0]}, listed(serv))
+}
+
+func TestDecode_KeepsExpiry(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := repository.NewPool(mr.Addr())
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	mr.SetTime(time.Now())
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Expiry: &expiry})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	ttl := mr.TTL("url:" + shortCode)
+
+	for i := 0; i < 500; i++ {
+		if _, err = serv.Decode(ctx, shortCode); err != nil {
+			t.Fatalf("failed to decode, err: %v", err)
+		}
+	}
+
+	assert.Equal(t, ttl, mr.TTL("url:"+shortCode))
+	// a hit counter expires in milliseconds precision
+	assert.Equal(t, ttl.Truncate(time.Second), mr.TTL("hits:"+shortCode).Truncate(time.Second))
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &shortCode})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Assert(t, objects[0].Expiry != nil && objects[0].Expiry.Equal(expiry))
+	assert.Equal(t, uint64(500), objects[0].Hits)
+}
+
+func TestUpdateExpiry(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	defer mr.Close()
+	repo, _ := repository.NewPool(mr.Addr())
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	mr.SetTime(time.Now())
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	if _, err = serv.Decode(ctx, shortCode); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+
+	// set an expiry
+	expiry := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	if _, err = serv.UpdateExpiry(ctx, shortCode, &expiry); err != nil {
+		t.Fatalf("failed to update expiry, err: %v", err)
+	}
+	assert.Assert(t, mr.TTL("url:"+shortCode) > time.Hour)
+	assert.Equal(t, mr.TTL("url:"+shortCode).Truncate(time.Second), mr.TTL("hits:"+shortCode).Truncate(time.Second))
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &shortCode})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Assert(t, objects[0].Expiry != nil && objects[0].Expiry.Equal(expiry))
+
+	// remove the expiry
+	if _, err = serv.UpdateExpiry(ctx, shortCode, nil); err != nil {
+		t.Fatalf("failed to update expiry, err: %v", err)
+	}
+	assert.Equal(t, time.Duration(0), mr.TTL("url:"+shortCode))
+	assert.Equal(t, time.Duration(0), mr.TTL("hits:"+shortCode))
+
+	objects, _, err = serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &shortCode})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Assert(t, objects[0].Expiry == nil)
+	assert.Equal(t, uint64(1), objects[0].Hits)
+}
+
+func TestUpdate(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{Dedupe: true})
+	ctx := context.Background()
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	if _, err = serv.Decode(ctx, shortCode); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+
+	// a full url and an expiry are changed and hits are kept
+	fullUrl := "http://www.netflix.com"
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	updated, err := serv.Update(ctx, shortCode, model.UpdateOptions{FullURL: &fullUrl, Expiry: &expiry})
+	assert.NilError(t, err)
+	assert.Equal(t, fullUrl, updated.FullURL)
+	assert.Assert(t, updated.Expiry.Equal(expiry))
+	assert.Equal(t, uint64(1), updated.Hits)
+
+	decoded, err := serv.Decode(ctx, shortCode)
+	assert.NilError(t, err)
+	assert.Equal(t, fullUrl, decoded)
+
+	// indexes follow a new full url
+	keyword := "facebook"
+	objects, _, _ := serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: &keyword})
+	assert.Equal(t, 0, len(objects))
+	keyword = "netflix"
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: &keyword})
+	assert.Equal(t, 1, len(objects))
+
+	duplicate, err := serv.Encode(ctx, fullUrl, model.EncodeOptions{Expiry: &expiry})
+	assert.NilError(t, err)
+	assert.Equal(t, shortCode, duplicate.ShortCode)
+	other, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, other.ShortCode != shortCode)
+
+	// fields which aren't specified are unchanged and a zero expiry removes an expiry
+	updated, err = serv.Update(ctx, shortCode, model.UpdateOptions{Expiry: &time.Time{}})
+	assert.NilError(t, err)
+	assert.Equal(t, fullUrl, updated.FullURL)
+	assert.Assert(t, updated.Expiry == nil)
+
+	_, err = serv.Update(ctx, "missing", model.UpdateOptions{FullURL: &fullUrl})
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	assert.Assert(t, shortCode != "")
+	assert.Assert(t, object.CreatedAt != nil)
+
+	fullUrl, err := serv.Decode(ctx, shortCode)
+	if err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+
+	// looking up an url object doesn't count a hit
+	saved, err := serv.GetUrlObject(ctx, shortCode)
+	if err != nil {
+		t.Fatalf("failed to get url object, err: %v", err)
+	}
+	assert.Equal(t, "http://www.facebook.com", saved.FullURL)
+	assert.Equal(t, uint64(1), saved.Hits)
+	assert.Assert(t, saved.CreatedAt.Equal(*object.CreatedAt))
+}
+
+func TestDecode_NotFound(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+
+	_, err := serv.Decode(context.Background(), "missing")
+	cerr, ok := err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.CodeShortCodeNotFound, cerr.Code)
+}
+
+func TestDecode_Expired(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	expiry := time.Now().Add(-time.Second)
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Expiry: &expiry})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+
+	if _, err = serv.Decode(ctx, shortCode); err == nil {
+		t.Fatalf("an expired short code should not be found")
+	}
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 0, len(objects))
+}
+
+func TestGetUrlObjects(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	fullUrls := []string{"http://www.facebook.com", "http://www.netflix.com", "http://www.netflix.com/*"}
+	shortCodes := make([]string, len(fullUrls))
+	for i, fullUrl := range fullUrls {
+		object, err := serv.Encode(ctx, fullUrl, model.EncodeOptions{})
+		if err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+		shortCode := object.ShortCode
+		shortCodes[i] = shortCode
+	}
+	if _, err := serv.Decode(ctx, shortCodes[1]); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 3, len(objects))
+
+	// filter by full url, a glob character is matched literally
+	keyword := "netflix"
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: &keyword})
+	assert.Equal(t, 2, len(objects))
+	keyword = "*"
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: &keyword})
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, shortCodes[2], objects[0].ShortCode)
+
+	// filter by short code and full url
+	keyword = "netflix"
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &shortCodes[1], FullURL: &keyword})
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, "http://www.netflix.com", objects[0].FullURL)
+	assert.Equal(t, uint64(1), objects[0].Hits)
+}
+
+func TestGetUrlObjects_Page(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	// aliases are created in reverse order with more hits and later expiries
+	aliases := []string{"page-e", "page-d", "page-c", "page-b", "page-a"}
+	for i, alias := range aliases {
+		alias := alias
+		expiry := time.Now().Add(time.Duration(i+1) * time.Hour)
+		_, err := serv.Encode(ctx, "http://www.example.com/"+alias, model.EncodeOptions{Alias: &alias, Expiry: &expiry})
+		if err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+		for j := 0; j < i; j++ {
+			if _, err = serv.Decode(ctx, alias); err != nil {
+				t.Fatalf("failed to decode, err: %v", err)
+			}
+		}
+	}
+
+	// walk pages sorted by short codes
+	var codes []string
+	cursor := ""
+	for {
+		objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{Cursor: cursor, Limit: 2})
+		if err != nil {
+			t.Fatalf("failed to get url objects, err: %v", err)
+		}
+		assert.Equal(t, 5, *page.Total)
+		assert.Equal(t, 2, page.Limit)
+		for _, object := range objects {
+			codes = append(codes, object.ShortCode)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.DeepEqual(t, []string{"page-a", "page-b", "page-c", "page-d", "page-e"}, codes)
+
+	// sort by hits in descending order
+	objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits, Desc: true, Limit: 3})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 3, len(objects))
+	assert.Equal(t, "page-a", objects[0].ShortCode)
+	assert.Equal(t, uint64(4), objects[0].Hits)
+	assert.Equal(t, "page-c", objects[2].ShortCode)
+
+	// a cursor of another order is rejected
+	_, _, err = serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortExpiry, Cursor: page.NextCursor})
+	assert.Equal(t, customError.CodeInvalidCursor, err.(*customError.Error).Code)
+	_, _, err = serv.GetUrlObjects(ctx, model.UrlQuery{Cursor: "not a cursor"})
+	assert.Equal(t, customError.CodeInvalidCursor, err.(*customError.Error).Code)
+
+	// the next page continues after the last url object of a previous page
+	objects, page, _ = serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits, Desc: true, Cursor: page.NextCursor})
+	assert.Equal(t, 2, len(objects))
+	assert.Equal(t, "page-d", objects[0].ShortCode)
+	assert.Equal(t, "", page.NextCursor)
+
+	// sort by expiry
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortExpiry, Limit: 1})
+	assert.Equal(t, "page-e", objects[0].ShortCode)
+
+	// limits are clamped
+	_, page, _ = serv.GetUrlObjects(ctx, model.UrlQuery{Limit: MaxPageSize + 1})
+	assert.Equal(t, MaxPageSize, page.Limit)
+}
+
+// loadCounter counts keys loaded by MGet
+type loadCounter struct {
+	repository.Repository
+	loaded int
+}
+
+func (r *loadCounter) MGet(ctx context.Context, keys []interface{}, v interface{}) error {
+	r.loaded += len(keys)
+	return r.Repository.MGet(ctx, keys, v)
+}
+
+func TestGetUrlObjects_SortIndexes(t *testing.T) {
+	repo := &loadCounter{Repository: repository.NewMemory()}
+	serv := New(repo, Config{Domains: domain.List{"brand.ly"}})
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		if _, err := serv.Encode(ctx, fmt.Sprintf("http://www.example.com/%d", i), model.EncodeOptions{}); err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+	}
+	// the same alias in another domain is listed right after it
+	alias := "same"
+	for _, c := range []context.Context{ctx, domain.NewContext(ctx, "brand.ly")} {
+		if _, err := serv.Encode(c, "http://www.example.com/same", model.EncodeOptions{Alias: &alias}); err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+	}
+	if _, err := serv.Decode(ctx, alias); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+
+	// sort indexes are built from the full url index on the first listing,
+	// after that only url objects of a page and the next one are loaded with their hits
+	if _, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{}); err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	repo.loaded = 0
+	objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits, Desc: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 102, *page.Total)
+	assert.Equal(t, alias, objects[0].ShortCode)
+	assert.Equal(t, uint64(1), objects[0].Hits)
+	assert.Assert(t, repo.loaded <= 2*3, "loaded %d keys", repo.loaded)
+
+	// a filtered listing is counted by scanning short codes
+	_, page, _ = serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &alias, Limit: 1})
+	assert.Equal(t, 2, *page.Total)
+	assert.Assert(t, !page.TotalApproximate)
+
+	var listed []string
+	cursor := ""
+	for {
+		objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{Cursor: cursor, Limit: 1, ShortCode: &alias})
+		if err != nil {
+			t.Fatalf("failed to get url objects, err: %v", err)
+		}
+		for _, object := range objects {
+			listed = append(listed, object.Domain)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.DeepEqual(t, []string{domain.Default, "brand.ly"}, listed)
+}
+
+func TestGetUrlObjects_FilteredTotal(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	requests := make([]model.EncodeRequest, maxCountedTotal+10)
+	for i := range requests {
+		requests[i] = model.EncodeRequest{FullURL: fmt.Sprintf("http://www.example.com/%d", i%2)}
+	}
+	for _, result := range serv.EncodeBulk(ctx, requests) {
+		assert.NilError(t, result.Err)
+	}
+
+	// a total of more short codes than can be scanned only counts matches of the scanned ones
+	fullUrl := "http://www.example.com/1"
+	_, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: &fullUrl, FullURLMatch: model.MatchExact})
+	assert.NilError(t, err)
+	assert.Assert(t, page.TotalApproximate)
+	assert.Assert(t, *page.Total >= maxCountedTotal/2-10 && *page.Total <= maxCountedTotal/2+5, *page.Total)
+
+	// an unfiltered total is exact
+	_, page, err = serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Equal(t, maxCountedTotal+10, *page.Total)
+	assert.Assert(t, !page.TotalApproximate)
+}
+
+func TestGetUrlObjects_Expired(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	expiry := time.Now().Add(50 * time.Millisecond)
+	for _, alias := range []string{"expiring", "kept-1", "kept-2"} {
+		alias := alias
+		options := model.EncodeOptions{Alias: &alias}
+		if alias == "expiring" {
+			options.Expiry = &expiry
+		}
+		if _, err := serv.Encode(ctx, "http://www.example.com/"+alias, options); err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// an expired short code is neither listed nor counted
+	objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortCreatedAt})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 2, len(objects))
+	assert.Equal(t, 2, *page.Total)
+
+	space := newKeySpace(tenant.Default, domain.Default)
+	for _, sortName := range []string{model.SortShortCode, model.SortExpiry, model.SortCreatedAt} {
+		n, _ := repo.ZCard(ctx, space.sortIndex(sortName))
+		assert.Equal(t, int64(2), n, sortName)
+	}
+	n, _ := repo.HLen(ctx, space.index())
+	assert.Equal(t, int64(2), n)
+}
+
+func TestGetUrlObjects_BuildsSortIndexes(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	// url objects saved before sort indexes were introduced are only in the full url index
+	for i, code := range []string{"old-a", "old-b"} {
+		object := model.UrlObject{ShortCode: code, FullURL: "http://www.example.com/" + code, Hits: uint64(i)}
+		repo.Set(ctx, fmt.Sprintf(keyPattern, code), object, nil)
+		repo.HSet(ctx, urlIndexKey, code, object.FullURL)
+	}
+
+	objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits, Desc: true})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 2, *page.Total)
+	assert.Equal(t, 2, len(objects))
+	assert.Equal(t, "old-b", objects[0].ShortCode)
+
+	// hits saved in an url object are kept in the hits order
+	if _, err = serv.Decode(ctx, "old-a"); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	if _, err = serv.Decode(ctx, "old-a"); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{Sort: model.SortHits, Desc: true})
+	assert.Equal(t, "old-a", objects[0].ShortCode)
+	assert.Equal(t, uint64(2), objects[0].Hits)
+	assert.Equal(t, 2, len(objects))
+}
+
+func TestGetUrlObjects_Search(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	start := time.Now()
+	expiry := start.Add(time.Hour)
+	inputs := []struct {
+		alias   string
+		fullUrl string
+		expiry  *time.Time
+		hits    int
+	}{
+		{"promo-1", "http://www.example.com/sale?id=1", &expiry, 3},
+		{"promo-2", "http://shop.example.com/sale", nil, 1},
+		{"news-1", "http://www.example.com/news", nil, 0},
+		{"glob-1", "http://www.example.com/*", nil, 0},
+	}
+	for _, input := range inputs {
+		alias := input.alias
+		if _, err := serv.Encode(ctx, input.fullUrl, model.EncodeOptions{Alias: &alias, Expiry: input.expiry}); err != nil {
+			t.Fatalf("failed to encode %s, err: %v", alias, err)
+		}
+		for i := 0; i < input.hits; i++ {
+			if _, err := serv.Decode(ctx, alias); err != nil {
+				t.Fatalf("failed to decode, err: %v", err)
+			}
+		}
+	}
+	search := func(query model.UrlQuery) []string {
+		objects, _, err := serv.GetUrlObjects(ctx, query)
+		assert.NilError(t, err)
+		codes := make([]string, len(objects))
+		for i, object := range objects {
+			codes[i] = object.ShortCode
+		}
+		return codes
+	}
+	value := func(s string) *string { return &s }
+	count := func(n uint64) *uint64 { return &n }
+
+	// string filters
+	assert.DeepEqual(t, []string{"promo-1", "promo-2"}, search(model.UrlQuery{ShortCode: value("promo"), ShortCodeMatch: model.MatchPrefix}))
+	assert.DeepEqual(t, []string{"news-1"}, search(model.UrlQuery{FullURL: value("http://www.example.com/news"), FullURLMatch: model.MatchExact}))
+	assert.DeepEqual(t, []string{"promo-2"}, search(model.UrlQuery{FullURL: value(`^http://shop\.`), FullURLMatch: model.MatchRegex}))
+	assert.DeepEqual(t, []string{"glob-1"}, search(model.UrlQuery{FullURL: value("/*")}))
+	assert.DeepEqual(t, []string{"glob-1", "news-1", "promo-1"}, search(model.UrlQuery{ShortCode: value(`^[a-z]+-1$`), ShortCodeMatch: model.MatchRegex}))
+
+	// ranges of hits
+	assert.DeepEqual(t, []string{"promo-1", "promo-2"}, search(model.UrlQuery{MinHits: count(1)}))
+	assert.DeepEqual(t, []string{"promo-2"}, search(model.UrlQuery{MinHits: count(1), MaxHits: count(2)}))
+
+	// windows of expiry and creation time, short codes without an expiry never expire
+	later := start.Add(2 * time.Hour)
+	assert.DeepEqual(t, []string{"promo-1"}, search(model.UrlQuery{ExpiresBefore: &later}))
+	assert.DeepEqual(t, []string{"glob-1", "news-1", "promo-2"}, search(model.UrlQuery{ExpiresAfter: &later}))
+	assert.Equal(t, 4, len(search(model.UrlQuery{CreatedAfter: &start, CreatedBefore: &later})))
+	assert.Equal(t, 0, len(search(model.UrlQuery{CreatedBefore: &start})))
+
+	// invalid patterns are rejected
+	_, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: value("("), FullURLMatch: model.MatchRegex})
+	assert.Equal(t, customError.CodeInvalidQuery, err.(*customError.Error).Code)
+	_, _, err = serv.GetUrlObjects(ctx, model.UrlQuery{FullURL: value("a"), FullURLMatch: "glob"})
+	assert.Equal(t, customError.CodeInvalidQuery, err.(*customError.Error).Code)
+}
+
+func TestGetUrlObjects_Owner(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{Dedupe: true})
+	ctx := context.Background()
+
+	alice, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Owner: "apikey:alice"})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	assert.Equal(t, "apikey:alice", alice.Owner)
+
+	// a short code of another owner isn't reused in dedupe mode
+	bob, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Owner: "jwt:bob"})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	assert.Assert(t, bob.ShortCode != alice.ShortCode)
+	duplicate, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Owner: "jwt:bob"})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	assert.Equal(t, bob.ShortCode, duplicate.ShortCode)
+
+	if _, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+
+	owner := "apikey:alice"
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{Owner: &owner})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, alice.ShortCode, objects[0].ShortCode)
+
+	// anonymous short codes have no owner
+	owner = ""
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{Owner: &owner})
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, "http://www.netflix.com", objects[0].FullURL)
+
+	objects, _, _ = serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.Equal(t, 3, len(objects))
+}
+
+func TestDeleteUrl(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+
+	deleted, err := serv.DeleteUrl(ctx, shortCode, "")
+	if err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	assert.Assert(t, deleted)
+
+	// a deleted short code is gone
+	_, err = serv.Decode(ctx, shortCode)
+	cerr, ok := err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.CodeShortCodeDeleted, cerr.Code)
+
+	if _, err = serv.DeleteUrl(ctx, shortCode, ""); err == nil {
+		t.Fatalf("a deleted short code should not be deleted again")
+	}
+
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, 0, len(objects))
+}
+
+func TestRestoreUrl(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{DeletedRetention: time.Hour})
+	ctx := context.Background()
+
+	alias := "promo"
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Alias: &alias, Owner: "apikey:a"})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	if _, err = serv.Decode(ctx, alias); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	if _, err = serv.DeleteUrl(ctx, alias, "apikey:b"); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+
+	// a deleted url object is kept with its deletion time, actor and hits
+	owner := "apikey:a"
+	deleted, err := serv.GetDeletedUrls(ctx, &owner, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(deleted))
+	assert.Equal(t, object.FullURL, deleted[0].FullURL)
+	assert.Equal(t, "apikey:b", deleted[0].DeletedBy)
+	assert.Assert(t, deleted[0].DeletedAt != nil)
+	assert.Equal(t, uint64(1), deleted[0].Hits)
+
+	// a restored short code is found again with its hits
+	restored, err := serv.RestoreUrl(ctx, alias)
+	assert.NilError(t, err)
+	assert.Assert(t, restored.DeletedAt == nil)
+	fullUrl, err := serv.Decode(ctx, alias)
+	assert.NilError(t, err)
+	assert.Equal(t, object.FullURL, fullUrl)
+	found, err := serv.GetUrlObject(ctx, alias)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(2), found.Hits)
+	objects, _, _ := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.Equal(t, 1, len(objects))
+
+	_, err = serv.RestoreUrl(ctx, alias)
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+
+	// a deleted short code can't be restored and is purged after its retention
+	if _, err = serv.DeleteUrl(ctx, alias, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	var tombstone model.UrlObject
+	assert.NilError(t, repo.Get(ctx, "deletedUrl:promo", &tombstone))
+	deletedAt := tombstone.DeletedAt.Add(-2 * time.Hour)
+	tombstone.DeletedAt = &deletedAt
+	repo.Set(ctx, "deletedUrl:promo", &tombstone, nil)
+
+	_, err = serv.RestoreUrl(ctx, alias)
+	assert.Equal(t, customError.CodeRetentionExpired, err.(*customError.Error).Code)
+	_, err = serv.Decode(ctx, alias)
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+	_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	assert.NilError(t, err)
+}
+
+func TestRestoreUrl_Expired(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{DeletedRetention: time.Hour})
+	ctx := context.Background()
+
+	alias := "promo"
+	expiry := time.Now().Add(time.Hour)
+	if _, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Alias: &alias, Expiry: &expiry}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	if _, err := serv.DeleteUrl(ctx, alias, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	var tombstone model.UrlObject
+	assert.NilError(t, repo.Get(ctx, "deletedUrl:promo", &tombstone))
+	expired := time.Now().Add(-time.Minute)
+	tombstone.Expiry = &expired
+	repo.Set(ctx, "deletedUrl:promo", &tombstone, nil)
+
+	// an expired short code isn't restored and is purged at once
+	_, err := serv.RestoreUrl(ctx, alias)
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+	exists, _ := repo.Exists(ctx, "deletedUrl:promo")
+	assert.Assert(t, !exists)
+	deleted, _ := repo.SIsMember(ctx, deletedShortUrlKey, alias)
+	assert.Assert(t, !deleted)
+	_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	assert.NilError(t, err)
+}
+
+func TestPurgeExpiredUrls(t *testing.T) {
+	repo := repository.NewMemory()
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "marketing"}})
+	serv := New(repo, Config{DeletedRetention: time.Hour, Tenants: tenants})
+	ctx := context.Background()
+	marketing := tenant.NewContext(ctx, "marketing")
+
+	// short codes are unique across tenants in a domain
+	prefixes := map[context.Context]string{tenant.NewContext(ctx, tenant.Default): "", marketing: "m-"}
+	for c, prefix := range prefixes {
+		for _, alias := range []string{prefix + "old", prefix + "new"} {
+			alias := alias
+			if _, err := serv.Encode(c, "http://www.facebook.com/"+alias, model.EncodeOptions{Alias: &alias}); err != nil {
+				t.Fatalf("failed to encode, err: %v", err)
+			}
+			if _, err := serv.DeleteUrl(c, alias, ""); err != nil {
+				t.Fatalf("failed to delete, err: %v", err)
+			}
+		}
+	}
+	for _, key := range []string{"deletedUrl:old", "tenant:marketing:deletedUrl:m-old"} {
+		var tombstone model.UrlObject
+		assert.NilError(t, repo.Get(ctx, key, &tombstone))
+		deletedAt := tombstone.DeletedAt.Add(-2 * time.Hour)
+		tombstone.DeletedAt = &deletedAt
+		repo.Set(ctx, key, &tombstone, nil)
+	}
+
+	// deleted short codes of all tenants are swept periodically without being listed
+	sweeper := NewRetentionSweeper(serv, 10*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		exists, _ := repo.Exists(ctx, "tenant:marketing:deletedUrl:m-old")
+		if !exists {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sweeper.Close()
+
+	for c, prefix := range prefixes {
+		deleted, err := serv.GetDeletedUrls(c, nil, nil)
+		assert.NilError(t, err)
+		assert.Equal(t, 1, len(deleted))
+		assert.Equal(t, prefix+"new", deleted[0].ShortCode)
+	}
+	purged, err := serv.PurgeExpiredUrls(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, purged)
+}
+
+func TestPurgeUrl(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	alias := "promo"
+	if _, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Alias: &alias}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	err := serv.PurgeUrl(ctx, alias)
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+
+	// deleted short codes are kept forever without retention
+	if _, err = serv.DeleteUrl(ctx, alias, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	assert.Equal(t, customError.CodeAliasTaken, err.(*customError.Error).Code)
+
+	// a short code deleted before deleted url objects were kept is listed but can only be purged
+	repo.SAdd(ctx, deletedShortUrlKey, "legacy")
+	deleted, err := serv.GetDeletedUrls(ctx, nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(deleted))
+	assert.Equal(t, "legacy", deleted[0].ShortCode)
+	_, err = serv.RestoreUrl(ctx, "legacy")
+	assert.Equal(t, customError.KindConflict, err.(*customError.Error).Kind)
+	assert.Equal(t, customError.CodeNotRestorable, err.(*customError.Error).Code)
+
+	// a purged short code can be reused
+	for _, code := range []string{alias, "legacy"} {
+		assert.NilError(t, serv.PurgeUrl(ctx, code))
+		_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{Alias: &code})
+		assert.NilError(t, err)
+	}
+	deleted, _ = serv.GetDeletedUrls(ctx, nil, nil)
+	assert.Equal(t, 0, len(deleted))
+}
+
+func TestTags(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{DeletedRetention: time.Hour})
+	ctx := context.Background()
+
+	inputs := []struct {
+		alias   string
+		fullUrl string
+		owner   string
+		tags    []string
+		folder  string
+		hits    int
+	}{
+		{"summer-mail", "http://www.example.com/mail", "apikey:a", []string{"email", "summer"}, "campaigns/summer", 2},
+		{"summer-ads", "http://www.example.com/ads", "apikey:b", []string{"summer"}, "campaigns", 3},
+		{"winter-mail", "http://www.example.com/winter", "apikey:a", []string{"email"}, "", 1},
+	}
+	for _, input := range inputs {
+		alias := input.alias
+		object, err := serv.Encode(ctx, input.fullUrl, model.EncodeOptions{
+			Alias:  &alias,
+			Owner:  input.owner,
+			Tags:   input.tags,
+			Folder: input.folder,
+		})
+		if err != nil {
+			t.Fatalf("failed to encode %s, err: %v", alias, err)
+		}
+		assert.DeepEqual(t, input.tags, object.Tags)
+		for i := 0; i < input.hits; i++ {
+			if _, err = serv.Decode(ctx, alias); err != nil {
+				t.Fatalf("failed to decode, err: %v", err)
+			}
+		}
+	}
+	search := func(query model.UrlQuery) []string {
+		objects, _, err := serv.GetUrlObjects(ctx, query)
+		assert.NilError(t, err)
+		codes := make([]string, len(objects))
+		for i, object := range objects {
+			codes[i] = object.ShortCode
+		}
+		return codes
+	}
+	value := func(s string) *string { return &s }
+
+	// short codes are listed from an index of a tag and filtered by a folder
+	assert.DeepEqual(t, []string{"summer-ads", "summer-mail"}, search(model.UrlQuery{Tag: value("summer")}))
+	assert.DeepEqual(t, []string{"summer-mail"}, search(model.UrlQuery{Tag: value("summer"), FullURL: value("mail")}))
+	assert.DeepEqual(t, []string{"summer-ads", "summer-mail"}, search(model.UrlQuery{Folder: value("campaigns")}))
+	assert.DeepEqual(t, []string{"summer-mail"}, search(model.UrlQuery{Folder: value("campaigns/summer")}))
+	assert.DeepEqual(t, []string{}, search(model.UrlQuery{Folder: value("camp")}))
+
+	// hits are summed for each tag
+	stats, err := serv.GetTagStats(ctx, nil, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []*model.TagStats{
+		{Tag: "email", Urls: 2, Hits: 3},
+		{Tag: "summer", Urls: 2, Hits: 5},
+	}, stats)
+	owner := "apikey:b"
+	stats, err = serv.GetTagStats(ctx, &owner, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []*model.TagStats{{Tag: "summer", Urls: 1, Hits: 3}}, stats)
+
+	// tags are added and removed and a folder is changed
+	object, err := serv.Update(ctx, "winter-mail", model.UpdateOptions{AddTags: []string{"winter"}, RemoveTags: []string{"email"}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"winter"}, object.Tags)
+	assert.DeepEqual(t, []string{"summer-mail"}, search(model.UrlQuery{Tag: value("email")}))
+	assert.DeepEqual(t, []string{"winter-mail"}, search(model.UrlQuery{Tag: value("winter")}))
+	folder := ""
+	object, err = serv.Update(ctx, "summer-mail", model.UpdateOptions{Folder: &folder})
+	assert.NilError(t, err)
+	assert.Equal(t, "", object.Folder)
+	assert.DeepEqual(t, []string{"summer-ads"}, search(model.UrlQuery{Folder: value("campaigns")}))
+
+	// a short code has a limited number of tags
+	many := make([]string, 21)
+	for i := range many {
+		many[i] = fmt.Sprintf("tag-%d", i)
+	}
+	_, err = serv.Update(ctx, "winter-mail", model.UpdateOptions{AddTags: many})
+	assert.Equal(t, customError.CodeInvalidTag, err.(*customError.Error).Code)
+
+	// a deleted short code is removed from indexes of its tags until it is restored
+	if _, err = serv.DeleteUrl(ctx, "summer-ads", ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	assert.DeepEqual(t, []string{"summer-mail"}, search(model.UrlQuery{Tag: value("summer")}))
+	if _, err = serv.RestoreUrl(ctx, "summer-ads"); err != nil {
+		t.Fatalf("failed to restore, err: %v", err)
+	}
+	assert.DeepEqual(t, []string{"summer-ads", "summer-mail"}, search(model.UrlQuery{Tag: value("summer")}))
+
+	// an expired short code is removed from an index of a tag once it's listed
+	expiry := time.Now().Add(-time.Second)
+	if _, err = serv.Update(ctx, "summer-ads", model.UpdateOptions{Expiry: &expiry}); err != nil {
+		t.Fatalf("failed to update, err: %v", err)
+	}
+	assert.DeepEqual(t, []string{"summer-mail"}, search(model.UrlQuery{Tag: value("summer")}))
+	members, err := repo.SMembers(ctx, "tag:summer")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"summer-mail"}, members)
+}
+
+func TestTags_Reclaimed(t *testing.T) {
+	repo := repository.NewMemory()
+	serv := New(repo, Config{})
+	ctx := context.Background()
+
+	alias := "promo"
+	if _, err := serv.Encode(ctx, "http://www.example.com/old", model.EncodeOptions{Alias: &alias, Tags: []string{"old"}}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	if _, err := serv.Decode(ctx, alias); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+
+	// an expired short code is reclaimed with another tag before it's listed
+	past := time.Now().Add(-time.Minute)
+	for _, key := range []string{"url:promo", "codeTenant:promo"} {
+		if _, err := repo.ExpireAt(ctx, key, &past); err != nil {
+			t.Fatalf("failed to expire, err: %v", err)
+		}
+	}
+	if _, err := serv.Encode(ctx, "http://www.example.com/new", model.EncodeOptions{Alias: &alias, Tags: []string{"new"}}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+
+	// a new url object isn't listed or counted by a tag of the previous one
+	tag := "old"
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{Tag: &tag})
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(objects))
+	stats, err := serv.GetTagStats(ctx, nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, "new", stats[0].Tag)
+	isMember, _ := repo.SIsMember(ctx, "tag:old", alias)
+	assert.Assert(t, !isMember)
+}
+
+func TestCachedService(t *testing.T) {
+	serv := NewCached(repository.NewMemory(), Config{}, 10, time.Minute, time.Hour)
+	ctx := context.Background()
+	defer serv.Close(ctx)
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	for i := 0; i < 3; i++ {
+		if _, err = serv.Decode(ctx, shortCode); err != nil {
+			t.Fatalf("failed to decode, err: %v", err)
+		}
+	}
+
+	stats := serv.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+
+	// finding an url object only flushes pending hits of its short code
+	other, err := serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	if _, err = serv.Decode(ctx, other.ShortCode); err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	object, err = serv.GetUrlObject(ctx, shortCode)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(3), object.Hits)
+	object, err = serv.(*cachedService).service.GetUrlObject(ctx, other.ShortCode)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(0), object.Hits)
+
+	// pending hits are flushed before listing
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{ShortCode: &other.ShortCode, ShortCodeMatch: model.MatchExact})
+	if err != nil {
+		t.Fatalf("failed to get url objects, err: %v", err)
+	}
+	assert.Equal(t, uint64(1), objects[0].Hits)
+
+	// a deleted short code is invalidated
+	if _, err = serv.DeleteUrl(ctx, shortCode, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	if _, err = serv.Decode(ctx, shortCode); err == nil {
+		t.Fatalf("a deleted short code should not be served from cache")
+	}
+}
+
+func TestEncode_Alias(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{})
+	ctx := context.Background()
+
+	alias := "summer-sale"
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Alias: &alias})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	assert.Equal(t, alias, shortCode)
+
+	fullUrl, err := serv.Decode(ctx, alias)
+	if err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+
+	// an alias is taken
+	_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	cerr, ok := err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.CodeAliasTaken, cerr.Code)
+
+	// an alias was deleted
+	if _, err = serv.DeleteUrl(ctx, alias, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	cerr, ok = err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.CodeAliasTaken, cerr.Code)
+}
+
+// fixedGenerator generates specified codes in order
+type fixedGenerator struct {
+	codes []string
+}
+
+func (g *fixedGenerator) Generate(ctx context.Context) (string, error) {
+	if len(g.codes) == 0 {
+		return "taken", nil
+	}
+	code := g.codes[0]
+	g.codes = g.codes[1:]
+	return code, nil
+}
+
+func TestEncode_Collision(t *testing.T) {
+	gen := &fixedGenerator{codes: []string{"taken", "taken", "free"}}
+	serv := New(repository.NewMemory(), Config{Generator: gen})
+	ctx := context.Background()
+
+	alias := "taken"
+	if _, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Alias: &alias}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+
+	// a colliding code is skipped
+	object, err := serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+	assert.Equal(t, "free", shortCode)
+
+	fullUrl, err := serv.Decode(ctx, "taken")
+	if err != nil {
+		t.Fatalf("failed to decode, err: %v", err)
+	}
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+
+	// give up when every code collides
+	_, err = serv.Encode(ctx, "http://www.netflix.com", model.EncodeOptions{})
+	assert.ErrorContains(t, err, "failed to generate unique short code")
+}
+
+func TestEncode_Dedupe(t *testing.T) {
+	serv := New(repository.NewMemory(), Config{Dedupe: true})
+	ctx := context.Background()
+
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	shortCode := object.ShortCode
+
+	// an equivalent url gets the same short code
+	object, err = serv.Encode(ctx, "HTTP://WWW.Facebook.com:80/", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	duplicate := object.ShortCode
+	assert.Equal(t, shortCode, duplicate)
+
+	// dedupe is disabled per request
+	disabled := false
+	object, err = serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Dedupe: &disabled})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	other := object.ShortCode
+	assert.Assert(t, other != shortCode)
+
+	// a different expiry gets a new short code
+	expiry := time.Now().Add(time.Hour)
+	object, err = serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Expiry: &expiry})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	expiring := object.ShortCode
+	assert.Assert(t, expiring != shortCode && expiring != other)
+
+	object, err = serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Expiry: &expiry})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	duplicate = object.ShortCode
+	assert.Equal(t, expiring, duplicate)
+
+	// a deleted short code is never returned
+	if _, err = serv.DeleteUrl(ctx, expiring, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	object, err = serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Expiry: &expiry})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	duplicate = object.ShortCode
+	assert.Assert(t, duplicate != expiring)
+}
+
+func TestEncodeBulk(t *testing.T) {
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "marketing", Quota: 3}})
+	serv := New(repository.NewMemory(), Config{Tenants: tenants, Domains: domain.List{"brand.ly"}})
+	ctx := context.Background()
+
+	// results are in the same order as rows and a failed row doesn't stop other rows
+	taken := "taken"
+	if _, err := serv.Encode(ctx, "http://www.example.com", model.EncodeOptions{Alias: &taken}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	requests := make([]model.EncodeRequest, 120)
+	for i := range requests {
+		requests[i] = model.EncodeRequest{FullURL: fmt.Sprintf("http://www.example.com/%d", i)}
+	}
+	requests[7].Options.Alias = &taken
+	requests[8].Domain = "brand.ly"
+	requests[8].Options.Alias = &taken
+	results := serv.EncodeBulk(ctx, requests)
+	assert.Equal(t, len(requests), len(results))
+	for i, result := range results {
+		if i == 7 {
+			assert.Equal(t, customError.CodeAliasTaken, result.Err.(*customError.Error).Code)
+			continue
+		}
+		assert.NilError(t, result.Err)
+		assert.Equal(t, requests[i].FullURL, result.Object.FullURL)
+	}
+	assert.Equal(t, "brand.ly", results[8].Object.Domain)
+	objects, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Equal(t, 120, *page.Total)
+	assert.Equal(t, 50, len(objects))
+
+	// rows of a tenant with a quota never exceed it
+	marketing := tenant.NewContext(ctx, "marketing")
+	results = serv.EncodeBulk(marketing, requests[:5])
+	for i, result := range results {
+		if i < 3 {
+			assert.NilError(t, result.Err)
+			continue
+		}
+		assert.Equal(t, customError.CodeQuotaExceeded, result.Err.(*customError.Error).Code)
+	}
+
+	// rows aren't encoded after a request is cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	results = serv.EncodeBulk(cancelled, requests[:2])
+	assert.Equal(t, customError.CodeStorageUnavailable, results[0].Err.(*customError.Error).Code)
+}
+
+// writeCounter counts writes of single keys and batches of keys
+type writeCounter struct {
+	repository.Repository
+	writes  int
+	batches int
+}
+
+func (r *writeCounter) SetNX(ctx context.Context, key string, o interface{}, expiry *time.Time) (bool, error) {
+	r.writes++
+	return r.Repository.SetNX(ctx, key, o, expiry)
+}
+
+func (r *writeCounter) HSet(ctx context.Context, key string, field string, value string) error {
+	r.writes++
+	return r.Repository.HSet(ctx, key, field, value)
+}
+
+func (r *writeCounter) MSetNX(ctx context.Context, entries []repository.Entry) ([]bool, error) {
+	r.batches++
+	return r.Repository.MSetNX(ctx, entries)
+}
+
+func TestEncodeBulk_Batch(t *testing.T) {
+	repo := &writeCounter{Repository: repository.NewMemory()}
+	serv := New(repo, Config{Dedupe: true})
+	ctx := context.Background()
+
+	// duplicate rows of a batch get the same short code and an alias is taken by its first row
+	alias := "alias"
+	requests := make([]model.EncodeRequest, 200)
+	for i := range requests {
+		requests[i] = model.EncodeRequest{FullURL: fmt.Sprintf("http://www.example.com/%d", i%100)}
+	}
+	requests[150].Options.Alias = &alias
+	requests[160].Options.Alias = &alias
+	results := serv.EncodeBulk(ctx, requests)
+	for i, result := range results {
+		if i == 160 {
+			assert.Equal(t, customError.CodeAliasTaken, result.Err.(*customError.Error).Code)
+			continue
+		}
+		assert.NilError(t, result.Err)
+		if i >= 100 && i != 150 {
+			assert.Equal(t, results[i-100].Object.ShortCode, result.Object.ShortCode)
+		}
+	}
+	assert.Equal(t, alias, results[150].Object.ShortCode)
+
+	// short codes and url objects are written in batches, not one by one
+	assert.Equal(t, 0, repo.writes)
+	assert.Equal(t, 2, repo.batches)
+	_, page, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Equal(t, 101, *page.Total)
+
+	// an encoded row is found as a duplicate of a later request
+	object, err := serv.Encode(ctx, "http://www.example.com/7", model.EncodeOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, results[7].Object.ShortCode, object.ShortCode)
+}
+
+func TestBulkUpdate(t *testing.T) {
+	var entries bytes.Buffer
+	serv := New(repository.NewMemory(), Config{Audit: audit.NewLogRecorder(&entries)})
+	ctx := context.Background()
+
+	codes := make([]string, 6)
+	for i := range codes {
+		options := model.EncodeOptions{Owner: "alice"}
+		if i >= 3 {
+			options = model.EncodeOptions{Owner: "bob", Tags: []string{"summer"}}
+		}
+		object, err := serv.Encode(ctx, fmt.Sprintf("http://www.example.com/%d", i), options)
+		if err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+		codes[i] = object.ShortCode
+	}
+
+	// a dry run reports short codes which would be changed without changing them
+	alice := "alice"
+	results, err := serv.BulkUpdate(ctx, model.BulkUpdateRequest{
+		Action:     model.BulkDelete,
+		ShortCodes: []string{codes[0], codes[0], codes[3], "missing"},
+		Owner:      &alice,
+		DryRun:     true,
+		Actor:      alice,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(results))
+	assert.NilError(t, results[0].Err)
+	assert.Equal(t, customError.KindForbidden, results[1].Err.(*customError.Error).Kind)
+	assert.Equal(t, customError.CodeShortCodeNotFound, results[2].Err.(*customError.Error).Code)
+	_, err = serv.Decode(ctx, codes[0])
+	assert.NilError(t, err)
+	assert.Equal(t, 0, entries.Len())
+
+	// listed short codes are deleted and each deletion is recorded
+	results, err = serv.BulkUpdate(ctx, model.BulkUpdateRequest{
+		Action:     model.BulkDelete,
+		ShortCodes: []string{codes[0], codes[1]},
+		Owner:      &alice,
+		Actor:      alice,
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, results[0].Err)
+	assert.NilError(t, results[1].Err)
+	_, err = serv.Decode(ctx, codes[1])
+	assert.Equal(t, customError.CodeShortCodeDeleted, err.(*customError.Error).Code)
+	var entry audit.Entry
+	lines := strings.Split(strings.TrimSpace(entries.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.NilError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, alice, entry.Actor)
+	assert.Equal(t, model.BulkDelete, entry.Action)
+	assert.Equal(t, codes[0], entry.ShortCode)
+
+	// short codes matching a query are given an expiry or expired now
+	summer := "summer"
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	results, err = serv.BulkUpdate(ctx, model.BulkUpdateRequest{
+		Action: model.BulkSetExpiry,
+		Query:  model.UrlQuery{Tag: &summer},
+		Expiry: &expiry,
+		Actor:  "admin",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(results))
+	object, err := serv.GetUrlObject(ctx, codes[4])
+	assert.NilError(t, err)
+	assert.Assert(t, object.Expiry.Equal(expiry))
+
+	results, err = serv.BulkUpdate(ctx, model.BulkUpdateRequest{
+		Action:     model.BulkExpire,
+		ShortCodes: []string{codes[5]},
+		Actor:      "admin",
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, results[0].Err)
+	_, err = serv.Decode(ctx, codes[5])
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+	_, err = serv.Decode(ctx, codes[2])
+	assert.NilError(t, err)
+	assert.Equal(t, 6, strings.Count(entries.String(), "\n"))
+
+	// a query matching more short codes than can be changed at once fails as a whole
+	for i := 0; i < MaxBulkUpdate; i++ {
+		if _, err = serv.Encode(ctx, fmt.Sprintf("http://www.example.org/%d", i), model.EncodeOptions{}); err != nil {
+			t.Fatalf("failed to encode, err: %v", err)
+		}
+	}
+	_, err = serv.BulkUpdate(ctx, model.BulkUpdateRequest{Action: model.BulkExpire, DryRun: true})
+	assert.Equal(t, customError.CodeInvalidQuery, err.(*customError.Error).Code)
+}
+
+func TestNormalizeUrl(t *testing.T) {
+	cases := map[string]string{
+		"http://www.facebook.com":             "http://www.facebook.com/",
+		"HTTPS://WWW.Facebook.com:443/a?b=C":  "https://www.facebook.com/a?b=C",
+		"http://www.facebook.com:8080/Path":   "http://www.facebook.com:8080/Path",
+		"https://www.facebook.com:80/#anchor": "https://www.facebook.com:80/#anchor",
+	}
+	for fullUrl, expected := range cases {
+		assert.Equal(t, expected, NormalizeUrl(fullUrl))
+	}
+}
+
+func TestDecode_StorageUnavailable(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to run redis, err: %v", err)
+	}
+	repo, _ := repository.NewPool(mr.Addr())
+	serv := New(repo, Config{})
+	mr.Close()
+
+	_, err = serv.Decode(context.Background(), "abc")
+	cerr, ok := err.(*customError.Error)
+	assert.Assert(t, ok, "unexpected error: %v", err)
+	assert.Equal(t, customError.KindUnavailable, cerr.Kind)
+}
+
+func TestTenants(t *testing.T) {
+	repo := repository.NewMemory()
+	tenants, err := tenant.NewRegistry([]tenant.Tenant{{ID: "marketing", Quota: 2}, {ID: "sales"}})
+	if err != nil {
+		t.Fatalf("failed to create registry, err: %v", err)
+	}
+	serv := New(repo, Config{Tenants: tenants})
+	ctx := context.Background()
+	marketing := tenant.NewContext(ctx, "marketing")
+	sales := tenant.NewContext(ctx, "sales")
+
+	alias := "promo"
+	promo, err := serv.Encode(marketing, "http://www.facebook.com", model.EncodeOptions{Alias: &alias})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	assert.Equal(t, "marketing", promo.Tenant)
+	deal, err := serv.Encode(sales, "http://www.netflix.com", model.EncodeOptions{})
+	if err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	if _, err = serv.Encode(ctx, "http://www.github.com", model.EncodeOptions{}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+
+	// keys of a tenant are prefixed
+	var object model.UrlObject
+	assert.NilError(t, repo.Get(ctx, "tenant:marketing:url:promo", &object))
+	assert.Equal(t, repository.ErrNotFound, repo.Get(ctx, "url:promo", &object))
+
+	// public routes find a tenant of a short code
+	fullUrl, err := serv.Decode(ctx, "promo")
+	assert.NilError(t, err)
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+
+	// a short code of another tenant isn't found
+	_, err = serv.GetUrlObject(sales, "promo")
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+	_, err = serv.DeleteUrl(sales, "promo", "")
+	assert.Equal(t, customError.CodeShortCodeNotFound, err.(*customError.Error).Code)
+
+	objects, _, err := serv.GetUrlObjects(sales, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, deal.ShortCode, objects[0].ShortCode)
+
+	// a context not scoped to a tenant lists all tenants sorted by short codes
+	objects, _, err = serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(objects))
+	byTenant := map[string]*model.UrlObject{}
+	for _, object := range objects {
+		byTenant[object.Tenant] = object
+	}
+	assert.Equal(t, 3, len(byTenant))
+	assert.Equal(t, "promo", byTenant["marketing"].ShortCode)
+	assert.Equal(t, uint64(1), byTenant["marketing"].Hits)
+	assert.Equal(t, deal.ShortCode, byTenant["sales"].ShortCode)
+
+	// short codes are unique across tenants even after deletion
+	_, err = serv.Encode(sales, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	assert.Equal(t, customError.CodeAliasTaken, err.(*customError.Error).Code)
+	if _, err = serv.DeleteUrl(marketing, "promo", ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	_, err = serv.Encode(sales, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	assert.Equal(t, customError.CodeAliasTaken, err.(*customError.Error).Code)
+
+	// a short code saved before tenants were introduced isn't reserved but can't be taken
+	legacy := "legacy"
+	_, _ = repo.Set(ctx, "url:legacy", model.UrlObject{ShortCode: legacy, FullURL: "http://www.google.com"}, nil)
+	_, err = serv.Encode(sales, "http://www.netflix.com", model.EncodeOptions{Alias: &legacy})
+	assert.Equal(t, customError.CodeAliasTaken, err.(*customError.Error).Code)
+	fullUrl, err = serv.Decode(ctx, legacy)
+	assert.NilError(t, err)
+	assert.Equal(t, "http://www.google.com", fullUrl)
+
+	// a quota counts short codes of a tenant, a deleted one isn't counted
+	for i := 0; i < 3; i++ {
+		_, err = serv.Encode(marketing, "http://www.facebook.com", model.EncodeOptions{})
+	}
+	assert.Equal(t, customError.CodeQuotaExceeded, err.(*customError.Error).Code)
+	_, err = serv.Encode(sales, "http://www.facebook.com", model.EncodeOptions{})
+	assert.NilError(t, err)
+}
+
+// slowCount returns counts of sorted sets late so that concurrent requests count before each other's claims
+type slowCount struct {
+	repository.Repository
+}
+
+func (r *slowCount) ZCard(ctx context.Context, key string) (int64, error) {
+	n, err := r.Repository.ZCard(ctx, key)
+	time.Sleep(time.Millisecond)
+	return n, err
+}
+
+func TestQuota(t *testing.T) {
+	repo := &slowCount{Repository: repository.NewMemory()}
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "marketing", Quota: 5}})
+	serv := New(repo, Config{Tenants: tenants, DeletedRetention: time.Hour})
+	ctx := tenant.NewContext(context.Background(), "marketing")
+
+	// concurrent short codes never exceed a quota
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = serv.Encode(ctx, fmt.Sprintf("http://www.example.com/%d", i), model.EncodeOptions{})
+		}(i)
+	}
+	wg.Wait()
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Assert(t, len(objects) <= 5, len(objects))
+	for len(objects) < 5 {
+		object, err := serv.Encode(ctx, "http://www.example.com", model.EncodeOptions{})
+		assert.NilError(t, err)
+		objects = append(objects, object)
+	}
+	_, err = serv.Encode(ctx, "http://www.example.com", model.EncodeOptions{})
+	assert.Equal(t, customError.CodeQuotaExceeded, err.(*customError.Error).Code)
+	results := serv.EncodeBulk(ctx, []model.EncodeRequest{{FullURL: "http://www.example.com"}})
+	assert.Equal(t, customError.CodeQuotaExceeded, results[0].Err.(*customError.Error).Code)
+
+	// a restored short code is counted too
+	if _, err = serv.DeleteUrl(ctx, objects[0].ShortCode, ""); err != nil {
+		t.Fatalf("failed to delete, err: %v", err)
+	}
+	if _, err = serv.Encode(ctx, "http://www.example.com", model.EncodeOptions{}); err != nil {
+		t.Fatalf("failed to encode, err: %v", err)
+	}
+	_, err = serv.RestoreUrl(ctx, objects[0].ShortCode)
+	assert.Equal(t, customError.CodeQuotaExceeded, err.(*customError.Error).Code)
+
+	// an expired short code isn't counted even before it's removed from indexes
+	past := time.Now().Add(-time.Minute)
+	_, err = serv.Update(ctx, objects[1].ShortCode, model.UpdateOptions{Expiry: &past})
+	assert.NilError(t, err)
+	_, err = serv.Encode(ctx, "http://www.example.com", model.EncodeOptions{})
+	assert.NilError(t, err)
+}
+
+func TestDomains(t *testing.T) {
+	repo := repository.NewMemory()
+	tenants, _ := tenant.NewRegistry([]tenant.Tenant{{ID: "marketing", Quota: 2}})
+	domains, err := domain.NewList([]string{"brand.ly"})
+	if err != nil {
+		t.Fatalf("failed to create domains, err: %v", err)
+	}
+	serv := NewCached(repo, Config{Tenants: tenants, Domains: domains}, 10, time.Minute, time.Hour)
+	defer serv.Close(context.Background())
+	ctx := context.Background()
+	brand := domain.NewContext(ctx, "brand.ly")
+
+	// the same alias is available in each domain
+	alias := "promo"
+	object, err := serv.Encode(ctx, "http://www.facebook.com", model.EncodeOptions{Alias: &alias})
+	assert.NilError(t, err)
+	assert.Equal(t, "", object.Domain)
+	object, err = serv.Encode(brand, "http://www.netflix.com", model.EncodeOptions{Alias: &alias})
+	assert.NilError(t, err)
+	assert.Equal(t, "brand.ly", object.Domain)
+	_, err = serv.Encode(brand, "http://www.github.com", model.EncodeOptions{Alias: &alias})
+	assert.Equal(t, customError.CodeAliasTaken, err.(*customError.Error).Code)
+
+	// keys of a domain are prefixed
+	var saved model.UrlObject
+	assert.NilError(t, repo.Get(ctx, "domain:brand.ly:url:promo", &saved))
+
+	// a short code is decoded in a domain of a context
+	fullUrl, err := serv.Decode(ctx, "promo")
+	assert.NilError(t, err)
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+	fullUrl, err = serv.Decode(brand, "promo")
+	assert.NilError(t, err)
+	assert.Equal(t, "http://www.netflix.com", fullUrl)
+
+	// url objects are listed in all domains or filtered by a domain, cached hits are counted in their domain
+	objects, _, err := serv.GetUrlObjects(ctx, model.UrlQuery{})
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(objects))
+	name := "brand.ly"
+	objects, _, err = serv.GetUrlObjects(ctx, model.UrlQuery{Domain: &name})
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, "http://www.netflix.com", objects[0].FullURL)
+	assert.Equal(t, uint64(1), objects[0].Hits)
+
+	// deleting a short code in a domain keeps it in other domains
+	_, err = serv.DeleteUrl(brand, "promo", "")
+	assert.NilError(t, err)
+	_, err = serv.Decode(brand, "promo")
+	assert.Equal(t, customError.CodeShortCodeDeleted, err.(*customError.Error).Code)
+	fullUrl, err = serv.Decode(ctx, "promo")
+	assert.NilError(t, err)
+	assert.Equal(t, "http://www.facebook.com", fullUrl)
+
+	// a quota of a tenant counts short codes of all domains
+	marketing := tenant.NewContext(ctx, "marketing")
+	_, err = serv.Encode(marketing, "http://www.facebook.com", model.EncodeOptions{})
+	assert.NilError(t, err)
+	_, err = serv.Encode(domain.NewContext(marketing, "brand.ly"), "http://www.facebook.com", model.EncodeOptions{})
+	assert.NilError(t, err)
+	_, err = serv.Encode(marketing, "http://www.facebook.com", model.EncodeOptions{})
+	assert.Equal(t, customError.CodeQuotaExceeded, err.(*customError.Error).Code)
+}
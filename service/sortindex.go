@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"url-shortener/customError"
+	"url-shortener/model"
+	"url-shortener/repository"
+)
+
+// key of a sorted set indexing short codes in an order, it has a pattern `sorted:{sort}`.
+// Members are `{value}:{shortCode}` with a value padded to 19 digits, or short codes if sorted by short codes,
+// so that members are sorted by a value and then by a short code like positions of a listing.
+const sortIndexKeyPattern = "sorted:%s"
+
+// key of a marker set once sort indexes of a key space are built from the full url index,
+// short codes saved before sort indexes were introduced are indexed when a key space is listed first
+const sortIndexesBuiltKey = "sortedBuilt"
+
+// sortValueWidth is the number of digits of a value of a sort index member, the maximum int64 has 19 digits
+const sortValueWidth = 19
+
+// maxHitsMoves is the maximum number of moves in the hits order kept until they're written,
+// a short code hit after that is moved once it's listed at a stale position
+const maxHitsMoves = 100000
+
+// sortNames are orders kept in sort indexes
+var sortNames = []string{model.SortShortCode, model.SortHits, model.SortExpiry, model.SortCreatedAt}
+
+// sortIndex returns a key of a sorted set indexing short codes in an order
+func (k keySpace) sortIndex(sortName string) string {
+	return k.prefix + fmt.Sprintf(sortIndexKeyPattern, sortName)
+}
+
+// sortIndexesBuilt returns a key of a marker of built sort indexes
+func (k keySpace) sortIndexesBuilt() string {
+	return k.prefix + sortIndexesBuiltKey
+}
+
+// sortValue returns a value of an url object with its hits in an order, it's 0 if sorted by short codes
+func sortValue(sortName string, object *model.UrlObject) int64 {
+	switch sortName {
+	case model.SortHits:
+		return int64(object.Hits)
+	case model.SortExpiry:
+		// url objects without an expiry never expire, so they are the last ones
+		if object.Expiry == nil {
+			return math.MaxInt64
+		}
+		return object.Expiry.UnixNano()
+	case model.SortCreatedAt:
+		// url objects created before a creation time was saved are the first ones
+		if object.CreatedAt == nil {
+			return 0
+		}
+		return object.CreatedAt.UnixNano()
+	}
+	return 0
+}
+
+// sortMember returns a member of a sort index at a value and a short code
+func sortMember(sortName string, value int64, shortCode string) string {
+	if sortName == model.SortShortCode {
+		return shortCode
+	}
+	// times before 1970 are sorted as the first ones
+	if value < 0 {
+		value = 0
+	}
+	return fmt.Sprintf("%0*d:%s", sortValueWidth, value, shortCode)
+}
+
+// parseSortMember returns a value and a short code of a member of a sort index
+func parseSortMember(sortName string, member string) (int64, string, bool) {
+	if sortName == model.SortShortCode {
+		return 0, member, true
+	}
+	if len(member) <= sortValueWidth+1 || member[sortValueWidth] != ':' {
+		return 0, "", false
+	}
+	value, err := strconv.ParseInt(member[:sortValueWidth], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return value, member[sortValueWidth+1:], true
+}
+
+// addSortIndexes indexes a short code of an url object with its hits in all orders
+func addSortIndexes(ctx context.Context, repo repository.Repository, space keySpace, object *model.UrlObject) error {
+	for _, sortName := range sortNames {
+		err := repo.ZAdd(ctx, space.sortIndex(sortName), sortMember(sortName, sortValue(sortName, object), object.ShortCode))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexSorted indexes a short code of an url object with its hits in all orders
+func (s *service) indexSorted(ctx context.Context, space keySpace, object *model.UrlObject) error {
+	if err := addSortIndexes(ctx, s.repository, space, object); err != nil {
+		return customError.Unavailable("failed to index object", err)
+	}
+	return nil
+}
+
+// removeSorted removes a short code of an url object with its hits from all orders
+func (s *service) removeSorted(ctx context.Context, space keySpace, object *model.UrlObject) error {
+	for _, sortName := range sortNames {
+		_, err := s.repository.ZRem(ctx, space.sortIndex(sortName), sortMember(sortName, sortValue(sortName, object), object.ShortCode))
+		if err != nil {
+			return customError.Unavailable("failed to remove index", err)
+		}
+	}
+	return nil
+}
+
+// moveSorted moves a short code from a value to another one in an order
+func (s *service) moveSorted(ctx context.Context, space keySpace, sortName string, shortCode string, from int64, to int64) error {
+	if from == to {
+		return nil
+	}
+	// a new position is added first so that a short code is always listed
+	err := s.repository.ZAdd(ctx, space.sortIndex(sortName), sortMember(sortName, to, shortCode))
+	if err != nil {
+		return customError.Unavailable("failed to index object", err)
+	}
+	_, err = s.repository.ZRem(ctx, space.sortIndex(sortName), sortMember(sortName, from, shortCode))
+	if err != nil {
+		return customError.Unavailable("failed to remove index", err)
+	}
+	return nil
+}
+
+// hitsMove is a move of a short code in the hits order from hits of its indexed member to its latest hits
+type hitsMove struct {
+	space     keySpace
+	shortCode string
+	from      int64
+	to        int64
+}
+
+// recordHitsMove keeps a move of a short code in the hits order until moves are written by writeHitsMoves
+func (s *service) recordHitsMove(space keySpace, shortCode string, from int64, to int64) {
+	key := space.prefix + shortCode
+	s.movesMu.Lock()
+	defer s.movesMu.Unlock()
+	if move, ok := s.hitsMoves[key]; ok {
+		if to > move.to {
+			move.to = to
+		}
+		return
+	}
+	if len(s.hitsMoves) < maxHitsMoves {
+		s.hitsMoves[key] = &hitsMove{space: space, shortCode: shortCode, from: from, to: to}
+	}
+}
+
+// writeHitsMoves writes kept moves in the hits order, moves failed to be written are kept for the next write
+func (s *service) writeHitsMoves(ctx context.Context) error {
+	s.movesMu.Lock()
+	moves := s.hitsMoves
+	s.hitsMoves = make(map[string]*hitsMove)
+	s.movesMu.Unlock()
+
+	var err error
+	for key, move := range moves {
+		if err == nil {
+			err = s.moveSorted(ctx, move.space, model.SortHits, move.shortCode, move.from, move.to)
+			if err == nil {
+				continue
+			}
+		}
+		s.movesMu.Lock()
+		if later, ok := s.hitsMoves[key]; ok {
+			later.from = move.from
+		} else {
+			s.hitsMoves[key] = move
+		}
+		s.movesMu.Unlock()
+	}
+	return err
+}
+
+// buildSortIndexes indexes short codes of the full url index of a key space in all orders once.
+// Expired short codes are removed from the full url index meanwhile.
+func (s *service) buildSortIndexes(ctx context.Context, space keySpace) error {
+	if _, ok := s.sortIndexed.Load(space.prefix); ok {
+		return nil
+	}
+	built, err := s.repository.Exists(ctx, space.sortIndexesBuilt())
+	if err != nil {
+		return customError.Unavailable("failed to check sort indexes", err)
+	}
+
+	if !built {
+		index, err := s.repository.HGetAll(ctx, space.index())
+		if err != nil {
+			return customError.Unavailable("failed to get members", err)
+		}
+		entries := make([]*listEntry, 0, len(index))
+		for code, url := range index {
+			entries = append(entries, &listEntry{space: space, shortCode: code, fullUrl: url})
+		}
+		if entries, err = s.loadEntries(ctx, entries, nil); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err = s.indexSorted(ctx, space, entry.object); err != nil {
+				return err
+			}
+		}
+		if _, err = s.repository.Set(ctx, space.sortIndexesBuilt(), true, nil); err != nil {
+			return customError.Unavailable("failed to mark sort indexes built", err)
+		}
+	}
+
+	s.sortIndexed.Store(space.prefix, true)
+	return nil
+}
+
+// sweepExpired removes at most loadBatchSize expired short codes of a key space from indexes.
+// Expired short codes are found in the expiry order, they are removed from other orders once they're listed.
+func (s *service) sweepExpired(ctx context.Context, space keySpace, now time.Time) error {
+	expired := sortMember(model.SortExpiry, now.UnixNano(), "")
+	members, err := s.repository.ZRangeByLex(ctx, space.sortIndex(model.SortExpiry), "", false, false, loadBatchSize)
+	if err != nil {
+		return customError.Unavailable("failed to get index", err)
+	}
+
+	entries := make([]*listEntry, 0, len(members))
+	for _, member := range members {
+		if member >= expired {
+			break
+		}
+		_, code, _ := parseSortMember(model.SortExpiry, member)
+		entries = append(entries, &listEntry{space: space, shortCode: code, sortName: model.SortExpiry, member: member})
+	}
+	// url objects are loaded so that a stale member of an updated expiry is removed only from the expiry order
+	_, err = s.loadEntries(ctx, entries, nil)
+	return err
+}
+
+// countListed returns the number of short codes of key spaces which aren't expired
+func (s *service) countListed(ctx context.Context, spaces []keySpace, now time.Time) (int, error) {
+	expired := sortMember(model.SortExpiry, now.UnixNano(), "")
+	var total int64
+	for _, space := range spaces {
+		n, err := s.repository.ZCard(ctx, space.sortIndex(model.SortShortCode))
+		if err != nil {
+			return 0, customError.Unavailable("failed to count short codes", err)
+		}
+		// short codes expired after a sweep are still indexed
+		e, err := s.repository.ZCountBefore(ctx, space.sortIndex(model.SortExpiry), expired)
+		if err != nil {
+			return 0, customError.Unavailable("failed to count short codes", err)
+		}
+		total += n - e
+	}
+	if total < 0 {
+		total = 0
+	}
+	return int(total), nil
+}
+
+// removeListed removes an expired short code from the full url index and the short code order.
+// A member of another order an entry is listed from is removed too.
+func (s *service) removeListed(ctx context.Context, entry *listEntry) error {
+	space, code := entry.space, entry.shortCode
+	url, ok, err := s.repository.HGet(ctx, space.index(), code)
+	if err != nil {
+		return customError.Unavailable("failed to get index", err)
+	}
+	if ok {
+		if err = s.removeIndex(ctx, space, code, url); err != nil {
+			return err
+		}
+	}
+	if _, err = s.repository.ZRem(ctx, space.sortIndex(model.SortShortCode), code); err != nil {
+		return customError.Unavailable("failed to remove index", err)
+	}
+	if entry.member != "" {
+		if _, err = s.repository.ZRem(ctx, space.sortIndex(entry.sortName), entry.member); err != nil {
+			return customError.Unavailable("failed to remove index", err)
+		}
+	}
+	return nil
+}
+
+// sortScan iterates members of a sort index of a key space in an order, members are fetched in batches
+type sortScan struct {
+	space     keySpace
+	sortName  string
+	desc      bool
+	start     string
+	inclusive bool
+	members   []string
+	done      bool
+}
+
+// newSortScan returns a scan of a key space after a position of a listing, from the first member if `after` is nil
+func newSortScan(space keySpace, sortName string, desc bool, after *listKey) *sortScan {
+	scan := &sortScan{space: space, sortName: sortName, desc: desc}
+	if after != nil {
+		scan.start = sortMember(sortName, after.Value, after.ShortCode)
+		// the same value and short code of another key space is listed if it's after a position
+		at := *after
+		at.Tenant, at.Domain = space.tenant, space.domain
+		c := compareKeys(at, *after)
+		scan.inclusive = (c > 0 && !desc) || (c < 0 && desc)
+	}
+	return scan
+}
+
+// next returns the next entry without consuming it, it fetches `size` members if none are left
+func (sc *sortScan) next(ctx context.Context, repo repository.Repository, size int) (*listEntry, error) {
+	for {
+		if len(sc.members) == 0 {
+			if sc.done {
+				return nil, nil
+			}
+			members, err := repo.ZRangeByLex(ctx, sc.space.sortIndex(sc.sortName), sc.start, sc.inclusive, sc.desc, size)
+			if err != nil {
+				return nil, customError.Unavailable("failed to get index", err)
+			}
+			sc.members = members
+			sc.done = len(members) < size
+			if len(members) > 0 {
+				sc.start, sc.inclusive = members[len(members)-1], false
+			}
+			continue
+		}
+
+		member := sc.members[0]
+		if _, code, ok := parseSortMember(sc.sortName, member); ok {
+			return &listEntry{space: sc.space, shortCode: code, sortName: sc.sortName, member: member}, nil
+		}
+		// a member not written by the service is skipped
+		sc.members = sc.members[1:]
+	}
+}
+
+// pop consumes the next entry
+func (sc *sortScan) pop() {
+	sc.members = sc.members[1:]
+}
+
+// position returns a position of an entry listed from a sort index
+func (e *listEntry) position(order string) listKey {
+	value, _, _ := parseSortMember(e.sortName, e.member)
+	return listKey{Sort: order, Value: value, ShortCode: e.shortCode, Tenant: e.space.tenant, Domain: e.space.domain}
+}
+
+// stale reports whether a member of a sort index an entry is listed from isn't at a value of its loaded url object
+func (e *listEntry) stale() bool {
+	return e.member != "" && e.member != sortMember(e.sortName, sortValue(e.sortName, e.object), e.shortCode)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"url-shortener/customError"
+	"url-shortener/model"
+	"url-shortener/validate"
+)
+
+// GetTagStats counts short codes and their hits of each tag with a filtered owner and short domain.
+// Tags of a tenant of a context are counted, or of all tenants if a context isn't scoped to a tenant.
+func (s *service) GetTagStats(ctx context.Context, owner *string, domain *string) ([]*model.TagStats, error) {
+	stats := map[string]*model.TagStats{}
+	f := &filter{query: model.UrlQuery{Owner: owner}}
+	for _, space := range s.listSpaces(ctx, domain) {
+		tags, err := s.repository.SMembers(ctx, space.tags())
+		if err != nil {
+			return nil, customError.Unavailable("failed to get tags", err)
+		}
+		for _, tag := range tags {
+			entries, err := s.tagEntries(ctx, space, tag, f)
+			if err != nil {
+				return nil, err
+			}
+			if entries, err = s.loadEntries(ctx, entries, f); err != nil {
+				return nil, err
+			}
+			if len(entries) == 0 {
+				continue
+			}
+
+			stat, ok := stats[tag]
+			if !ok {
+				stat = &model.TagStats{Tag: tag}
+				stats[tag] = stat
+			}
+			for _, entry := range entries {
+				stat.Urls++
+				stat.Hits += entry.object.Hits
+			}
+		}
+	}
+
+	tagStats := make([]*model.TagStats, 0, len(stats))
+	for _, stat := range stats {
+		tagStats = append(tagStats, stat)
+	}
+	sort.Slice(tagStats, func(i, j int) bool {
+		return tagStats[i].Tag < tagStats[j].Tag
+	})
+	return tagStats, nil
+}
+
+// tagEntries returns short codes with a tag in a key space whose short codes match a filter,
+// their full urls are matched after url objects are loaded
+func (s *service) tagEntries(ctx context.Context, space keySpace, tag string, f *filter) ([]*listEntry, error) {
+	shortCodes, err := s.repository.SMembers(ctx, space.tag(tag))
+	if err != nil {
+		return nil, customError.Unavailable("failed to get short codes of tag", err)
+	}
+	entries := make([]*listEntry, 0, len(shortCodes))
+	for _, code := range shortCodes {
+		if f.shortCode != nil && !f.shortCode(code) {
+			continue
+		}
+		entries = append(entries, &listEntry{space: space, shortCode: code, tag: tag})
+	}
+	return entries, nil
+}
+
+// mergeTags returns tags with added tags and without removed ones, it returns an error if there're too many tags
+func mergeTags(tags []string, added []string, removed []string) ([]string, error) {
+	set := make(map[string]bool, len(tags)+len(added))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	for _, tag := range added {
+		set[tag] = true
+	}
+	for _, tag := range removed {
+		delete(set, tag)
+	}
+	if len(set) > validate.MaxTags {
+		return nil, customError.Validation(
+			customError.CodeInvalidTag,
+			fmt.Sprintf("a short code has at most %d tags", validate.MaxTags),
+		)
+	}
+
+	merged := make([]string, 0, len(set))
+	for tag := range set {
+		merged = append(merged, tag)
+	}
+	sort.Strings(merged)
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// indexTags adds a short code to indexes of tags, a short code or a tag which is already indexed is kept
+func (s *service) indexTags(ctx context.Context, space keySpace, shortCode string, tags []string) error {
+	for _, tag := range tags {
+		if err := s.repository.SAddAll(ctx, space.tag(tag), []string{shortCode}); err != nil {
+			return customError.Unavailable("failed to index tag", err)
+		}
+	}
+	if len(tags) > 0 {
+		if err := s.repository.SAddAll(ctx, space.tags(), tags); err != nil {
+			return customError.Unavailable("failed to index tag", err)
+		}
+	}
+	return nil
+}
+
+// hasTag reports whether tags contain a tag
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTags removes a short code from indexes of tags, a tag is kept in used tags even if it has no short codes
+func (s *service) removeTags(ctx context.Context, space keySpace, shortCode string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := s.repository.SRem(ctx, space.tag(tag), shortCode); err != nil {
+			return customError.Unavailable("failed to remove tag index", err)
+		}
+	}
+	return nil
+}
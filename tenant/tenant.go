@@ -0,0 +1,73 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Default is a tenant of data created before tenants were introduced, its keys have no prefix
+const Default = ""
+
+// idPattern allows lowercase letters, digits and `-` with 1 to 32 characters, an id is a part of storage keys
+var idPattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// Tenant is a business unit whose data is isolated from other tenants
+type Tenant struct {
+	ID string `json:"id"`
+	// Quota is the maximum number of short codes of a tenant, 0 for unlimited
+	Quota int `json:"quota"`
+	// Blacklist is regular expressions of full urls which can't be shortened in addition to the global blacklist
+	Blacklist []string `json:"blacklist"`
+}
+
+// Registry is configured tenants by their ids
+type Registry map[string]Tenant
+
+// NewRegistry validates tenants and indexes them by their ids, the default tenant is always included
+func NewRegistry(tenants []Tenant) (Registry, error) {
+	registry := Registry{Default: {ID: Default}}
+	for _, t := range tenants {
+		if err := CheckID(t.ID); err != nil {
+			return nil, err
+		}
+		for _, pattern := range t.Blacklist {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid blacklist of tenant %s, err: %v", t.ID, err)
+			}
+		}
+		registry[t.ID] = t
+	}
+	return registry, nil
+}
+
+// Get returns a tenant of `id`, a tenant which isn't configured has no quota and blacklist
+func (r Registry) Get(id string) Tenant {
+	if t, ok := r[id]; ok {
+		return t
+	}
+	return Tenant{ID: id}
+}
+
+// CheckID returns an error if an id of a tenant has characters not allowed
+func CheckID(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("tenant id must be 1 to 32 lowercase letters, digits or `-`")
+	}
+	return nil
+}
+
+// contextKey is a key of a tenant id in a context
+type contextKey struct{}
+
+// NewContext returns a context scoped to a tenant
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns a tenant id of a context.
+// It returns false if a context isn't scoped to a tenant, e.g. public requests and super admins.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
@@ -3,12 +3,31 @@ package validate
 import (
 	"fmt"
 	"regexp"
+	"sort"
+	"strings"
 )
 
 var blackLists = []string{"www.google.com"}
 
-func CheckBlackList(url string) error {
-	for _, blackList := range blackLists {
+// aliasPattern allows letters, digits, `-` and `_` with 3 to 32 characters
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+// tagPattern allows lowercase letters, digits, `-` and `_` with 1 to 32 characters
+var tagPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// folderPattern allows `/` separated folders of letters, digits, `-` and `_` with up to 5 levels
+var folderPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}(/[A-Za-z0-9_-]{1,32}){0,4}$`)
+
+// MaxTags is the maximum number of tags of a short code
+const MaxTags = 20
+
+// reservedAliases can't be used as an alias because they are paths of APIs
+var reservedAliases = []string{"admin", "swagger", "shorten", "debug"}
+
+// CheckBlackList returns an error if an url matches the global blacklist or `extra` regular expressions
+func CheckBlackList(url string, extra ...string) error {
+	patterns := append(append([]string{}, blackLists...), extra...)
+	for _, blackList := range patterns {
 		matched, err := regexp.MatchString(
 			fmt.Sprintf(`%s`, blackList),
 			url,
@@ -22,3 +41,46 @@ func CheckBlackList(url string) error {
 	}
 	return nil
 }
+
+// CheckAlias returns an error if an alias has characters not allowed, an invalid length or is reserved
+func CheckAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("alias must be 3 to 32 letters, digits, `-` or `_`")
+	}
+	for _, reserved := range reservedAliases {
+		if strings.EqualFold(alias, reserved) {
+			return fmt.Errorf("alias is reserved")
+		}
+	}
+	return nil
+}
+
+// NormalizeTags lowercases and trims tags, removes duplicates and sorts them.
+// It returns an error if a tag has characters not allowed or an invalid length.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("tag must be 1 to 32 letters, digits, `-` or `_`: %q", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// CheckFolder returns an error if a folder isn't up to 5 levels of letters, digits, `-` and `_` separated by `/`
+func CheckFolder(folder string) error {
+	if !folderPattern.MatchString(folder) {
+		return fmt.Errorf("folder must be up to 5 levels of 1 to 32 letters, digits, `-` or `_` separated by `/`")
+	}
+	return nil
+}
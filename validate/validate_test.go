@@ -1,6 +1,7 @@
 package validate
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -14,3 +15,45 @@ func TestCheckBlackList_Failed(t *testing.T) {
 		t.Fatalf("it should be banned")
 	}
 }
+func TestCheckAlias_Success(t *testing.T) {
+	for _, alias := range []string{"summer-sale", "abc", "Promo_2021"} {
+		if err := CheckAlias(alias); err != nil {
+			t.Fatalf("%s should be allowed, err: %v", alias, err)
+		}
+	}
+}
+func TestCheckAlias_Failed(t *testing.T) {
+	for _, alias := range []string{"ab", "summer sale", "a/b", "sale*", "Admin", "swagger", "a-very-long-alias-which-is-over-32-chars"} {
+		if err := CheckAlias(alias); err == nil {
+			t.Fatalf("%s should not be allowed", alias)
+		}
+	}
+}
+func TestNormalizeTags_Success(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Summer", "email", "summer", "q3_2021"})
+	if err != nil {
+		t.Fatalf("tags should be allowed, err: %v", err)
+	}
+	if strings.Join(tags, ",") != "email,q3_2021,summer" {
+		t.Fatalf("tags should be normalized, got: %v", tags)
+	}
+}
+func TestNormalizeTags_Failed(t *testing.T) {
+	for _, tag := range []string{"", "summer sale", "a/b", "sale*", "a-very-long-tag-which-is-over-32-chars"} {
+		if _, err := NormalizeTags([]string{tag}); err == nil {
+			t.Fatalf("%s should not be allowed", tag)
+		}
+	}
+}
+func TestCheckFolder(t *testing.T) {
+	for _, folder := range []string{"campaigns", "campaigns/summer", "a/b/c/d/e"} {
+		if err := CheckFolder(folder); err != nil {
+			t.Fatalf("%s should be allowed, err: %v", folder, err)
+		}
+	}
+	for _, folder := range []string{"/campaigns", "campaigns/", "a//b", "a/b/c/d/e/f", "summer sale"} {
+		if err := CheckFolder(folder); err == nil {
+			t.Fatalf("%s should not be allowed", folder)
+		}
+	}
+}